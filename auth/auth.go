@@ -12,6 +12,7 @@ package auth
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"crypto/sha512"
@@ -31,6 +32,27 @@ var errInvalidRoundTripArgs = fmt.Errorf("invalid auth arguments")
 // auth requirements to HTTP requests.
 type RoundTrip func(*http.Request) (*http.Response, error)
 
+type transportKey struct{}
+
+// WithTransport will return a copy of the context that carries the transport
+// over which the round trippers of this package make their requests, e.g. the
+// transport of a gidari HTTP Service, so that its TLS, proxy and connection
+// settings apply to authenticated requests.
+func WithTransport(ctx context.Context, transport http.RoundTripper) context.Context {
+	return context.WithValue(ctx, transportKey{}, transport)
+}
+
+// Transport will return the transport carried by the context of the request,
+// see WithTransport, or "http.DefaultTransport" if there is none. A custom
+// auth round tripper should make its request over this transport.
+func Transport(req *http.Request) http.RoundTripper {
+	if transport, ok := req.Context().Value(transportKey{}).(http.RoundTripper); ok && transport != nil {
+		return transport
+	}
+
+	return http.DefaultTransport
+}
+
 // NewBasicAuthRoundTrip will return a "RoundTrip" function that can be used as
 // a "RoundTrip" function in an "http.RoundTripper" interface to authenticate
 // requests that require basic authentication.
@@ -42,7 +64,7 @@ func NewBasicAuthRoundTrip(username, password string) (RoundTrip, error) {
 	return func(req *http.Request) (*http.Response, error) {
 		req.SetBasicAuth(username, password)
 
-		rsp, err := http.DefaultTransport.RoundTrip(req)
+		rsp, err := Transport(req).RoundTrip(req)
 		if err != nil {
 			return nil, fmt.Errorf("error making request: %w", err)
 		}
@@ -92,7 +114,7 @@ func NewCoinbaseRoundTrip(key, secret, passphrase string) (RoundTrip, error) {
 		req.Header.Add("cb-access-sign", sig)
 		req.Header.Add("cb-access-timestamp", timestamp)
 
-		rsp, err := http.DefaultTransport.RoundTrip(req)
+		rsp, err := Transport(req).RoundTrip(req)
 		if err != nil {
 			return nil, fmt.Errorf("error making request: %w", err)
 		}
@@ -127,7 +149,7 @@ func NewKrakenRoundTrip(key, secret string) (RoundTrip, error) {
 		// If the path includes "public" then we don't need to sign the
 		// request.
 		if strings.Contains(req.URL.Path, "0/public") {
-			rsp, err := http.DefaultTransport.RoundTrip(req)
+			rsp, err := Transport(req).RoundTrip(req)
 			if err != nil {
 				return nil, fmt.Errorf("error making request: %w", err)
 			}
@@ -163,7 +185,7 @@ func NewKrakenRoundTrip(key, secret string) (RoundTrip, error) {
 		// Set the body to the url.Values encoded body.
 		req.Body = io.NopCloser(bytes.NewBufferString(values.Encode()))
 
-		rsp, err := http.DefaultTransport.RoundTrip(req)
+		rsp, err := Transport(req).RoundTrip(req)
 		if err != nil {
 			return nil, fmt.Errorf("error making request: %w", err)
 		}
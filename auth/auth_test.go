@@ -14,6 +14,7 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"testing"
@@ -147,3 +148,50 @@ func TestNewKrakenRoundTripper(t *testing.T) {
 		})
 	}
 }
+
+// transportFunc is an "http.RoundTripper" that calls the function.
+type transportFunc func(*http.Request) (*http.Response, error)
+
+func (fn transportFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+
+	var got *http.Request
+
+	transport := transportFunc(func(req *http.Request) (*http.Response, error) {
+		got = req
+
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+
+	rtripper, err := NewBasicAuthRoundTrip("user", "pass")
+	if err != nil {
+		t.Fatalf("failed to create round tripper: %v", err)
+	}
+
+	ctx := WithTransport(context.Background(), transport)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	if _, err := rtripper(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got == nil {
+		t.Fatal("expected the request to be made over the transport of the context")
+	}
+
+	if user, pass, ok := got.BasicAuth(); !ok || user != "user" || pass != "pass" {
+		t.Errorf("expected the request to be authenticated, got %q, %q", user, pass)
+	}
+
+	if Transport(httptest.NewRequest(http.MethodGet, "/", nil)) != http.DefaultTransport {
+		t.Error("expected the default transport without a transport in the context")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrBodyFunc is returned when the body function of a request fails, see
+// WithBodyFunc.
+var ErrBodyFunc = errors.New("failed to generate request body")
+
+// BodyFunc is a function that generates the body of a request.
+type BodyFunc func() (io.Reader, error)
+
+// WithBodyFunc sets a function that generates a new body for every attempt at
+// the request, including each retry and each page, for APIs whose bodies must
+// change with each attempt, e.g. to include a nonce or a timestamp. The body
+// of the "http.Request" is replaced with the generated body just before the
+// request interceptors are called, so an interceptor or a round tripper that
+// signs the request, see WithAuth, signs the body that is sent. Unlike a body
+// that is replayed with "GetBody", a request with a body function can always be
+// retried. If the function fails, then the attempt fails with an ErrBodyFunc
+// error, and is not retried.
+func WithBodyFunc(fn BodyFunc) RequestOption {
+	return func(req *Request) {
+		req.bodyFunc = fn
+	}
+}
+
+// generateBody will replace the body of the HTTP request, the attempt at the
+// request, with a newly generated body, if the request has a body function.
+func (req *Request) generateBody(httpReq *http.Request) error {
+	if req.bodyFunc == nil {
+		return nil
+	}
+
+	body, err := req.bodyFunc()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBodyFunc, err)
+	}
+
+	if body == nil {
+		httpReq.Body, httpReq.ContentLength, httpReq.GetBody = http.NoBody, 0, nil
+
+		return nil
+	}
+
+	// Set the length of the body for the readers whose length is known,
+	// as "http.NewRequest" does. Otherwise, the length is unknown.
+	var length int64
+
+	switch body := body.(type) {
+	case *bytes.Buffer:
+		length = int64(body.Len())
+	case *bytes.Reader:
+		length = int64(body.Len())
+	case *strings.Reader:
+		length = int64(body.Len())
+	}
+
+	httpReq.Body = io.NopCloser(body)
+	httpReq.ContentLength = length
+	httpReq.GetBody = nil
+
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// signBody will return the HMAC of the body with the test key.
+func signBody(body []byte) string {
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHTTPServiceBodyFunc(t *testing.T) {
+	t.Parallel()
+
+	const failures = 2
+
+	var (
+		mtx    sync.Mutex
+		bodies []string
+	)
+
+	// The server fails the first attempts, and rejects any body whose
+	// signature does not match.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if r.Header.Get("X-Signature") != signBody(body) {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		mtx.Lock()
+		bodies = append(bodies, string(body))
+		attempt := len(bodies)
+		mtx.Unlock()
+
+		if attempt <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		fmt.Fprint(w, `[{"id":1}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	var nonce int
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	svc.HTTP.
+		MaxRetries(failures).
+		RetryBackoff(time.Millisecond).
+		RequestInterceptors(func(req *http.Request) error {
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return err
+			}
+
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.Header.Set("X-Signature", signBody(body))
+
+			return nil
+		}).
+		Requests(NewHTTPRequest(req, WithBodyFunc(func() (io.Reader, error) {
+			nonce++
+
+			return bytes.NewBufferString(fmt.Sprintf(`{"nonce":%d}`, nonce)), nil
+		})))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	want := []string{`{"nonce":1}`, `{"nonce":2}`, `{"nonce":3}`}
+	if fmt.Sprint(bodies) != fmt.Sprint(want) {
+		t.Errorf("expected bodies %q, got %q", want, bodies)
+	}
+}
+
+func TestHTTPServiceBodyFuncError(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+	}))
+	t.Cleanup(server.Close)
+
+	errNonce := errors.New("nonce unavailable")
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	svc.HTTP.
+		MaxRetries(3).
+		Requests(newTestServerRequest(t, server.URL, WithBodyFunc(func() (io.Reader, error) {
+			return nil, errNonce
+		})))
+
+	err = svc.HTTP.Store(context.Background())
+	if !errors.Is(err, ErrBodyFunc) || !errors.Is(err, errNonce) {
+		t.Fatalf("expected %v, got %v", errNonce, err)
+	}
+
+	if calls.Load() != 0 || svc.HTTP.Result().Retries != 0 {
+		t.Errorf("expected no requests or retries, got %d and %d", calls.Load(), svc.HTTP.Result().Retries)
+	}
+}
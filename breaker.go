@@ -0,0 +1,208 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a request is not made because the circuit
+// breaker of its host is open, see "HTTPService.CircuitBreaker".
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker sets a circuit breaker for each host that the requests are
+// made to. Once there have been "threshold" consecutive failures for a host,
+// the first and last of which are no more than "window" apart, the circuit
+// opens: every request to the host fails fast with an ErrCircuitOpen error,
+// without being made or retried, for the "cooldown". The circuit is then
+// half-open, and a single request to the host is made to test whether it has
+// recovered. If it succeeds, then the circuit closes, otherwise it opens again
+// for another cooldown. While the test request is in progress, any other
+// request to the host fails fast.
+//
+// A failure is a transport error or a 5xx response. Every state change is
+// logged at the warning level. The state of the circuits is kept across runs.
+// A threshold of zero (the default) means there is no circuit breaker.
+func (svc *HTTPService) CircuitBreaker(threshold int, window, cooldown time.Duration) *HTTPService {
+	svc.breaker = nil
+	if threshold > 0 {
+		svc.breaker = newCircuitBreaker(threshold, window, cooldown)
+	}
+
+	return svc
+}
+
+// circuitState is the state of the circuit of a host.
+type circuitState uint8
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// String will return the name of the state.
+func (state circuitState) String() string {
+	switch state {
+	case circuitClosed:
+		return "closed"
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+// hostCircuit is the circuit of a single host.
+type hostCircuit struct {
+	state        circuitState
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+}
+
+// circuitBreaker is a set of circuits, keyed by host.
+type circuitBreaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+
+	mtx      sync.Mutex
+	circuits map[string]*hostCircuit
+}
+
+func newCircuitBreaker(threshold int, window, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+		circuits:  make(map[string]*hostCircuit),
+	}
+}
+
+// circuit will return the circuit of the host, creating a closed circuit if
+// there is none. The caller must hold the lock.
+func (cb *circuitBreaker) circuit(host string) *hostCircuit {
+	circuit, ok := cb.circuits[host]
+	if !ok {
+		circuit = &hostCircuit{}
+		cb.circuits[host] = circuit
+	}
+
+	return circuit
+}
+
+// allow will return an ErrCircuitOpen error if a request to the host must fail
+// fast. If the cooldown of an open circuit has elapsed, then the circuit
+// becomes half-open and the request is allowed as its test request; the
+// circuit stays half-open until the outcome of that request is recorded. The
+// states before and after are returned, so that the caller can report a
+// change.
+func (cb *circuitBreaker) allow(host string, now time.Time) (circuitState, circuitState, error) {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	circuit := cb.circuit(host)
+	from := circuit.state
+
+	switch circuit.state {
+	case circuitClosed:
+	case circuitOpen:
+		if now.Sub(circuit.openedAt) < cb.cooldown {
+			return from, circuit.state, ErrCircuitOpen
+		}
+
+		circuit.state = circuitHalfOpen
+	case circuitHalfOpen:
+		return from, circuit.state, ErrCircuitOpen
+	}
+
+	return from, circuit.state, nil
+}
+
+// record will update the circuit of the host with the outcome of an allowed
+// request, returning the states before and after.
+func (cb *circuitBreaker) record(host string, now time.Time, failed bool) (circuitState, circuitState) {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	circuit := cb.circuit(host)
+	from := circuit.state
+
+	if circuit.state == circuitHalfOpen {
+		circuit.failures = 0
+
+		if failed {
+			circuit.state = circuitOpen
+			circuit.openedAt = now
+		} else {
+			circuit.state = circuitClosed
+		}
+
+		return from, circuit.state
+	}
+
+	// A request that was allowed before the circuit opened may complete
+	// while it is open; its outcome does not change the circuit.
+	if circuit.state == circuitOpen {
+		return from, circuit.state
+	}
+
+	if !failed {
+		circuit.failures = 0
+
+		return from, circuit.state
+	}
+
+	if circuit.failures == 0 || now.Sub(circuit.firstFailure) > cb.window {
+		circuit.failures = 0
+		circuit.firstFailure = now
+	}
+
+	circuit.failures++
+
+	if circuit.failures >= cb.threshold {
+		circuit.state = circuitOpen
+		circuit.openedAt = now
+		circuit.failures = 0
+	}
+
+	return from, circuit.state
+}
+
+// isCircuitFailure will return true if the outcome of a request counts as a
+// failure of its host.
+func isCircuitFailure(rsp *http.Response, err error) bool {
+	if err != nil {
+		// A canceled or intercepted request says nothing about the
+		// host.
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, ErrRequestInterceptor)
+	}
+
+	return rsp != nil && rsp.StatusCode >= http.StatusInternalServerError
+}
+
+// logCircuit will log a change in the state of the circuit of the host.
+func logCircuit(ctx context.Context, logger *slog.Logger, host string, from, to circuitState) {
+	if logger == nil || from == to {
+		return
+	}
+
+	logger.LogAttrs(ctx, slog.LevelWarn, "circuit breaker state changed",
+		slog.String("host", host),
+		slog.String("from", from.String()),
+		slog.String("to", to.String()))
+}
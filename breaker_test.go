@@ -0,0 +1,190 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	type step struct {
+		after     time.Duration // time since the start
+		failed    bool
+		wantErr   error
+		wantState circuitState
+	}
+
+	for _, tcase := range []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "closed to open to half-open to closed",
+			steps: []step{
+				{failed: true, wantState: circuitClosed},
+				{after: time.Second, failed: true, wantState: circuitOpen},
+				{after: 2 * time.Second, wantErr: ErrCircuitOpen, wantState: circuitOpen},
+				{after: 11 * time.Second, wantState: circuitClosed},
+				{after: 12 * time.Second, failed: true, wantState: circuitClosed},
+			},
+		},
+		{
+			name: "failed test request opens again",
+			steps: []step{
+				{failed: true, wantState: circuitClosed},
+				{failed: true, wantState: circuitOpen},
+				{after: 10 * time.Second, failed: true, wantState: circuitOpen},
+				{after: 19 * time.Second, wantErr: ErrCircuitOpen, wantState: circuitOpen},
+				{after: 20 * time.Second, wantState: circuitClosed},
+			},
+		},
+		{
+			name: "failures outside the window",
+			steps: []step{
+				{failed: true, wantState: circuitClosed},
+				{after: 6 * time.Second, failed: true, wantState: circuitClosed},
+				{after: 7 * time.Second, failed: true, wantState: circuitOpen},
+			},
+		},
+		{
+			name: "success resets the failures",
+			steps: []step{
+				{failed: true, wantState: circuitClosed},
+				{after: time.Second, wantState: circuitClosed},
+				{after: 2 * time.Second, failed: true, wantState: circuitClosed},
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			breaker := newCircuitBreaker(2, 5*time.Second, 10*time.Second)
+
+			for idx, step := range tcase.steps {
+				at := now.Add(step.after)
+
+				_, state, err := breaker.allow("example.com", at)
+				if !errors.Is(err, step.wantErr) {
+					t.Fatalf("step %d: expected error %v, got %v", idx, step.wantErr, err)
+				}
+
+				if err == nil {
+					_, state = breaker.record("example.com", at, step.failed)
+				}
+
+				if state != step.wantState {
+					t.Fatalf("step %d: expected state %v, got %v", idx, step.wantState, state)
+				}
+			}
+
+			// The circuits of other hosts are not affected.
+			if _, state, _ := breaker.allow("other.com", now); state != circuitClosed {
+				t.Errorf("expected the circuit of another host to be closed, got %v", state)
+			}
+		})
+	}
+}
+
+// statusClient is a client that responds with each of its status codes in
+// turn, counting the requests made to it.
+type statusClient struct {
+	mtx      sync.Mutex
+	statuses []int
+	calls    int
+}
+
+func (c *statusClient) Do(req *http.Request) (*http.Response, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	status := c.statuses[c.calls]
+	c.calls++
+
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`[{"id":1}]`)),
+		Request:    req,
+	}, nil
+}
+
+func TestHTTPServiceCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	clk := newFakeClock()
+
+	svc, err := NewService(context.Background(), withClock(clk),
+		WithLogger(slog.New(slog.NewJSONHandler(buf, nil))))
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	client := &statusClient{statuses: []int{
+		http.StatusServiceUnavailable,
+		http.StatusBadGateway,
+		http.StatusOK,
+	}}
+
+	svc.HTTP.Client(client).CircuitBreaker(2, time.Minute, 30*time.Second)
+
+	for idx, want := range []struct {
+		advance time.Duration
+		retries int
+		err     error
+		calls   int
+	}{
+		{err: ErrBadResponse, calls: 1},
+		{err: ErrBadResponse, calls: 2},
+		// A request that fails fast is not retried.
+		{retries: 3, err: ErrCircuitOpen, calls: 2},
+		{advance: 30 * time.Second, calls: 3},
+	} {
+		clk.advance(want.advance)
+
+		svc.HTTP.MaxRetries(want.retries)
+		svc.HTTP.requests = nil
+		svc.HTTP.Requests(newTestServerRequest(t, "http://example.com/products"))
+
+		if err := svc.HTTP.Store(context.Background()); !errors.Is(err, want.err) {
+			t.Fatalf("run %d: expected error %v, got %v", idx, want.err, err)
+		}
+
+		if client.calls != want.calls {
+			t.Fatalf("run %d: expected %d calls, got %d", idx, want.calls, client.calls)
+		}
+	}
+
+	logs := buf.String()
+
+	for _, want := range []string{
+		`"from":"closed","to":"open"`,
+		`"from":"open","to":"half-open"`,
+		`"from":"half-open","to":"closed"`,
+	} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("expected log of state change %s, got %s", want, logs)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/protobuf/proto"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrBufferedWriterClosed is returned when a list is written to a
+// BufferedWriter that has been closed.
+var ErrBufferedWriterClosed = errors.New("buffered writer is closed")
+
+// BufferPolicy determines what a BufferedWriter does with a list when its
+// queue is full.
+type BufferPolicy uint8
+
+const (
+	// BufferPolicyBlock will block the write until there is room in the
+	// queue, so that a slow writer applies backpressure once its queue is
+	// full. This is the default policy.
+	BufferPolicyBlock BufferPolicy = iota
+
+	// BufferPolicyDrop will drop the list, writing it to the dead-letter
+	// writer if there is one, so that a slow writer never holds back the
+	// others.
+	BufferPolicyDrop
+)
+
+// BufferedWriter is a ListWriter that queues lists and writes them to an
+// underlying writer from its own goroutine, so that a slow writer, e.g. a
+// remote search index, does not hold back the other writers of a request. A
+// MultiWriter waits for every writer to accept a list; a BufferedWriter
+// accepts a list as soon as it is queued. Once the queue is full, the policy
+// decides whether to block or to drop the list.
+//
+// Since lists are written in the background, an error from the underlying
+// writer is not returned by "Write" but by the next call to "Flush", which
+// services make at the end of every run, see Flusher. Call "Close" once the
+// writer is no longer needed to stop its goroutine.
+type BufferedWriter struct {
+	writer     ListWriter
+	policy     BufferPolicy
+	deadLetter ListWriter
+
+	queue   chan bufferedList
+	done    chan struct{}
+	dropped atomic.Int64
+
+	// pendingMtx guards pending, the number of lists queued or being
+	// written, and idle, which is closed whenever pending is zero. Unlike
+	// a WaitGroup, it can be waited on while lists are still being added,
+	// e.g. when the writer is shared by concurrent runs.
+	pendingMtx sync.Mutex
+	pending    int
+	idle       chan struct{}
+
+	// mtx guards closed, and is held for read while a list is queued so
+	// that the queue is not closed under a write. It is never taken by the
+	// goroutine that drains the queue, so that a write blocked on a full
+	// queue cannot hold up the drain.
+	mtx    sync.RWMutex
+	closed bool
+
+	// errMtx guards errs.
+	errMtx sync.Mutex
+	errs   []error
+}
+
+// bufferedList is a list queued for the underlying writer, along with the
+// context it was written with.
+type bufferedList struct {
+	ctx  context.Context //nolint:containedctx
+	list *structpb.ListValue
+}
+
+// BufferedWriterOption is a function that will configure the buffered writer.
+type BufferedWriterOption func(*BufferedWriter)
+
+// WithBufferPolicy will set what the buffered writer does with a list when
+// its queue is full. The default is BufferPolicyBlock.
+func WithBufferPolicy(policy BufferPolicy) BufferedWriterOption {
+	return func(bw *BufferedWriter) {
+		bw.policy = policy
+	}
+}
+
+// WithDeadLetter will set the writer that lists dropped by BufferPolicyDrop
+// are written to, e.g. a local file to replay later. Without one, dropped
+// lists are only counted, see "BufferedWriter.Dropped".
+func WithDeadLetter(writer ListWriter) BufferedWriterOption {
+	return func(bw *BufferedWriter) {
+		bw.deadLetter = writer
+	}
+}
+
+// NewBufferedWriter will create a new BufferedWriter that queues up to size
+// lists for the writer. A size of less than 1 is treated as 1.
+func NewBufferedWriter(writer ListWriter, size int, opts ...BufferedWriterOption) *BufferedWriter {
+	if size < 1 {
+		size = 1
+	}
+
+	bw := &BufferedWriter{
+		writer: writer,
+		queue:  make(chan bufferedList, size),
+		done:   make(chan struct{}),
+		idle:   make(chan struct{}),
+	}
+
+	close(bw.idle)
+
+	for _, opt := range opts {
+		opt(bw)
+	}
+
+	go bw.run()
+
+	return bw
+}
+
+// run will write the queued lists to the underlying writer, in order, until
+// the queue is closed.
+func (bw *BufferedWriter) run() {
+	defer close(bw.done)
+
+	for queued := range bw.queue {
+		if err := bw.writer.Write(queued.ctx, queued.list); err != nil {
+			bw.errMtx.Lock()
+			bw.errs = append(bw.errs, err)
+			bw.errMtx.Unlock()
+		}
+
+		bw.removePending()
+	}
+}
+
+// addPending will count a list that is about to be queued.
+func (bw *BufferedWriter) addPending() {
+	bw.pendingMtx.Lock()
+	defer bw.pendingMtx.Unlock()
+
+	if bw.pending == 0 {
+		bw.idle = make(chan struct{})
+	}
+
+	bw.pending++
+}
+
+// removePending will count a list that has been written, or that could not be
+// queued.
+func (bw *BufferedWriter) removePending() {
+	bw.pendingMtx.Lock()
+	defer bw.pendingMtx.Unlock()
+
+	bw.pending--
+	if bw.pending == 0 {
+		close(bw.idle)
+	}
+}
+
+// idleChan will return a channel that is closed once no lists are queued or
+// being written.
+func (bw *BufferedWriter) idleChan() <-chan struct{} {
+	bw.pendingMtx.Lock()
+	defer bw.pendingMtx.Unlock()
+
+	return bw.idle
+}
+
+// Write will queue the list for the underlying writer. The list is copied, so
+// it can be modified once Write returns. The context's values, such as the run
+// ID and the ID fields, are passed on to the underlying writer, but its
+// cancellation is not, since the list is written after Write returns. If the
+// queue is full, then the list is handled according to the policy.
+func (bw *BufferedWriter) Write(ctx context.Context, list *structpb.ListValue) error {
+	bw.mtx.RLock()
+	defer bw.mtx.RUnlock()
+
+	if bw.closed {
+		return ErrBufferedWriterClosed
+	}
+
+	queued := bufferedList{
+		ctx:  context.WithoutCancel(ctx),
+		list: proto.Clone(list).(*structpb.ListValue), //nolint:forcetypeassert
+	}
+
+	bw.addPending()
+
+	if bw.policy == BufferPolicyDrop {
+		select {
+		case bw.queue <- queued:
+			return nil
+		default:
+			bw.removePending()
+
+			return bw.drop(ctx, queued.list)
+		}
+	}
+
+	select {
+	case bw.queue <- queued:
+		return nil
+	case <-ctx.Done():
+		bw.removePending()
+
+		return fmt.Errorf("failed to queue list: %w", ctx.Err())
+	}
+}
+
+// drop will count the dropped list and write it to the dead-letter writer, if
+// there is one.
+func (bw *BufferedWriter) drop(ctx context.Context, list *structpb.ListValue) error {
+	bw.dropped.Add(1)
+
+	if bw.deadLetter == nil {
+		return nil
+	}
+
+	if err := bw.deadLetter.Write(ctx, list); err != nil {
+		return fmt.Errorf("failed to write dropped list to dead letter: %w", err)
+	}
+
+	return nil
+}
+
+// Dropped will return the number of lists dropped because the queue was full.
+func (bw *BufferedWriter) Dropped() int64 {
+	return bw.dropped.Load()
+}
+
+// Flush will block until every queued list has been written, and then flush the
+// underlying writer if it implements the Flusher interface, returning the
+// errors of the underlying writer since the last flush. If the writer is shared
+// by concurrent runs, then Flush also waits for the lists of the other runs.
+func (bw *BufferedWriter) Flush(ctx context.Context) error {
+	select {
+	case <-bw.idleChan():
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush: %w", ctx.Err())
+	}
+
+	errs := bw.takeErrs()
+
+	if flusher, ok := bw.writer.(Flusher); ok {
+		if err := flusher.Flush(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Ping will ping the underlying writer, if it implements the Pinger interface.
+func (bw *BufferedWriter) Ping(ctx context.Context) error {
+	pinger, ok := bw.writer.(Pinger)
+	if !ok {
+		return nil
+	}
+
+	return pinger.Ping(ctx) //nolint:wrapcheck
+}
+
+// Close will write every queued list and stop the writer's goroutine,
+// returning any errors of the underlying writer that have not been returned by
+// "Flush". Writes after Close fail with an ErrBufferedWriterClosed error.
+func (bw *BufferedWriter) Close() error {
+	bw.mtx.Lock()
+
+	if bw.closed {
+		bw.mtx.Unlock()
+
+		return nil
+	}
+
+	bw.closed = true
+	close(bw.queue)
+	bw.mtx.Unlock()
+
+	<-bw.done
+
+	return errors.Join(bw.takeErrs()...)
+}
+
+// takeErrs will return the errors of the underlying writer that have not been
+// returned yet.
+func (bw *BufferedWriter) takeErrs() []error {
+	bw.errMtx.Lock()
+	defer bw.errMtx.Unlock()
+
+	errs := bw.errs
+	bw.errs = nil
+
+	return errs
+}
@@ -0,0 +1,343 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// gatedWriter is a ListWriter that signals each write as it starts, and then
+// blocks until the gate is opened.
+type gatedWriter struct {
+	mockListWriter
+
+	started chan struct{}
+	gate    chan struct{}
+}
+
+func newGatedWriter() *gatedWriter {
+	return &gatedWriter{
+		started: make(chan struct{}, 100),
+		gate:    make(chan struct{}),
+	}
+}
+
+func (g *gatedWriter) Write(ctx context.Context, list *structpb.ListValue) error {
+	g.started <- struct{}{}
+	<-g.gate
+
+	return g.mockListWriter.Write(ctx, list)
+}
+
+func TestBufferedWriter(t *testing.T) {
+	t.Parallel()
+
+	newList := func(id float64) *structpb.ListValue {
+		return &structpb.ListValue{Values: []*structpb.Value{structpb.NewNumberValue(id)}}
+	}
+
+	t.Run("drop to dead letter when full", func(t *testing.T) {
+		t.Parallel()
+
+		slow := newGatedWriter()
+		deadLetter := &mockListWriter{}
+
+		bw := NewBufferedWriter(slow, 1, WithBufferPolicy(BufferPolicyDrop), WithDeadLetter(deadLetter))
+		defer bw.Close()
+
+		ctx := context.Background()
+
+		// The first list is taken by the writer, the second fills the
+		// queue, and the third is dropped.
+		if err := bw.Write(ctx, newList(1)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+
+		<-slow.started
+
+		for _, id := range []float64{2, 3} {
+			if err := bw.Write(ctx, newList(id)); err != nil {
+				t.Fatalf("failed to write: %v", err)
+			}
+		}
+
+		if got := bw.Dropped(); got != 1 {
+			t.Errorf("expected 1 dropped list, got %d", got)
+		}
+
+		if deadLetter.count != 1 || string(deadLetter.data[0]) != "[3]" {
+			t.Errorf("expected the third list in the dead letter, got %q", deadLetter.data)
+		}
+
+		close(slow.gate)
+
+		if err := bw.Flush(ctx); err != nil {
+			t.Fatalf("failed to flush: %v", err)
+		}
+
+		if slow.count != 2 {
+			t.Errorf("expected 2 lists written, got %d", slow.count)
+		}
+	})
+
+	t.Run("block when full", func(t *testing.T) {
+		t.Parallel()
+
+		slow := newGatedWriter()
+
+		bw := NewBufferedWriter(slow, 1)
+		defer bw.Close()
+
+		if err := bw.Write(context.Background(), newList(1)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+
+		<-slow.started
+
+		if err := bw.Write(context.Background(), newList(2)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if err := bw.Write(ctx, newList(3)); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected a blocked write to time out, got %v", err)
+		}
+
+		close(slow.gate)
+
+		if err := bw.Close(); err != nil {
+			t.Fatalf("failed to close: %v", err)
+		}
+
+		if slow.count != 2 {
+			t.Errorf("expected 2 lists written, got %d", slow.count)
+		}
+
+		if err := bw.Write(context.Background(), newList(4)); !errors.Is(err, ErrBufferedWriterClosed) {
+			t.Errorf("expected %v, got %v", ErrBufferedWriterClosed, err)
+		}
+	})
+
+	t.Run("errors are returned by flush", func(t *testing.T) {
+		t.Parallel()
+
+		errWrite := errors.New("write failed")
+
+		bw := NewBufferedWriter(&mockErrWriter{err: errWrite}, 1)
+		defer bw.Close()
+
+		if err := bw.Write(context.Background(), newList(1)); err != nil {
+			t.Fatalf("expected the write to be queued, got %v", err)
+		}
+
+		if err := bw.Flush(context.Background()); !errors.Is(err, errWrite) {
+			t.Errorf("expected %v, got %v", errWrite, err)
+		}
+
+		if err := bw.Flush(context.Background()); err != nil {
+			t.Errorf("expected the error to be returned once, got %v", err)
+		}
+	})
+
+	t.Run("blocked writes with a failing writer", func(t *testing.T) {
+		t.Parallel()
+
+		errWrite := errors.New("write failed")
+
+		// Each write fails after a delay, so that the writes below
+		// block on the full queue while the errors are recorded.
+		bw := NewBufferedWriter(&slowErrWriter{delay: 10 * time.Millisecond, err: errWrite}, 1)
+		defer bw.Close()
+
+		written := make(chan error, 1)
+
+		go func() {
+			for id := 0; id < 4; id++ {
+				if err := bw.Write(context.Background(), newList(float64(id))); err != nil {
+					written <- err
+
+					return
+				}
+			}
+
+			written <- nil
+		}()
+
+		select {
+		case err := <-written:
+			if err != nil {
+				t.Fatalf("failed to write: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the writes to return")
+		}
+
+		if err := bw.Flush(context.Background()); !errors.Is(err, errWrite) {
+			t.Errorf("expected %v, got %v", errWrite, err)
+		}
+	})
+
+	t.Run("shared by concurrent runs", func(t *testing.T) {
+		t.Parallel()
+
+		writer := &mockListWriter{}
+
+		bw := NewBufferedWriter(writer, 1)
+		defer bw.Close()
+
+		const runs, writes = 8, 50
+
+		var wg sync.WaitGroup
+
+		// Each run writes its lists and then flushes, as a service
+		// does, while the other runs are still writing.
+		for run := 0; run < runs; run++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				for id := 0; id < writes; id++ {
+					if err := bw.Write(context.Background(), newList(float64(id))); err != nil {
+						t.Errorf("failed to write: %v", err)
+					}
+
+					if err := bw.Flush(context.Background()); err != nil {
+						t.Errorf("failed to flush: %v", err)
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if err := bw.Flush(context.Background()); err != nil {
+			t.Fatalf("failed to flush: %v", err)
+		}
+
+		if writer.count != runs*writes {
+			t.Errorf("expected %d lists written, got %d", runs*writes, writer.count)
+		}
+	})
+}
+
+// slowErrWriter is a ListWriter that fails every write after a delay.
+type slowErrWriter struct {
+	delay time.Duration
+	err   error
+}
+
+func (w *slowErrWriter) Write(context.Context, *structpb.ListValue) error {
+	time.Sleep(w.delay)
+
+	return w.err
+}
+
+func TestHTTPServiceBufferedWriter(t *testing.T) {
+	t.Parallel()
+
+	const pages = 5
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var page int
+
+		fmt.Sscan(r.URL.Query().Get("cursor"), &page) //nolint:errcheck
+
+		if page < pages-1 {
+			w.Header().Set("X-Next-Cursor", fmt.Sprint(page+1))
+		}
+
+		fmt.Fprintf(w, `[{"id":%d}]`, page)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Run("slow writer does not block", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		svc, err := NewService(ctx)
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		fast := &mockListWriter{}
+		slow := newGatedWriter()
+
+		bw := NewBufferedWriter(slow, pages)
+		defer bw.Close()
+
+		// The slow writer is held until the fast writer has every page,
+		// which is only possible if the fast writer is not held back.
+		go func() {
+			for {
+				fast.countMu.Lock()
+				count := fast.count
+				fast.countMu.Unlock()
+
+				if count == pages {
+					close(slow.gate)
+
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Millisecond):
+				}
+			}
+		}()
+
+		svc.HTTP.Requests(newTestServerRequest(t, server.URL,
+			WithWriters(fast, bw),
+			WithPagination(CursorPaginate("X-Next-Cursor", "cursor", WithCursorHeader()))))
+
+		if err := svc.HTTP.Store(ctx); err != nil {
+			t.Fatalf("failed to store: %v", err)
+		}
+
+		// Store flushes the buffered writer before it returns.
+		if slow.count != pages {
+			t.Errorf("expected %d lists written by the slow writer, got %d", pages, slow.count)
+		}
+	})
+
+	t.Run("flush error", func(t *testing.T) {
+		t.Parallel()
+
+		errWrite := errors.New("write failed")
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		bw := NewBufferedWriter(&mockErrWriter{err: errWrite}, pages)
+		defer bw.Close()
+
+		svc.HTTP.Requests(newTestServerRequest(t, server.URL, WithWriters(bw)))
+
+		if err := svc.HTTP.Store(context.Background()); !errors.Is(err, errWrite) {
+			t.Errorf("expected %v, got %v", errWrite, err)
+		}
+	})
+}
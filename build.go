@@ -0,0 +1,126 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrNoRequests is returned by Build when the HTTP Service has no requests.
+var ErrNoRequests = errors.New("no requests")
+
+// ErrInvalidRequest is returned by Build when a request cannot be made, e.g.
+// it has no URL.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// ErrInvalidRateLimiter is returned by Build when the rate limiter will never
+// allow a request.
+var ErrInvalidRateLimiter = errors.New("invalid rate limiter")
+
+// ErrInvalidOption is returned by Build when an option of the HTTP Service is
+// set to a value that is not allowed, e.g. a negative number of retries.
+var ErrInvalidOption = errors.New("invalid option")
+
+// Build will validate the configuration of the HTTP Service without making any
+// requests, e.g. to check a configuration in CI before running it. Every fatal
+// problem is returned, joined into a single error:
+//
+//   - there are no requests, and no channel to receive them from (ErrNoRequests);
+//   - a request is nil or has no URL (ErrInvalidRequest);
+//   - the rate limiter has a burst of zero, or a burst less than the cost of a
+//     request, and so never allows it (ErrInvalidRateLimiter);
+//   - a retry count, retry backoff, jitter, in-flight limit, request limit,
+//     write buffer, body size limit, or circuit breaker window or cooldown is
+//     negative (ErrInvalidOption);
+//   - a writer that implements Pinger cannot be reached.
+//
+// Problems that do not stop the service from running are logged as warnings
+// on the service's logger, if any, rather than returned:
+//
+//   - a request has no writers, so its data will be discarded by Store;
+//   - the rate limiter has a limit of zero, so it allows no more than its
+//     burst of requests.
+func (svc *HTTPService) Build(ctx context.Context) error {
+	if len(svc.requests) == 0 && svc.requestsChan == nil {
+		return ErrNoRequests
+	}
+
+	var errs []error
+
+	writers := []ListWriter{}
+
+	for idx, req := range svc.requests {
+		if req == nil || req.http == nil || req.http.URL == nil {
+			errs = append(errs, fmt.Errorf("%w: request %d has no URL", ErrInvalidRequest, idx))
+
+			continue
+		}
+
+		if len(req.writers) == 0 {
+			svc.warn(ctx, "request has no writers, its data will be discarded",
+				slog.String("url", req.http.URL.Redacted()))
+		}
+
+		// A burst of zero is reported once, for the rate limiter.
+		if rl := svc.rlimiter; rl != nil && rl.Limit() != rate.Inf && rl.Burst() > 0 &&
+			req.tokens() > rl.Burst() {
+			errs = append(errs, fmt.Errorf("%w: burst of %d does not allow request %d with a cost of %d",
+				ErrInvalidRateLimiter, rl.Burst(), idx, req.tokens()))
+		}
+
+		writers = append(writers, req.writers...)
+	}
+
+	if svc.rlimiter != nil {
+		if svc.rlimiter.Burst() < 1 && svc.rlimiter.Limit() != rate.Inf {
+			errs = append(errs, fmt.Errorf("%w: burst of %d does not allow a request",
+				ErrInvalidRateLimiter, svc.rlimiter.Burst()))
+		} else if svc.rlimiter.Limit() == 0 {
+			svc.warn(ctx, "rate limiter has a limit of zero, only its burst of requests will be made",
+				slog.Int("burst", svc.rlimiter.Burst()))
+		}
+	}
+
+	for _, opt := range []struct {
+		name     string
+		negative bool
+	}{
+		{name: "MaxRetries", negative: svc.maxRetries < 0},
+		{name: "RetryBackoff", negative: svc.retryBackoff < 0},
+		{name: "Jitter", negative: svc.jitter < 0},
+		{name: "MaxInFlight", negative: svc.maxInFlight < 0},
+		{name: "MaxRequests", negative: svc.maxRequests < 0},
+		{name: "WriteBuffer", negative: svc.writeBuffer < 0},
+		{name: "MaxBodyBytes", negative: svc.maxBodyBytes < 0},
+		{name: "CircuitBreaker", negative: svc.breaker != nil && (svc.breaker.window < 0 || svc.breaker.cooldown < 0)},
+	} {
+		if opt.negative {
+			errs = append(errs, fmt.Errorf("%w: %s is negative", ErrInvalidOption, opt.name))
+		}
+	}
+
+	if err := pingWriters(ctx, writers); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// warn will log a warning about the configuration of the service, if the
+// service has a logger.
+func (svc *HTTPService) warn(ctx context.Context, msg string, attrs ...slog.Attr) {
+	if logger := svc.logger(); logger != nil {
+		logger.LogAttrs(ctx, slog.LevelWarn, msg, attrs...)
+	}
+}
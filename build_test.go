@@ -0,0 +1,153 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+func TestHTTPServiceBuild(t *testing.T) {
+	t.Parallel()
+
+	errPing := errors.New("unreachable")
+
+	for _, tcase := range []struct {
+		name      string
+		noReqs    bool
+		reqs      []*Request
+		configure func(*HTTPService)
+		wantErrs  []error
+		wantWarn  string
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name:     "no requests",
+			noReqs:   true,
+			wantErrs: []error{ErrNoRequests},
+		},
+		{
+			name:     "nil request",
+			reqs:     []*Request{nil, NewHTTPRequest(nil)},
+			wantErrs: []error{ErrInvalidRequest},
+		},
+		{
+			name: "zero burst",
+			configure: func(svc *HTTPService) {
+				svc.RateLimiter(rate.NewLimiter(rate.Limit(1), 0))
+			},
+			wantErrs: []error{ErrInvalidRateLimiter},
+		},
+		{
+			name: "cost more than burst",
+			reqs: []*Request{
+				newTestServerRequest(t, "http://example", WithWriters(&mockListWriter{}), WithCost(3)),
+			},
+			configure: func(svc *HTTPService) {
+				svc.RateLimiter(rate.NewLimiter(rate.Limit(1), 2))
+			},
+			wantErrs: []error{ErrInvalidRateLimiter},
+		},
+		{
+			name: "zero burst with infinite limit",
+			configure: func(svc *HTTPService) {
+				svc.RateLimiter(rate.NewLimiter(rate.Inf, 0))
+			},
+		},
+		{
+			name: "zero limit is a warning",
+			configure: func(svc *HTTPService) {
+				svc.RateLimiter(rate.NewLimiter(0, 1))
+			},
+			wantWarn: "rate limiter has a limit of zero",
+		},
+		{
+			name: "negative options",
+			configure: func(svc *HTTPService) {
+				svc.MaxRetries(-1).MaxInFlight(-1)
+			},
+			wantErrs: []error{ErrInvalidOption},
+		},
+		{
+			name: "unreachable writer",
+			reqs: []*Request{
+				newTestServerRequest(t, "http://example", WithWriters(&mockPingWriter{pingErr: errPing})),
+			},
+			wantErrs: []error{errPing},
+		},
+		{
+			name:     "every problem is returned",
+			reqs:     []*Request{nil, newTestServerRequest(t, "http://example")},
+			wantErrs: []error{ErrInvalidRequest, ErrInvalidOption},
+			configure: func(svc *HTTPService) {
+				svc.Jitter(-1)
+			},
+			wantWarn: "request has no writers",
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := &bytes.Buffer{}
+			logger := slog.New(slog.NewJSONHandler(buf, nil))
+
+			svc, err := NewService(context.Background(), WithLogger(logger))
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			reqs := tcase.reqs
+			if reqs == nil && !tcase.noReqs {
+				reqs = []*Request{newTestServerRequest(t, "http://example", WithWriters(&mockListWriter{}))}
+			}
+
+			svc.HTTP.Requests(reqs...)
+
+			if tcase.configure != nil {
+				tcase.configure(svc.HTTP)
+			}
+
+			err = svc.HTTP.Build(context.Background())
+			if len(tcase.wantErrs) == 0 && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, want := range tcase.wantErrs {
+				if !errors.Is(err, want) {
+					t.Errorf("expected error %v, got %v", want, err)
+				}
+			}
+
+			logs := buf.String()
+
+			if tcase.wantWarn == "" && strings.Contains(logs, `"level":"WARN"`) {
+				t.Errorf("expected no warnings, got %s", logs)
+			}
+
+			if !strings.Contains(logs, tcase.wantWarn) {
+				t.Errorf("expected warning %q, got %s", tcase.wantWarn, logs)
+			}
+
+			// Build must not make any requests.
+			if got := svc.HTTP.Result().Requests; got != 0 {
+				t.Errorf("expected no requests, got %d", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// captureDirPerm is the permission of a capture directory created by
+	// the HTTP Service.
+	captureDirPerm = 0o755
+
+	// captureFilePerm is the permission of a capture file. Captures may
+	// hold sensitive data, so only the owner can read them.
+	captureFilePerm = 0o600
+)
+
+// CaptureFailuresTo sets a directory that a response is captured to when it
+// cannot be decoded or written, so that the body that caused an error such as
+// "proto: syntax error" can be inspected. Each capture is a pair of files named
+// by the run ID and a sequence number: "<name>.body" is the raw response body,
+// and "<name>.json" is the error along with the method, URL, and status of the
+// request and the headers of the request and response. Responses are only
+// captured on failure, so there is no I/O when every response is stored.
+//
+// The values of the "Authorization" and "Proxy-Authorization" headers, and of
+// any headers given to redact, are replaced in the capture, as they are in the
+// logs. The directory is created if it does not exist. A failure to capture a
+// response is logged rather than returned, so that it does not hide the error
+// that caused it.
+func (svc *HTTPService) CaptureFailuresTo(dir string, redact ...string) *HTTPService {
+	svc.capturer = &failureCapturer{dir: dir, redact: redact}
+
+	return svc
+}
+
+// failureCapturer writes the responses that could not be stored to a
+// directory.
+type failureCapturer struct {
+	dir    string
+	redact []string
+	seq    atomic.Int64
+}
+
+// failureCapture is the metadata of a captured response.
+type failureCapture struct {
+	Time           time.Time   `json:"time"`
+	Error          string      `json:"error"`
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	Status         int         `json:"status"`
+	RequestHeader  http.Header `json:"requestHeader"`
+	ResponseHeader http.Header `json:"responseHeader"`
+	Body           string      `json:"body"` // name of the body file
+}
+
+// capturedResponse is a response that is captured if it cannot be stored.
+type capturedResponse struct {
+	capturer *failureCapturer
+	rsp      *http.Response
+	data     []byte
+	url      string
+	clock    clock
+	logger   *slog.Logger
+}
+
+// newCapturedResponse will return the response to capture on failure, or nil
+// if the service does not capture failures.
+func (svc *HTTPService) newCapturedResponse(current *Current) *capturedResponse {
+	if svc.capturer == nil || current.Response == nil {
+		return nil
+	}
+
+	return &capturedResponse{
+		capturer: svc.capturer,
+		rsp:      current.Response,
+		data:     current.Data,
+		url:      current.req.http.URL.Redacted(),
+		clock:    svc.clock(),
+		logger:   svc.logger(),
+	}
+}
+
+// capture will write the response and the error that caused it to fail to the
+// capture directory, logging the outcome. It is a no-op if there is no response
+// to capture.
+func (cr *capturedResponse) capture(ctx context.Context, cause error) {
+	if cr == nil {
+		return
+	}
+
+	path, err := cr.write(ctx, cause)
+
+	if cr.logger == nil {
+		return
+	}
+
+	if err != nil {
+		cr.logger.LogAttrs(ctx, slog.LevelWarn, "failed to capture response",
+			slog.String("url", cr.url),
+			slog.String("error", err.Error()))
+
+		return
+	}
+
+	cr.logger.LogAttrs(ctx, slog.LevelInfo, "captured failed response",
+		slog.String("url", cr.url),
+		slog.String("path", path))
+}
+
+// write will write the capture files, returning the path of the metadata file.
+func (cr *capturedResponse) write(ctx context.Context, cause error) (string, error) {
+	dir := cr.capturer.dir
+
+	if err := os.MkdirAll(dir, captureDirPerm); err != nil {
+		return "", fmt.Errorf("failed to create capture directory: %w", err)
+	}
+
+	name := fmt.Sprintf("failure-%04d", cr.capturer.seq.Add(1))
+	if runID, ok := RunIDFromContext(ctx); ok {
+		name = runID + "-" + name
+	}
+
+	bodyName := name + ".body"
+
+	if err := os.WriteFile(filepath.Join(dir, bodyName), cr.data, captureFilePerm); err != nil {
+		return "", fmt.Errorf("failed to write captured body: %w", err)
+	}
+
+	meta := failureCapture{
+		Time:           cr.clock.Now(),
+		Error:          cause.Error(),
+		Status:         cr.rsp.StatusCode,
+		ResponseHeader: redactHeader(cr.rsp.Header, cr.capturer.redact...),
+		Body:           bodyName,
+	}
+
+	if req := cr.rsp.Request; req != nil {
+		meta.Method = req.Method
+		meta.URL = req.URL.Redacted()
+		meta.RequestHeader = redactHeader(req.Header, cr.capturer.redact...)
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode capture: %w", err)
+	}
+
+	path := filepath.Join(dir, name+".json")
+
+	if err := os.WriteFile(path, data, captureFilePerm); err != nil {
+		return "", fmt.Errorf("failed to write capture: %w", err)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHTTPServiceCaptureFailures(t *testing.T) {
+	t.Parallel()
+
+	const body = `[{"id":1},`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Session", "secret")
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	dir := filepath.Join(t.TempDir(), "failures")
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	svc.HTTP.
+		CaptureFailuresTo(dir, "x-session").
+		Requests(newTestServerRequest(t, server.URL+"/products", WithWriters(&mockListWriter{}),
+			WithHeaders(http.Header{"Authorization": []string{"Bearer token"}})))
+
+	if err := svc.HTTP.Store(context.Background()); err == nil {
+		t.Fatalf("expected an error decoding the response")
+	}
+
+	captures, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(captures) != 1 {
+		t.Fatalf("expected 1 capture, got %v (%v)", captures, err)
+	}
+
+	data, err := os.ReadFile(captures[0])
+	if err != nil {
+		t.Fatalf("failed to read capture: %v", err)
+	}
+
+	var capture failureCapture
+	if err := json.Unmarshal(data, &capture); err != nil {
+		t.Fatalf("failed to decode capture: %v", err)
+	}
+
+	if capture.Error == "" || capture.Status != http.StatusOK || capture.Method != http.MethodGet ||
+		capture.URL != server.URL+"/products" {
+		t.Errorf("unexpected capture metadata: %s", data)
+	}
+
+	if got := capture.RequestHeader.Get("Authorization"); got != redacted {
+		t.Errorf("expected the authorization header to be redacted, got %q", got)
+	}
+
+	if got := capture.ResponseHeader.Get("X-Session"); got != redacted {
+		t.Errorf("expected the configured header to be redacted, got %q", got)
+	}
+
+	captured, err := os.ReadFile(filepath.Join(dir, capture.Body))
+	if err != nil {
+		t.Fatalf("failed to read captured body: %v", err)
+	}
+
+	if string(captured) != body {
+		t.Errorf("expected captured body %q, got %q", body, captured)
+	}
+}
+
+func TestHTTPServiceCaptureFailuresOnlyOnFailure(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id":1}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	dir := filepath.Join(t.TempDir(), "failures")
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	svc.HTTP.
+		CaptureFailuresTo(dir).
+		Requests(newTestServerRequest(t, server.URL, WithWriters(&mockListWriter{})))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected no capture directory, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// CheckpointStore records which requests of a run have completed, so that a
+// run that fails part way through can be resumed without repeating the
+// requests that have already been stored.
+type CheckpointStore interface {
+	// Mark records that the request identified by the key has completed.
+	Mark(ctx context.Context, key string) error
+
+	// IsDone reports whether the request identified by the key has
+	// completed.
+	IsDone(ctx context.Context, key string) (bool, error)
+
+	// Done is called once every request in a run has completed. It
+	// should clear the recorded keys so that the next run starts from
+	// scratch.
+	Done(ctx context.Context) error
+}
+
+// checkpointKey will return the key used to identify a request in a
+// checkpoint store.
+func checkpointKey(req *http.Request) string {
+	return req.Method + " " + req.URL.String()
+}
+
+// Checkpoint sets the store used to record the requests that have completed
+// during a call to "Store". Requests already marked as done in the store are
+// skipped. A request is marked only after its data has been written to every
+// list writer, so a failure between writing and marking will cause the
+// request to be repeated rather than lost. A paginated request is marked once
+// the data of its last page has been written, and only if every one of its
+// pages was written, so a request with a page that failed is repeated from its
+// first page. A request whose last response has no data to write, e.g. because
+// it was skipped by a response interceptor or has an expected status with no
+// data, see WithExpectStatus, is marked once its earlier pages are written.
+// Once every request has completed, the checkpoints are cleared.
+func (svc *HTTPService) Checkpoint(store CheckpointStore) *HTTPService {
+	svc.checkpoint = store
+
+	return svc
+}
+
+// pendingRequests will return the requests that have not been marked as done
+// in the checkpoint store. Each request is tagged with its key, so that it can
+// be marked once its last page is stored.
+func (svc *HTTPService) pendingRequests(ctx context.Context) ([]*Request, error) {
+	if svc.checkpoint == nil {
+		return svc.requests, nil
+	}
+
+	pending := make([]*Request, 0, len(svc.requests))
+
+	for _, req := range svc.requests {
+		done, err := svc.checkpoint.IsDone(ctx, checkpointKey(req.http))
+		if err != nil {
+			return nil, fmt.Errorf("failed to check checkpoint: %w", err)
+		}
+
+		if !done {
+			tagged := *req
+			tagged.checkpointKey = checkpointKey(req.http)
+
+			pending = append(pending, &tagged)
+		}
+	}
+
+	return pending, nil
+}
+
+// FileCheckpointStore is a CheckpointStore that persists the keys of
+// completed requests to a JSON file.
+type FileCheckpointStore struct {
+	path string
+
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+// NewFileCheckpointStore will create a checkpoint store backed by the JSON
+// file at the given path. If the file exists, the checkpoints of the previous
+// run are loaded from it.
+func NewFileCheckpointStore(path string) (*FileCheckpointStore, error) {
+	store := &FileCheckpointStore{path: path, keys: make(map[string]struct{})}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint file: %w", err)
+	}
+
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint file: %w", err)
+	}
+
+	for _, key := range keys {
+		store.keys[key] = struct{}{}
+	}
+
+	return store, nil
+}
+
+// Mark will record the key and persist every recorded key to the file.
+func (store *FileCheckpointStore) Mark(_ context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.keys[key] = struct{}{}
+
+	return store.flush()
+}
+
+// IsDone reports whether the key has been recorded.
+func (store *FileCheckpointStore) IsDone(_ context.Context, key string) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	_, ok := store.keys[key]
+
+	return ok, nil
+}
+
+// Done will clear the recorded keys and remove the file.
+func (store *FileCheckpointStore) Done(context.Context) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.keys = make(map[string]struct{})
+
+	if err := os.Remove(store.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove checkpoint file: %w", err)
+	}
+
+	return nil
+}
+
+// flush will atomically write the recorded keys to the file, by writing to a
+// temporary file and renaming it.
+func (store *FileCheckpointStore) flush() error {
+	keys := make([]string, 0, len(store.keys))
+	for key := range store.keys {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoints: %w", err)
+	}
+
+	return writeFileAtomic(store.path, data, "checkpoint")
+}
+
+// writeFileAtomic will write the data to the file at the path by writing to a
+// temporary file and renaming it, so that the file is never partly written.
+// The errors name the kind of file.
+func writeFileAtomic(path string, data []byte, kind string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create %s file: %w", kind, err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("failed to write %s file: %w", kind, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s file: %w", kind, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s file: %w", kind, err)
+	}
+
+	return nil
+}
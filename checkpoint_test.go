@@ -0,0 +1,410 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestFileCheckpointStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+
+	store, err := NewFileCheckpointStore(path)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	if err := store.Mark(ctx, "GET http://example0"); err != nil {
+		t.Fatalf("failed to mark: %v", err)
+	}
+
+	// Reload the store from the file to simulate a restart.
+	store, err = NewFileCheckpointStore(path)
+	if err != nil {
+		t.Fatalf("failed to reload store: %v", err)
+	}
+
+	for key, want := range map[string]bool{
+		"GET http://example0": true,
+		"GET http://example1": false,
+	} {
+		got, err := store.IsDone(ctx, key)
+		if err != nil {
+			t.Fatalf("failed to check %q: %v", key, err)
+		}
+
+		if got != want {
+			t.Errorf("expected IsDone(%q) to be %v, got %v", key, want, got)
+		}
+	}
+
+	if err := store.Done(ctx); err != nil {
+		t.Fatalf("failed to clear store: %v", err)
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected checkpoint file to be removed, got %v", err)
+	}
+}
+
+func TestHTTPServiceCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	svc, err := NewService(ctx)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+
+	store, err := NewFileCheckpointStore(path)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	writer := &mockUpsertWriter{}
+
+	reqs := newHTTPRequests(3)
+	for _, req := range reqs {
+		req.writers = []ListWriter{writer}
+	}
+
+	// Mark the first request as completed by a previous run.
+	if err := store.Mark(ctx, checkpointKey(reqs[0].http)); err != nil {
+		t.Fatalf("failed to mark: %v", err)
+	}
+
+	client := newMockHTTPClient(withMockHTTPClientRequests(reqs...))
+
+	svc.HTTP.Requests(reqs...).Checkpoint(store)
+	svc.HTTP.client = client
+
+	if err := svc.HTTP.Store(ctx); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	for _, call := range client.calls {
+		if call.URL.String() == reqs[0].http.URL.String() {
+			t.Error("expected the completed request to be skipped")
+		}
+	}
+
+	if writer.count != len(reqs)-1 {
+		t.Errorf("expected %d writes, got %d", len(reqs)-1, writer.count)
+	}
+
+	// The run completed, so the checkpoints should be cleared.
+	done, err := store.IsDone(ctx, checkpointKey(reqs[0].http))
+	if err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+
+	if done {
+		t.Error("expected the checkpoints to be cleared after a complete run")
+	}
+}
+
+func TestHTTPServiceCheckpointFailedWrite(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	svc, err := NewService(ctx)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	store, err := NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	reqs := newHTTPRequests(2)
+	reqs[1].writers = []ListWriter{&mockErrWriter{err: errWriteFailed}}
+
+	svc.HTTP.Requests(reqs...).Checkpoint(store)
+	svc.HTTP.client = newMockHTTPClient(withMockHTTPClientRequests(reqs...))
+
+	if err := svc.HTTP.Store(ctx); !errors.Is(err, errWriteFailed) {
+		t.Fatalf("expected error %v, got %v", errWriteFailed, err)
+	}
+
+	// A request whose data was not written must not be marked.
+	done, err := store.IsDone(ctx, checkpointKey(reqs[1].http))
+	if err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+
+	if done {
+		t.Error("expected the failed request not to be marked")
+	}
+}
+
+// pageWriter is a ListWriter that records the "page" field of each record,
+// failing to write the records of failPage.
+type pageWriter struct {
+	mtx      sync.Mutex
+	failPage float64
+	pages    []float64
+}
+
+func (w *pageWriter) Write(_ context.Context, list *structpb.ListValue) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	for _, value := range list.GetValues() {
+		page := value.GetStructValue().GetFields()["page"].GetNumberValue()
+		if page == w.failPage {
+			return errWriteFailed
+		}
+
+		w.pages = append(w.pages, page)
+	}
+
+	return nil
+}
+
+func TestHTTPServiceCheckpointPagination(t *testing.T) {
+	t.Parallel()
+
+	const pages = 3
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		if page == 0 {
+			page = 1
+		}
+
+		if page < pages {
+			w.Header().Set("X-Next-Cursor", strconv.Itoa(page+1))
+		}
+
+		fmt.Fprintf(w, `{"page":%d}`, page)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+
+	run := func(failPage float64) ([]float64, error) {
+		t.Helper()
+
+		store, err := NewFileCheckpointStore(path)
+		if err != nil {
+			t.Fatalf("failed to create store: %v", err)
+		}
+
+		svc, err := NewService(ctx)
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		writer := &pageWriter{failPage: failPage}
+
+		svc.HTTP.Checkpoint(store).Requests(newTestServerRequest(t, server.URL, WithWriters(writer),
+			WithPagination(CursorPaginate("X-Next-Cursor", "cursor", WithCursorHeader()))))
+
+		err = svc.HTTP.Store(ctx)
+
+		sort.Float64s(writer.pages)
+
+		return writer.pages, err
+	}
+
+	// The middle page fails to be written, so the request must not be
+	// marked as done, even though the pages after it are written.
+	got, err := run(2)
+	if !errors.Is(err, errWriteFailed) {
+		t.Fatalf("expected error %v, got %v", errWriteFailed, err)
+	}
+
+	if want := []float64{1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected pages %v, got %v", want, got)
+	}
+
+	// The resumed run repeats the request, so that the failed page is
+	// written.
+	got, err = run(0)
+	if err != nil {
+		t.Fatalf("failed to resume: %v", err)
+	}
+
+	if want := []float64{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected pages %v, got %v", want, got)
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the checkpoints to be cleared, got %v", err)
+	}
+}
+
+func TestHTTPServiceCheckpointServerSentEvents(t *testing.T) {
+	t.Parallel()
+
+	var streams atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events" {
+			fmt.Fprint(w, `{"page":1}`)
+
+			return
+		}
+
+		streams.Add(1)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"page\":2}\n\n")
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+
+	run := func(failPage float64) error {
+		t.Helper()
+
+		store, err := NewFileCheckpointStore(path)
+		if err != nil {
+			t.Fatalf("failed to create store: %v", err)
+		}
+
+		svc, err := NewService(ctx)
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		writer := &pageWriter{failPage: failPage}
+
+		svc.HTTP.Checkpoint(store).Requests(
+			newTestServerRequest(t, server.URL, WithWriters(writer)),
+			newTestServerRequest(t, server.URL+"/events", WithWriters(&mockListWriter{}), WithServerSentEvents()))
+
+		return svc.HTTP.Store(ctx)
+	}
+
+	if err := run(1); !errors.Is(err, errWriteFailed) {
+		t.Fatalf("expected error %v, got %v", errWriteFailed, err)
+	}
+
+	// A stream has no end to resume from, so the resumed run makes it
+	// again along with the failed request.
+	if err := run(0); err != nil {
+		t.Fatalf("failed to resume: %v", err)
+	}
+
+	if got := streams.Load(); got != 2 {
+		t.Errorf("expected the stream to be made by both runs, got %d", got)
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the checkpoints to be cleared, got %v", err)
+	}
+}
+
+func TestHTTPServiceCheckpointNoData(t *testing.T) {
+	t.Parallel()
+
+	var mtx sync.Mutex
+
+	calls := map[string]int{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		calls[r.URL.Path]++
+		mtx.Unlock()
+
+		switch r.URL.Path {
+		case "/skipped":
+			w.WriteHeader(http.StatusGone)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			fmt.Fprint(w, `{"page":1}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+
+	skipGone := func(rsp *http.Response) error {
+		if rsp.StatusCode == http.StatusGone {
+			return ErrSkipResponse
+		}
+
+		return nil
+	}
+
+	run := func(failPage float64) error {
+		t.Helper()
+
+		store, err := NewFileCheckpointStore(path)
+		if err != nil {
+			t.Fatalf("failed to create store: %v", err)
+		}
+
+		svc, err := NewService(ctx)
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		writer := &pageWriter{failPage: failPage}
+
+		svc.HTTP.Checkpoint(store).ResponseInterceptors(skipGone).Requests(
+			newTestServerRequest(t, server.URL, WithWriters(writer)),
+			newTestServerRequest(t, server.URL+"/skipped", WithWriters(writer)),
+			newTestServerRequest(t, server.URL+"/missing", WithWriters(writer),
+				WithExpectStatus(http.StatusNotFound)))
+
+		return svc.HTTP.Store(ctx)
+	}
+
+	if err := run(1); !errors.Is(err, errWriteFailed) {
+		t.Fatalf("expected error %v, got %v", errWriteFailed, err)
+	}
+
+	// The requests whose responses had no data to write completed, so the
+	// resumed run only repeats the failed request.
+	if err := run(0); err != nil {
+		t.Fatalf("failed to resume: %v", err)
+	}
+
+	want := map[string]int{"/": 2, "/skipped": 1, "/missing": 1}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("expected requests %v, got %v", want, calls)
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the checkpoints to be cleared, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"time"
+)
+
+// clock is the source of time for the services. Every wait made by a service,
+// e.g. for the rate limiter, a retry backoff, or jitter, goes through the clock
+// so that tests can control the passage of time.
+type clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// Sleep blocks until the duration has elapsed, returning early with
+	// the context's error if it is canceled.
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// realClock is the clock backed by the "time" package.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// withClock will set the source of time for the service, which defaults to
+// the real time.
+func withClock(clk clock) ServiceOption {
+	return func(svc *Service) {
+		svc.clock = clk
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// fakeClock is a clock whose time only moves when it is slept on. Every sleep
+// returns immediately, advancing the time by the duration and recording it.
+type fakeClock struct {
+	mtx    sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (clk *fakeClock) Now() time.Time {
+	clk.mtx.Lock()
+	defer clk.mtx.Unlock()
+
+	return clk.now
+}
+
+func (clk *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	clk.advance(d)
+
+	return nil
+}
+
+func (clk *fakeClock) advance(d time.Duration) {
+	clk.mtx.Lock()
+	defer clk.mtx.Unlock()
+
+	clk.now = clk.now.Add(d)
+	clk.sleeps = append(clk.sleeps, d)
+}
+
+// slept will return the durations slept on the clock, in order.
+func (clk *fakeClock) slept() []time.Duration {
+	clk.mtx.Lock()
+	defer clk.mtx.Unlock()
+
+	return append([]time.Duration(nil), clk.sleeps...)
+}
+
+func TestHTTPServiceClock(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name       string
+		failures   int32
+		maxRetries int
+		backoff    time.Duration
+		rlimiter   *rate.Limiter
+		wantErr    error
+		wantSleeps []time.Duration
+	}{
+		{
+			name:       "no retries",
+			backoff:    time.Second,
+			wantSleeps: nil,
+		},
+		{
+			name:       "exponential backoff",
+			failures:   3,
+			maxRetries: 3,
+			backoff:    time.Second,
+			wantSleeps: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			name:       "backoff is capped",
+			failures:   2,
+			maxRetries: 2,
+			backoff:    20 * time.Second,
+			wantSleeps: []time.Duration{20 * time.Second, maxRetryBackoff},
+		},
+		{
+			name:       "retries exhausted",
+			failures:   5,
+			maxRetries: 2,
+			backoff:    time.Second,
+			wantErr:    ErrBadResponse,
+			wantSleeps: []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			// The wait is the larger of the backoff and the limiter's
+			// delay, which is measured from the clock's time.
+			name:       "rate limiter overlaps backoff",
+			failures:   3,
+			maxRetries: 3,
+			backoff:    time.Second,
+			rlimiter:   rate.NewLimiter(rate.Every(3*time.Second), 1),
+			wantSleeps: []time.Duration{3 * time.Second, 3 * time.Second, 4 * time.Second},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			server, _ := newFlakyServer(t, tcase.failures, http.StatusServiceUnavailable, "")
+
+			clk := newFakeClock()
+
+			svc, err := NewService(context.Background(), withClock(clk))
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			svc.HTTP.
+				RateLimiter(tcase.rlimiter).
+				MaxRetries(tcase.maxRetries).
+				RetryBackoff(tcase.backoff).
+				Requests(newTestServerRequest(t, server.URL))
+
+			err = svc.HTTP.Store(context.Background())
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+
+			if got := clk.slept(); !reflect.DeepEqual(got, tcase.wantSleeps) {
+				t.Errorf("expected sleeps %v, got %v", tcase.wantSleeps, got)
+			}
+		})
+	}
+}
+
+func TestSleepJitterClock(t *testing.T) {
+	t.Parallel()
+
+	const maxJitter = time.Second
+
+	clk := newFakeClock()
+
+	for i := 0; i < 100; i++ {
+		if err := sleepJitter(context.Background(), clk, maxJitter); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	for _, d := range clk.slept() {
+		if d < 0 || d >= maxJitter {
+			t.Fatalf("expected jitter in [0, %v), got %v", maxJitter, d)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DisableCompression will stop the HTTP Service from asking for compressed
+// responses. By default, every request without an "Accept-Encoding" header
+// asks for "gzip", and a gzip response is decompressed before it is decoded,
+// whatever the client: the transport of "net/http" only does this for the
+// requests that it sets the header on itself, which a custom client or
+// transport may not. When compression is disabled, such requests ask for
+// "identity" instead, so that the transport does not ask for gzip either.
+//
+// A response is decompressed as it is read, so the limit set with
+// "MaxBodyBytes", and the bytes counted by "Result", are of the decompressed
+// body.
+func (svc *HTTPService) DisableCompression(disable bool) *HTTPService {
+	svc.disableCompression = disable
+
+	return svc
+}
+
+// acceptEncoding will set the "Accept-Encoding" header of the request, if it
+// has none.
+func acceptEncoding(req *http.Request, disable bool) {
+	if req.Header.Get("Accept-Encoding") != "" {
+		return
+	}
+
+	if disable {
+		req.Header.Set("Accept-Encoding", "identity")
+	} else {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+}
+
+// decompressResponse will replace the body of a gzip response with one that
+// decompresses it, removing the headers that describe the compressed body, in
+// the same way as the transport of "net/http".
+func decompressResponse(rsp *http.Response) {
+	if rsp.Uncompressed || !strings.EqualFold(rsp.Header.Get("Content-Encoding"), "gzip") {
+		return
+	}
+
+	rsp.Body = &gzipBody{body: rsp.Body}
+	rsp.Header.Del("Content-Encoding")
+	rsp.Header.Del("Content-Length")
+	rsp.ContentLength = -1
+	rsp.Uncompressed = true
+}
+
+// gzipBody is a response body that is decompressed as it is read. The gzip
+// reader is created on the first read, since creating it reads the header of
+// the body.
+type gzipBody struct {
+	body   io.ReadCloser
+	reader *gzip.Reader
+	err    error
+}
+
+// Read will read the decompressed body.
+func (gb *gzipBody) Read(buf []byte) (int, error) {
+	if gb.err != nil {
+		return 0, gb.err
+	}
+
+	if gb.reader == nil {
+		reader, err := gzip.NewReader(gb.body)
+		if err != nil {
+			gb.err = fmt.Errorf("failed to decompress response body: %w", err)
+
+			return 0, gb.err
+		}
+
+		gb.reader = reader
+	}
+
+	n, err := gb.reader.Read(buf)
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = fmt.Errorf("failed to decompress response body: %w", err)
+	}
+
+	return n, err
+}
+
+// Close will close the underlying body.
+func (gb *gzipBody) Close() error {
+	return gb.body.Close() //nolint:wrapcheck
+}
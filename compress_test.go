@@ -0,0 +1,109 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestHTTPServiceStoreCompression(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name        string
+		client      Client
+		disable     bool
+		wantGzipped bool
+	}{
+		{name: "owned client", wantGzipped: true},
+		{
+			name:        "custom transport",
+			client:      &http.Client{Transport: &http.Transport{DisableCompression: true}},
+			wantGzipped: true,
+		},
+		{name: "disabled", disable: true, wantGzipped: false},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gzipped atomic.Bool
+
+			// The server only compresses the response if the
+			// client asks for gzip.
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body := fmt.Sprintf(`[{"id":1,"data":%q}]`, strings.Repeat("a", 1024))
+
+				if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+					fmt.Fprint(w, body)
+
+					return
+				}
+
+				gzipped.Store(true)
+				w.Header().Set("Content-Encoding", "gzip")
+
+				zw := gzip.NewWriter(w)
+				fmt.Fprint(zw, body)
+				zw.Close()
+			}))
+			t.Cleanup(server.Close)
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			if tcase.client != nil {
+				svc.HTTP.Client(tcase.client)
+			}
+
+			writer := &mockListWriter{}
+
+			svc.HTTP.DisableCompression(tcase.disable).
+				Requests(newTestServerRequest(t, server.URL, WithWriters(writer)))
+
+			if err := svc.HTTP.Store(context.Background()); err != nil {
+				t.Fatalf("failed to store: %v", err)
+			}
+
+			if got := gzipped.Load(); got != tcase.wantGzipped {
+				t.Errorf("expected gzipped response %v, got %v", tcase.wantGzipped, got)
+			}
+
+			if len(writer.data) != 1 {
+				t.Fatalf("expected 1 write, got %d", len(writer.data))
+			}
+
+			list := &structpb.ListValue{}
+			if err := list.UnmarshalJSON(writer.data[0]); err != nil {
+				t.Fatalf("failed to unmarshal written data: %v", err)
+			}
+
+			want := []interface{}{
+				map[string]interface{}{"id": 1.0, "data": strings.Repeat("a", 1024)},
+			}
+
+			if got := list.AsSlice(); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected records %v, got %v", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidConfig is returned when a config cannot be loaded, e.g. because
+// it is not valid YAML or JSON or has an unknown field.
+var ErrInvalidConfig = errors.New("invalid config")
+
+// ErrUnknownWriter is returned when a config refers to a writer by a name that
+// was not given to LoadConfig.
+var ErrUnknownWriter = errors.New("unknown writer")
+
+// Config is the YAML or JSON configuration of an HTTP Service, see LoadConfig:
+//
+//	url: https://api.pro.coinbase.com
+//	rateLimit:
+//	  burst: 5
+//	  period: 1s
+//	writers: [mongo]
+//	requests:
+//	  - endpoint: /products
+//	  - endpoint: /currencies
+//	    writers: [mongo, csv]
+//
+// or, equivalently:
+//
+//	{
+//	  "url": "https://api.pro.coinbase.com",
+//	  "rateLimit": {"burst": 5, "period": "1s"},
+//	  "writers": ["mongo"],
+//	  "requests": [
+//	    {"endpoint": "/products"},
+//	    {"endpoint": "/currencies", "writers": ["mongo", "csv"]}
+//	  ]
+//	}
+type Config struct {
+	// URL is the base URL that the endpoints of the requests are relative
+	// to. It is optional if every endpoint is an absolute URL.
+	URL string `json:"url" yaml:"url"`
+
+	// RateLimit is the optional rate limit of the service.
+	RateLimit *RateLimitConfig `json:"rateLimit" yaml:"rateLimit"`
+
+	// Writers are the names of the writers of any request that does not
+	// name its own.
+	Writers []string `json:"writers" yaml:"writers"`
+
+	// Requests are the requests made by the service.
+	Requests []RequestConfig `json:"requests" yaml:"requests"`
+}
+
+// RateLimitConfig is the configuration of a rate limiter that allows a burst
+// of requests per period.
+type RateLimitConfig struct {
+	// Burst is the number of requests allowed per period.
+	Burst int `json:"burst" yaml:"burst"`
+
+	// Period is the period of the rate limit as a duration string, e.g.
+	// "1s" or "500ms".
+	Period string `json:"period" yaml:"period"`
+}
+
+// RequestConfig is the configuration of a single request.
+type RequestConfig struct {
+	// Endpoint is the path of the request, relative to the config's URL,
+	// or an absolute URL. It may include a query.
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+
+	// Method is the HTTP method of the request, "GET" by default.
+	Method string `json:"method" yaml:"method"`
+
+	// Query are query parameters added to the endpoint's query.
+	Query map[string]string `json:"query" yaml:"query"`
+
+	// Headers are set on the request, see WithHeaders.
+	Headers map[string]string `json:"headers" yaml:"headers"`
+
+	// Body is the optional body of the request.
+	Body string `json:"body" yaml:"body"`
+
+	// Writers are the names of the request's writers. If there are none,
+	// then the config's writers are used.
+	Writers []string `json:"writers" yaml:"writers"`
+
+	// Vars expand the request into one request per set of variables, by
+	// substituting them into the "{name}" placeholders of the endpoint,
+	// see ExpandRequests.
+	Vars []map[string]string `json:"vars" yaml:"vars"`
+}
+
+// LoadConfig will create an HTTP Service from a YAML or JSON Config, see the
+// "LoadConfig" method of HTTPService. Since it is given no writers, a config
+// that names any writers is an ErrUnknownWriter error; use the method to
+// resolve the names to writers instead.
+func LoadConfig(r io.Reader) (*HTTPService, error) {
+	ctx := context.Background()
+
+	svc, err := NewService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := svc.HTTP.LoadConfig(ctx, r, nil); err != nil {
+		return nil, err
+	}
+
+	return svc.HTTP, nil
+}
+
+// LoadConfig will configure the HTTP Service from a YAML or JSON Config,
+// adding its requests and setting its rate limiter, for the config-file
+// workflow. A config whose first character is "{" is read as JSON, and any
+// other config as YAML. The writers of a request are given by name, and the
+// names are resolved using the writers map, since storage connections cannot
+// be created from a config by this package. Unknown fields are an
+// ErrInvalidConfig error so that typos are not ignored. The requests are validated as they are loaded: a config with no
+// requests is an ErrNoRequests error, a request with no endpoint or whose
+// endpoint cannot be resolved to an absolute URL is an ErrInvalidRequest
+// error, and an invalid rate limit is an ErrInvalidRateLimiter error.
+//
+// The requests are created with the context.
+func (svc *HTTPService) LoadConfig(ctx context.Context, r io.Reader, writers map[string]ListWriter) error {
+	cfg, err := decodeConfig(r)
+	if err != nil {
+		return err
+	}
+
+	if len(cfg.Requests) == 0 {
+		return ErrNoRequests
+	}
+
+	var base *url.URL
+
+	if cfg.URL != "" {
+		var err error
+
+		base, err = url.Parse(cfg.URL)
+		if err != nil || !base.IsAbs() {
+			return fmt.Errorf("%w: url %q is not an absolute URL", ErrInvalidConfig, cfg.URL)
+		}
+	}
+
+	rlimiter, err := cfg.RateLimit.limiter()
+	if err != nil {
+		return err
+	}
+
+	reqs := make([]*Request, 0, len(cfg.Requests))
+
+	for idx, reqCfg := range cfg.Requests {
+		names := reqCfg.Writers
+		if len(names) == 0 {
+			names = cfg.Writers
+		}
+
+		reqWriters, err := lookupWriters(writers, names)
+		if err != nil {
+			return fmt.Errorf("request %d: %w", idx, err)
+		}
+
+		endpoints := []string{reqCfg.Endpoint}
+
+		if len(reqCfg.Vars) > 0 {
+			endpoints = make([]string, 0, len(reqCfg.Vars))
+
+			for vdx, vars := range reqCfg.Vars {
+				endpoint, err := expandTemplate(reqCfg.Endpoint, vars)
+				if err != nil {
+					return fmt.Errorf("request %d, variables %d: %w", idx, vdx, err)
+				}
+
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+
+		for _, endpoint := range endpoints {
+			req, err := reqCfg.request(ctx, base, endpoint, reqWriters)
+			if err != nil {
+				return fmt.Errorf("request %d: %w", idx, err)
+			}
+
+			reqs = append(reqs, req)
+		}
+	}
+
+	if rlimiter != nil {
+		svc.RateLimiter(rlimiter)
+	}
+
+	svc.Requests(reqs...)
+
+	return nil
+}
+
+// decodeConfig will decode the config from the reader as JSON if it starts with
+// "{", ignoring any leading whitespace, and as YAML otherwise.
+func decodeConfig(r io.Reader) (*Config, error) {
+	var cfg Config
+
+	buf := bufio.NewReader(r)
+
+	peek, err := buf.Peek(1)
+	for err == nil && bytes.ContainsAny(peek, " \t\r\n") {
+		_, _ = buf.ReadByte()
+		peek, err = buf.Peek(1)
+	}
+
+	if err == nil && peek[0] == '{' {
+		dec := json.NewDecoder(buf)
+		dec.DisallowUnknownFields()
+
+		err = dec.Decode(&cfg)
+	} else {
+		dec := yaml.NewDecoder(buf)
+		dec.KnownFields(true)
+
+		err = dec.Decode(&cfg)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	return &cfg, nil
+}
+
+// limiter will return the rate limiter for the config, or nil if the config is
+// nil.
+func (cfg *RateLimitConfig) limiter() (*rate.Limiter, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	if cfg.Burst < 1 {
+		return nil, fmt.Errorf("%w: burst must be at least 1, got %d", ErrInvalidRateLimiter, cfg.Burst)
+	}
+
+	period, err := time.ParseDuration(cfg.Period)
+	if err != nil || period <= 0 {
+		return nil, fmt.Errorf("%w: period must be a positive duration, got %q", ErrInvalidRateLimiter,
+			cfg.Period)
+	}
+
+	return rate.NewLimiter(rate.Every(period), cfg.Burst), nil
+}
+
+// lookupWriters will return the writers with the given names.
+func lookupWriters(writers map[string]ListWriter, names []string) ([]ListWriter, error) {
+	found := make([]ListWriter, 0, len(names))
+
+	for _, name := range names {
+		writer, ok := writers[name]
+		if !ok || writer == nil {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownWriter, name)
+		}
+
+		found = append(found, writer)
+	}
+
+	return found, nil
+}
+
+// request will create the request for the config, using the endpoint in
+// place of the config's, e.g. once its variables are expanded. A relative
+// endpoint is joined to the path of the base URL, so that an endpoint of
+// "/products" with a base URL of "https://example.com/v1" is
+// "https://example.com/v1/products". The config's query parameters take
+// precedence over those of the endpoint.
+func (cfg *RequestConfig) request(ctx context.Context, base *url.URL, rawEndpoint string,
+	writers []ListWriter,
+) (*Request, error) {
+	if rawEndpoint == "" {
+		return nil, fmt.Errorf("%w: no endpoint", ErrInvalidRequest)
+	}
+
+	endpoint, err := url.Parse(rawEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	if !endpoint.IsAbs() {
+		if base == nil {
+			return nil, fmt.Errorf("%w: endpoint %q is relative and there is no url", ErrInvalidRequest,
+				rawEndpoint)
+		}
+
+		// The query of the endpoint is added to the query of the
+		// base URL, taking precedence over it.
+		query := base.Query()
+		for key, vals := range endpoint.Query() {
+			query[key] = vals
+		}
+
+		endpoint = base.JoinPath(endpoint.EscapedPath())
+		endpoint.RawQuery = query.Encode()
+		endpoint.Fragment = ""
+	}
+
+	if len(cfg.Query) > 0 {
+		query := endpoint.Query()
+		for key, val := range cfg.Query {
+			query.Set(key, val)
+		}
+
+		endpoint.RawQuery = query.Encode()
+	}
+
+	method := strings.ToUpper(cfg.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if cfg.Body != "" {
+		body = strings.NewReader(cfg.Body)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, endpoint.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	header := http.Header{}
+	for key, val := range cfg.Headers {
+		header.Set(key, val)
+	}
+
+	return NewHTTPRequest(httpReq, WithWriters(writers...), WithHeaders(header)), nil
+}
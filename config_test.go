@@ -0,0 +1,365 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestHTTPServiceLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	mongo, csv := &mockListWriter{}, &mockListWriter{}
+	writers := map[string]ListWriter{"mongo": mongo, "csv": csv}
+
+	for _, tcase := range []struct {
+		name        string
+		config      string
+		wantErr     error
+		wantURLs    []string
+		wantWriters [][]ListWriter
+		wantLimit   rate.Limit
+		wantBurst   int
+	}{
+		{
+			name: "relative endpoints",
+			config: `{
+				"url": "https://example.com/v1",
+				"writers": ["mongo"],
+				"requests": [
+					{"endpoint": "/products"},
+					{"endpoint": "currencies?limit=10", "writers": ["mongo", "csv"]}
+				]
+			}`,
+			wantURLs: []string{
+				"https://example.com/v1/products",
+				"https://example.com/v1/currencies?limit=10",
+			},
+			wantWriters: [][]ListWriter{{mongo}, {mongo, csv}},
+		},
+		{
+			name:        "absolute endpoint without url",
+			config:      `{"requests": [{"endpoint": "https://example.com/products"}]}`,
+			wantURLs:    []string{"https://example.com/products"},
+			wantWriters: [][]ListWriter{{}},
+		},
+		{
+			name: "query",
+			config: `{
+				"url": "https://example.com?key=abc",
+				"requests": [{"endpoint": "/items?limit=1&page=2", "query": {"limit": "5", "q": "a b"}}]
+			}`,
+			wantURLs:    []string{"https://example.com/items?key=abc&limit=5&page=2&q=a+b"},
+			wantWriters: [][]ListWriter{{}},
+		},
+		{
+			name: "rate limit",
+			config: `{
+				"url": "https://example.com",
+				"rateLimit": {"burst": 5, "period": "500ms"},
+				"requests": [{"endpoint": "/products"}]
+			}`,
+			wantURLs:    []string{"https://example.com/products"},
+			wantWriters: [][]ListWriter{{}},
+			wantLimit:   rate.Every(500 * time.Millisecond),
+			wantBurst:   5,
+		},
+		{
+			name: "vars",
+			config: `{
+				"url": "https://example.com",
+				"requests": [{
+					"endpoint": "/products/{id}/candles?granularity={granularity}",
+					"vars": [{"id": "BTC-USD", "granularity": "60"}, {"id": "ETH/USD", "granularity": "3600"}]
+				}]
+			}`,
+			wantURLs: []string{
+				"https://example.com/products/BTC-USD/candles?granularity=60",
+				"https://example.com/products/ETH%2FUSD/candles?granularity=3600",
+			},
+			wantWriters: [][]ListWriter{{}, {}},
+		},
+		{
+			name: "missing var",
+			config: `{
+				"url": "https://example.com",
+				"requests": [{"endpoint": "/products/{id}", "vars": [{"product": "BTC-USD"}]}]
+			}`,
+			wantErr: ErrMissingTemplateVar,
+		},
+		{
+			name: "yaml",
+			config: "url: https://example.com/v1\n" +
+				"rateLimit:\n" +
+				"  burst: 5\n" +
+				"  period: 500ms\n" +
+				"writers: [mongo]\n" +
+				"requests:\n" +
+				"  - endpoint: /products\n" +
+				"    query:\n" +
+				"      limit: 5\n" +
+				"  - endpoint: /products/{id}\n" +
+				"    writers: [mongo, csv]\n" +
+				"    vars:\n" +
+				"      - id: BTC-USD\n",
+			wantURLs: []string{
+				"https://example.com/v1/products?limit=5",
+				"https://example.com/v1/products/BTC-USD",
+			},
+			wantWriters: [][]ListWriter{{mongo}, {mongo, csv}},
+			wantLimit:   rate.Every(500 * time.Millisecond),
+			wantBurst:   5,
+		},
+		{
+			name:    "invalid yaml",
+			config:  "url: [https://example.com\n",
+			wantErr: ErrInvalidConfig,
+		},
+		{
+			name:    "unknown yaml field",
+			config:  "url: https://example.com\nrequets: []\n",
+			wantErr: ErrInvalidConfig,
+		},
+		{
+			name:    "empty",
+			config:  "",
+			wantErr: ErrInvalidConfig,
+		},
+		{
+			name:    "invalid json",
+			config:  `{"url": `,
+			wantErr: ErrInvalidConfig,
+		},
+		{
+			name:    "unknown field",
+			config:  `{"url": "https://example.com", "requets": []}`,
+			wantErr: ErrInvalidConfig,
+		},
+		{
+			name:    "relative url",
+			config:  `{"url": "example.com", "requests": [{"endpoint": "/products"}]}`,
+			wantErr: ErrInvalidConfig,
+		},
+		{
+			name:    "no requests",
+			config:  `{"url": "https://example.com"}`,
+			wantErr: ErrNoRequests,
+		},
+		{
+			name:    "no endpoint",
+			config:  `{"url": "https://example.com", "requests": [{"method": "GET"}]}`,
+			wantErr: ErrInvalidRequest,
+		},
+		{
+			name:    "relative endpoint without url",
+			config:  `{"requests": [{"endpoint": "/products"}]}`,
+			wantErr: ErrInvalidRequest,
+		},
+		{
+			name:    "unknown writer",
+			config:  `{"url": "https://example.com", "requests": [{"endpoint": "/a", "writers": ["redis"]}]}`,
+			wantErr: ErrUnknownWriter,
+		},
+		{
+			name: "invalid burst",
+			config: `{
+				"url": "https://example.com",
+				"rateLimit": {"burst": 0, "period": "1s"},
+				"requests": [{"endpoint": "/products"}]
+			}`,
+			wantErr: ErrInvalidRateLimiter,
+		},
+		{
+			name: "invalid period",
+			config: `{
+				"url": "https://example.com",
+				"rateLimit": {"burst": 1, "period": "soon"},
+				"requests": [{"endpoint": "/products"}]
+			}`,
+			wantErr: ErrInvalidRateLimiter,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			err = svc.HTTP.LoadConfig(context.Background(), strings.NewReader(tcase.config), writers)
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+
+			if len(svc.HTTP.requests) != len(tcase.wantURLs) {
+				t.Fatalf("expected %d requests, got %d", len(tcase.wantURLs), len(svc.HTTP.requests))
+			}
+
+			for idx, req := range svc.HTTP.requests {
+				if got := req.http.URL.String(); got != tcase.wantURLs[idx] {
+					t.Errorf("expected request %d URL %q, got %q", idx, tcase.wantURLs[idx], got)
+				}
+
+				if len(req.writers) != len(tcase.wantWriters[idx]) {
+					t.Fatalf("expected request %d to have %d writers, got %d", idx,
+						len(tcase.wantWriters[idx]), len(req.writers))
+				}
+
+				for wdx, writer := range req.writers {
+					if writer != tcase.wantWriters[idx][wdx] {
+						t.Errorf("unexpected writer %d for request %d", wdx, idx)
+					}
+				}
+			}
+
+			if tcase.wantBurst == 0 {
+				if svc.HTTP.rlimiter != nil {
+					t.Errorf("expected no rate limiter")
+				}
+
+				return
+			}
+
+			if svc.HTTP.rlimiter.Limit() != tcase.wantLimit || svc.HTTP.rlimiter.Burst() != tcase.wantBurst {
+				t.Errorf("expected rate limit %v with burst %d, got %v with burst %d", tcase.wantLimit,
+					tcase.wantBurst, svc.HTTP.rlimiter.Limit(), svc.HTTP.rlimiter.Burst())
+			}
+		})
+	}
+}
+
+func TestHTTPServiceLoadConfigStore(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		fmt.Fprintf(w, `{"method":%q,"path":%q,"body":%q,"version":%q}`, r.Method, r.URL.Path, body,
+			r.Header.Get("X-Api-Version"))
+	}))
+	defer server.Close()
+
+	config := fmt.Sprintf(`{
+		"url": %q,
+		"writers": ["mock"],
+		"requests": [
+			{"endpoint": "/products", "headers": {"X-Api-Version": "2"}},
+			{"endpoint": "/orders", "method": "post", "body": "{\"id\":1}"}
+		]
+	}`, server.URL+"/v1")
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	writer := &mockListWriter{}
+
+	if err := svc.HTTP.LoadConfig(context.Background(), strings.NewReader(config),
+		map[string]ListWriter{"mock": writer}); err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	want := map[string]map[string]interface{}{
+		"/v1/products": {"body": "", "method": "GET", "path": "/v1/products", "version": "2"},
+		"/v1/orders":   {"body": `{"id":1}`, "method": "POST", "path": "/v1/orders", "version": ""},
+	}
+
+	if len(writer.data) != len(want) {
+		t.Fatalf("expected %d writes, got %d", len(want), len(writer.data))
+	}
+
+	for _, data := range writer.data {
+		list := &structpb.ListValue{}
+		if err := list.UnmarshalJSON(data); err != nil {
+			t.Fatalf("failed to unmarshal written data: %v", err)
+		}
+
+		records := list.AsSlice()
+		if len(records) != 1 {
+			t.Fatalf("expected 1 record, got %s", data)
+		}
+
+		record, _ := records[0].(map[string]interface{})
+		if path, _ := record["path"].(string); !reflect.DeepEqual(record, want[path]) {
+			t.Errorf("expected record %v, got %v", want[path], record)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name     string
+		config   string
+		wantErr  error
+		wantURLs []string
+	}{
+		{
+			name:     "yaml",
+			config:   "url: https://example.com\nrequests:\n  - endpoint: /products\n",
+			wantURLs: []string{"https://example.com/products"},
+		},
+		{
+			name:     "json",
+			config:   ` {"url": "https://example.com", "requests": [{"endpoint": "/products"}]}`,
+			wantURLs: []string{"https://example.com/products"},
+		},
+		{
+			name:    "writers",
+			config:  "url: https://example.com\nwriters: [mongo]\nrequests:\n  - endpoint: /products\n",
+			wantErr: ErrUnknownWriter,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := LoadConfig(strings.NewReader(tcase.config))
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+
+			if tcase.wantErr != nil {
+				return
+			}
+
+			if len(svc.requests) != len(tcase.wantURLs) {
+				t.Fatalf("expected %d requests, got %d", len(tcase.wantURLs), len(svc.requests))
+			}
+
+			for idx, req := range svc.requests {
+				if got := req.http.URL.String(); got != tcase.wantURLs[idx] {
+					t.Errorf("expected request %d URL %q, got %q", idx, tcase.wantURLs[idx], got)
+				}
+			}
+		})
+	}
+}
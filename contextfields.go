@@ -0,0 +1,59 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import "context"
+
+type (
+	contextFieldsKey struct{}
+	requestURLKey    struct{}
+)
+
+// WithContextFields sets fields that describe the request, e.g. the table that
+// its data is for, which are propagated to the list writers through the
+// context, see ContextFieldsFromContext. Along with the URL of the request and
+// the run ID, see RequestURLFromContext and RunIDFromContext, a writer can use
+// them to tie its own logs and errors back to the request that produced the
+// data.
+func WithContextFields(fields map[string]string) RequestOption {
+	return func(req *Request) {
+		req.contextFields = fields
+	}
+}
+
+// ContextFieldsFromContext will return the fields of the request that produced
+// the records being written, if it set any, see WithContextFields.
+func ContextFieldsFromContext(ctx context.Context) (map[string]string, bool) {
+	fields, ok := ctx.Value(contextFieldsKey{}).(map[string]string)
+
+	return fields, ok
+}
+
+// RequestURLFromContext will return the URL of the request that produced the
+// records being written, with any password redacted. For a gRPC request, it is
+// the full name of the method.
+func RequestURLFromContext(ctx context.Context) (string, bool) {
+	url, ok := ctx.Value(requestURLKey{}).(string)
+
+	return url, ok
+}
+
+// contextWithRequest will return a copy of the context carrying the URL and
+// fields of a request. Empty values are not set.
+func contextWithRequest(ctx context.Context, url string, fields map[string]string) context.Context {
+	if url != "" {
+		ctx = context.WithValue(ctx, requestURLKey{}, url)
+	}
+
+	if len(fields) != 0 {
+		ctx = context.WithValue(ctx, contextFieldsKey{}, fields)
+	}
+
+	return ctx
+}
@@ -0,0 +1,88 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContextFields(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id":1}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	fields := map[string]string{"table": "trades"}
+	writer := &mockContextWriter{}
+
+	svc.HTTP.Requests(newTestServerRequest(t, server.URL+"/trades", WithWriters(writer),
+		WithContextFields(fields)))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	if len(writer.ctxs) != 1 {
+		t.Fatalf("expected 1 write, got %d", len(writer.ctxs))
+	}
+
+	if got, ok := RequestURLFromContext(writer.ctxs[0]); !ok || got != server.URL+"/trades" {
+		t.Errorf("expected request URL %q, got %q", server.URL+"/trades", got)
+	}
+
+	if got, ok := ContextFieldsFromContext(writer.ctxs[0]); !ok || !reflect.DeepEqual(got, fields) {
+		t.Errorf("expected context fields %v, got %v", fields, got)
+	}
+
+	if _, ok := RunIDFromContext(writer.ctxs[0]); !ok {
+		t.Error("expected the run ID in the context")
+	}
+}
+
+func TestContextFieldsWriteError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id":1}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	errUpsert := errors.New("upsert failed")
+
+	svc.HTTP.Requests(newTestServerRequest(t, server.URL+"/orders",
+		WithWriters(&mockErrWriter{err: errUpsert})))
+
+	err = svc.HTTP.Store(context.Background())
+	if !errors.Is(err, errUpsert) {
+		t.Fatalf("expected the writer's error, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), server.URL+"/orders") {
+		t.Errorf("expected the error to include the request URL, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// WithCost sets the number of rate limiter tokens that each attempt at the
+// request takes, for APIs where some calls use more of the quota than others.
+// The default is 1, and a cost of less than 1 is treated as 1. A request whose
+// cost is more than the burst of the rate limiter can never be made, which
+// "Build" reports as an ErrInvalidRateLimiter error.
+func WithCost(cost int) RequestOption {
+	return func(req *Request) {
+		req.cost = cost
+	}
+}
+
+// tokens will return the number of rate limiter tokens that an attempt at the
+// request takes.
+func (req *Request) tokens() int {
+	if req.cost < 1 {
+		return 1
+	}
+
+	return req.cost
+}
+
+// CostHeader sets the name of a response header that reports how much of the
+// quota a call used, e.g. a GraphQL API whose queries are priced after they are
+// run. The cost of a call is only known once its response is received, but its
+// tokens are taken from the rate limiter before it is made, see WithCost. If
+// the reported cost is more than the tokens taken, then the difference is
+// charged to the rate limiter once the response is received, delaying the
+// requests that follow rather than the request itself. A charge is capped at
+// the burst of the rate limiter, and a reported cost that is less than the
+// tokens taken is not refunded. A header that is missing or is not a number is
+// ignored.
+func (svc *HTTPService) CostHeader(header string) *HTTPService {
+	svc.costHeader = header
+
+	return svc
+}
+
+// chargeCost will charge the rate limiter for the cost reported by the
+// response beyond the tokens taken for the request.
+func (job *webWorkerJob) chargeCost(ctx context.Context, rsp *http.Response) {
+	if job.rlimiter == nil || job.costHeader == "" {
+		return
+	}
+
+	cost, err := strconv.ParseFloat(strings.TrimSpace(rsp.Header.Get(job.costHeader)), 64)
+	if err != nil || math.IsNaN(cost) {
+		return
+	}
+
+	extra := math.Ceil(cost) - float64(job.req.tokens())
+	if extra <= 0 {
+		return
+	}
+
+	tokens := job.rlimiter.Burst()
+	if extra < float64(tokens) {
+		tokens = int(extra)
+	}
+
+	// The reservation is never waited on: taking the tokens is enough to
+	// delay the requests that follow.
+	job.rlimiter.ReserveN(job.clock.Now(), tokens)
+
+	if job.logger != nil {
+		job.logger.LogAttrs(ctx, slog.LevelDebug, "charged response cost to rate limiter",
+			slog.String("url", job.req.http.URL.Redacted()),
+			slog.Float64("cost", cost),
+			slog.Int("tokens", tokens))
+	}
+}
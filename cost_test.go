@@ -0,0 +1,104 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestHTTPServiceCost(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name       string
+		cost       int
+		costHeader string
+		reported   string
+		wantTokens float64
+	}{
+		{
+			name:       "default cost",
+			wantTokens: 9,
+		},
+		{
+			name:       "static cost",
+			cost:       4,
+			wantTokens: 6,
+		},
+		{
+			name:       "reported cost",
+			cost:       2,
+			costHeader: "X-Cost",
+			reported:   "6.5",
+			wantTokens: 3,
+		},
+		{
+			name:       "reported cost is less than static cost",
+			cost:       4,
+			costHeader: "X-Cost",
+			reported:   "1",
+			wantTokens: 6,
+		},
+		{
+			name:       "reported cost is capped at burst",
+			costHeader: "X-Cost",
+			reported:   "100",
+			wantTokens: -1,
+		},
+		{
+			name:       "reported cost is not a number",
+			costHeader: "X-Cost",
+			reported:   "free",
+			wantTokens: 9,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("X-Cost", tcase.reported)
+				fmt.Fprint(w, `[{"id":1}]`)
+			}))
+			t.Cleanup(server.Close)
+
+			// The fake clock only moves when slept on, so the limiter
+			// does not refill during the run.
+			clk := newFakeClock()
+
+			svc, err := NewService(context.Background(), withClock(clk))
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			rlimiter := rate.NewLimiter(rate.Every(time.Second), 10)
+
+			svc.HTTP.
+				RateLimiter(rlimiter).
+				CostHeader(tcase.costHeader).
+				Requests(newTestServerRequest(t, server.URL, WithCost(tcase.cost)))
+
+			if err := svc.HTTP.Store(context.Background()); err != nil {
+				t.Fatalf("failed to store: %v", err)
+			}
+
+			if got := rlimiter.TokensAt(clk.Now()); got != tcase.wantTokens {
+				t.Errorf("expected %v tokens, got %v", tcase.wantTokens, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"encoding/base64"
+	"net/http"
+)
+
+// BasicAuth sets the "Authorization" header of every request to use basic
+// authentication with the username and password, see Headers. The header is
+// set before each attempt at a request, so it is sent with every retry and
+// page. A request can override it, e.g. with WithBasicAuth or WithHeaders, and
+// its value is never logged.
+func (svc *HTTPService) BasicAuth(username, password string) *HTTPService {
+	return svc.Headers(http.Header{"Authorization": []string{basicAuthorization(username, password)}})
+}
+
+// BearerToken sets the "Authorization" header of every request to the bearer
+// token, see Headers. The header is set before each attempt at a request, so
+// it is sent with every retry and page. A request can override it, e.g. with
+// WithBearerToken or WithHeaders, and its value is never logged.
+func (svc *HTTPService) BearerToken(token string) *HTTPService {
+	return svc.Headers(http.Header{"Authorization": []string{"Bearer " + token}})
+}
+
+// WithBasicAuth sets the "Authorization" header of the request to use basic
+// authentication with the username and password, taking precedence over the
+// HTTP Service's credentials.
+func WithBasicAuth(username, password string) RequestOption {
+	return WithHeaders(http.Header{"Authorization": []string{basicAuthorization(username, password)}})
+}
+
+// WithBearerToken sets the "Authorization" header of the request to the bearer
+// token, taking precedence over the HTTP Service's credentials.
+func WithBearerToken(token string) RequestOption {
+	return WithHeaders(http.Header{"Authorization": []string{"Bearer " + token}})
+}
+
+// basicAuthorization will return the value of the "Authorization" header for
+// basic authentication, as defined by RFC 7617.
+func basicAuthorization(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHTTPServiceCredentials(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name      string
+		configure func(*HTTPService)
+		opts      []RequestOption
+		want      string
+	}{
+		{
+			name: "basic auth",
+			configure: func(svc *HTTPService) {
+				svc.BasicAuth("Aladdin", "open sesame")
+			},
+			want: "Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ==",
+		},
+		{
+			name: "bearer token",
+			configure: func(svc *HTTPService) {
+				svc.BearerToken("abc123")
+			},
+			want: "Bearer abc123",
+		},
+		{
+			name: "request overrides service",
+			configure: func(svc *HTTPService) {
+				svc.BearerToken("abc123")
+			},
+			opts: []RequestOption{WithBasicAuth("user", "pass")},
+			want: "Basic dXNlcjpwYXNz",
+		},
+		{
+			name: "request bearer token",
+			opts: []RequestOption{WithBearerToken("xyz")},
+			want: "Bearer xyz",
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				mtx   sync.Mutex
+				auths []string
+			)
+
+			// The first attempt fails, so that the header must
+			// survive the retry.
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mtx.Lock()
+				defer mtx.Unlock()
+
+				auths = append(auths, r.Header.Get("Authorization"))
+				if len(auths) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+
+					return
+				}
+
+				w.Write([]byte(`[]`)) //nolint:errcheck
+			}))
+			t.Cleanup(server.Close)
+
+			buf := &bytes.Buffer{}
+			logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+			svc, err := NewService(context.Background(), WithLogger(logger))
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			if tcase.configure != nil {
+				tcase.configure(svc.HTTP)
+			}
+
+			svc.HTTP.MaxRetries(1).RetryBackoff(1).Requests(newTestServerRequest(t, server.URL, tcase.opts...))
+
+			if err := svc.HTTP.Store(context.Background()); err != nil {
+				t.Fatalf("failed to store: %v", err)
+			}
+
+			if want := []string{tcase.want, tcase.want}; !reflect.DeepEqual(auths, want) {
+				t.Errorf("expected authorization headers %q, got %q", want, auths)
+			}
+
+			credentials := strings.Fields(tcase.want)[1]
+			if logs := buf.String(); strings.Contains(logs, credentials) {
+				t.Errorf("expected credentials to be redacted from logs, got %s", logs)
+			}
+		})
+	}
+}
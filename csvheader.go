@@ -0,0 +1,91 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrDuplicateHeader is returned when a CSV or TSV header has columns with the
+// same name, and the request is set to fail on them, see WithDuplicateHeaders.
+var ErrDuplicateHeader = errors.New("duplicate csv header")
+
+// DuplicateHeaderPolicy decides how the columns of a CSV or TSV header with the
+// same name are decoded, since each record can only have one field of a name.
+type DuplicateHeaderPolicy int32
+
+const (
+	// DuplicateHeaderLast keeps the value of the last column of a name,
+	// and drops the others. This is the default.
+	DuplicateHeaderLast DuplicateHeaderPolicy = iota
+
+	// DuplicateHeaderSuffix keeps every column, naming the first column of
+	// a name as-is and each later one with a suffix of its position among
+	// them, e.g. "price", "price_1", "price_2". A suffixed name that is
+	// already a column of the header is skipped, so no column is dropped.
+	DuplicateHeaderSuffix
+
+	// DuplicateHeaderError fails to decode a header with duplicate names
+	// with an ErrDuplicateHeader error.
+	DuplicateHeaderError
+)
+
+// WithDuplicateHeaders sets how the columns of a CSV or TSV response whose
+// header has duplicate names are decoded. By default, the last column of a
+// name is kept.
+func WithDuplicateHeaders(policy DuplicateHeaderPolicy) RequestOption {
+	return func(req *Request) {
+		req.duplicateHeaders = policy
+	}
+}
+
+// resolveHeader will return the names of the columns of the header under the
+// policy.
+func resolveHeader(header []string, policy DuplicateHeaderPolicy) ([]string, error) {
+	if policy == DuplicateHeaderLast {
+		return header, nil
+	}
+
+	names := make(map[string]bool, len(header))
+	for _, name := range header {
+		names[name] = true
+	}
+
+	resolved := make([]string, len(header))
+	seen := make(map[string]int, len(header))
+
+	for idx, name := range header {
+		count := seen[name]
+		seen[name]++
+
+		if count == 0 {
+			resolved[idx] = name
+
+			continue
+		}
+
+		if policy == DuplicateHeaderError {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateHeader, name)
+		}
+
+		suffixed := name + "_" + strconv.Itoa(count)
+		for names[suffixed] {
+			count++
+			suffixed = name + "_" + strconv.Itoa(count)
+		}
+
+		seen[name] = count + 1
+		names[suffixed] = true
+		resolved[idx] = suffixed
+	}
+
+	return resolved, nil
+}
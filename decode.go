@@ -10,12 +10,19 @@ package gidari
 
 import (
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"regexp"
 	"strings"
 
+	"github.com/alpstable/gidari/third_party/accept"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 	structpb "google.golang.org/protobuf/types/known/structpb"
 )
 
@@ -27,6 +34,10 @@ var ErrUnsupportedDecodeType = fmt.Errorf("unsupported decode type")
 // supported.
 var ErrUnsupportedProtobufType = fmt.Errorf("unsupported proto type")
 
+// ErrEmptyResponseBody is returned when a response has an empty body, and the
+// HTTP Service is set to fail on empty bodies.
+var ErrEmptyResponseBody = fmt.Errorf("empty response body")
+
 // ErrBadResponse is returned when a response's status code is not 200 or 'OK'.
 var ErrBadResponse = fmt.Errorf("response status code not OK")
 
@@ -39,8 +50,197 @@ const (
 
 	// DecodeTypeJSON is used to decode JSON data.
 	DecodeTypeJSON
+
+	// DecodeTypeProtobuf is used to decode binary protocol buffer data
+	// into the message registered on the request, see WithProtoMessage.
+	DecodeTypeProtobuf
+
+	// DecodeTypeCSV is used to decode CSV data with a header row. Each row
+	// is decoded into a record keyed by the header.
+	DecodeTypeCSV
+
+	// DecodeTypeTSV is used to decode tab-separated values with a header
+	// row, in the same way as DecodeTypeCSV. To write records as TSV, set
+	// the "Comma" of the "csv.Writer" used by the list writer to '\t'.
+	DecodeTypeTSV
+
+	// DecodeTypeJSONP is used to decode JSON wrapped in a JSONP callback,
+	// e.g. "callback({...});". The callback is stripped, and the JSON is
+	// decoded in the same way as DecodeTypeJSON. It is used for responses
+	// with a JavaScript "Content-Type", or can be set with WithDecodeType.
+	DecodeTypeJSONP
 )
 
+// ErrInvalidJSONP is returned when a body decoded as JSONP is not JSON wrapped
+// in a callback.
+var ErrInvalidJSONP = fmt.Errorf("invalid jsonp")
+
+// delimitedMediaTypes are the media types that identify a response of
+// delimited values.
+var delimitedMediaTypes = map[string]DecodeType{
+	"text/csv":                  DecodeTypeCSV,
+	"text/tab-separated-values": DecodeTypeTSV,
+}
+
+// protobufMediaTypes are the media types that identify a binary protocol
+// buffer response.
+var protobufMediaTypes = map[string]bool{
+	"application/x-protobuf":          true,
+	"application/protobuf":            true,
+	"application/vnd.google.protobuf": true,
+}
+
+// javascriptMediaTypes are the media types that identify a JSONP response.
+var javascriptMediaTypes = map[string]bool{
+	"text/javascript":          true,
+	"application/javascript":   true,
+	"application/x-javascript": true,
+}
+
+// ambiguousMediaTypes are the media types of a response that do not identify
+// the format of its body.
+var ambiguousMediaTypes = map[string]bool{
+	"":                         true,
+	"text/plain":               true,
+	"application/octet-stream": true,
+}
+
+// mediaTypeDecodeType will return the type used to decode a body of the media
+// type, or "Unknown" if the media type is not supported.
+func mediaTypeDecodeType(mediaType string) DecodeType {
+	if protobufMediaTypes[mediaType] {
+		return DecodeTypeProtobuf
+	}
+
+	if decodeType, ok := delimitedMediaTypes[mediaType]; ok {
+		return decodeType
+	}
+
+	if javascriptMediaTypes[mediaType] {
+		return DecodeTypeJSONP
+	}
+
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		return DecodeTypeJSON
+	}
+
+	return DecodeTypeUnknown
+}
+
+// requestedDecodeType will return the type used to decode the response body
+// implied by the "Accept" header of the request that produced it, see
+// WithAccept. The requested type is only used if the "Content-Type" of the
+// response is ambiguous, i.e. missing or too generic to identify the format,
+// and is the most preferred media type of the header that is supported.
+// Wildcards do not imply a type. If there is no such type, then "Unknown" is
+// returned.
+func requestedDecodeType(rsp *http.Response) DecodeType {
+	if rsp.Request == nil {
+		return DecodeTypeUnknown
+	}
+
+	mediaType, _, err := mime.ParseMediaType(rsp.Header.Get("Content-Type"))
+	if err == nil && !ambiguousMediaTypes[mediaType] {
+		return DecodeTypeUnknown
+	}
+
+	for _, acceptHeader := range accept.ParseAcceptHeader(rsp.Request.Header.Get("Accept")) {
+		decodeType := mediaTypeDecodeType(acceptHeader.Typ + "/" + acceptHeader.Subtype)
+		if decodeType != DecodeTypeUnknown {
+			return decodeType
+		}
+	}
+
+	return DecodeTypeUnknown
+}
+
+// responseDecodeType will return the type used to decode the response body
+// named by its "Content-Type" header, or else by its "Accept" header.
+// Wildcards do not imply a type, so if neither header names a supported media
+// type, then "Unknown" is returned, and the body is left to be sniffed, see
+// "sniffDecodeType".
+func responseDecodeType(rsp *http.Response) DecodeType {
+	mediaType, _, err := mime.ParseMediaType(rsp.Header.Get("Content-Type"))
+	if err == nil {
+		if decodeType := mediaTypeDecodeType(mediaType); decodeType != DecodeTypeUnknown {
+			return decodeType
+		}
+	}
+
+	for _, acceptHeader := range accept.ParseAcceptHeader(rsp.Header.Get("Accept")) {
+		decodeType := mediaTypeDecodeType(acceptHeader.Typ + "/" + acceptHeader.Subtype)
+		if decodeType != DecodeTypeUnknown {
+			return decodeType
+		}
+	}
+
+	return DecodeTypeUnknown
+}
+
+// sniffDecodeType will return the type used to decode the data by inspecting
+// it. This is a last resort for when the headers of a response cannot be used
+// to determine the type, so it is conservative: JSON must be a sequence of
+// valid objects or arrays, e.g. newline-delimited JSON, and CSV or TSV must
+// have a header row and at least one record, with more than one column and the
+// same number of columns in every row. The data is TSV if its first line has
+// more tabs than commas. Anything else is "Unknown".
+func sniffDecodeType(data []byte) DecodeType {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if len(data) == 0 {
+		return DecodeTypeUnknown
+	}
+
+	if data[0] == '{' || data[0] == '[' {
+		dec := json.NewDecoder(bytes.NewReader(data))
+
+		for {
+			var value json.RawMessage
+
+			err := dec.Decode(&value)
+			if errors.Is(err, io.EOF) {
+				return DecodeTypeJSON
+			}
+
+			if err != nil || (value[0] != '{' && value[0] != '[') {
+				return DecodeTypeUnknown
+			}
+		}
+	}
+
+	// Binary data is never CSV.
+	if bytes.IndexByte(data, 0) >= 0 {
+		return DecodeTypeUnknown
+	}
+
+	decodeType, comma := DecodeTypeCSV, ','
+
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(firstLine, []byte("\t")) > bytes.Count(firstLine, []byte(",")) {
+		decodeType, comma = DecodeTypeTSV, '\t'
+	}
+
+	// The CSV reader requires every record to have the same number of
+	// fields as the first.
+	records, err := newDelimitedReader(bytes.NewReader(data), comma).ReadAll()
+	if err != nil || len(records) < 2 || len(records[0]) < 2 {
+		return DecodeTypeUnknown
+	}
+
+	return decodeType
+}
+
+// newDelimitedReader will return a CSV reader for r, using the comma to
+// separate fields. Since TSV is conventionally unquoted, a quote inside a
+// tab-separated field is read literally; a quoted field can still contain tabs
+// and newlines.
+func newDelimitedReader(r io.Reader, comma rune) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.LazyQuotes = comma == '\t'
+
+	return reader
+}
+
 func addValue(list *structpb.ListValue, val *structpb.Value) error {
 	switch val.Kind.(type) {
 	case *structpb.Value_StructValue:
@@ -58,35 +258,88 @@ func addValue(list *structpb.ListValue, val *structpb.Value) error {
 // the target.
 type DecodeFunc func(list *structpb.ListValue) error
 
-func decodeFuncJSON(rsp *http.Response) DecodeFunc {
+// decodeFuncEmpty is the decode function for an empty body, which has no
+// records.
+func decodeFuncEmpty(*structpb.ListValue) error {
+	return nil
+}
+
+func decodeFuncProtobuf(body []byte, msgType proto.Message) DecodeFunc {
 	return func(list *structpb.ListValue) error {
-		defer func() {
-			if err := rsp.Body.Close(); err != nil {
-				panic(err)
-			}
-		}()
+		// Create a new message of the registered type so that the
+		// registered message is never modified.
+		msg := msgType.ProtoReflect().New().Interface()
+		if err := proto.Unmarshal(body, msg); err != nil {
+			return fmt.Errorf("failed to decode protobuf: %w", err)
+		}
+
+		return decodeFuncProtoMessage(msg)(list)
+	}
+}
+
+func decodeFuncProtoMessage(msg proto.Message) DecodeFunc {
+	return func(list *structpb.ListValue) error {
+		// Convert the message into a generic value using its JSON
+		// representation.
+		data, err := protojson.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("failed to encode protobuf as json: %w", err)
+		}
+
+		val := &structpb.Value{}
+		if err := protojson.Unmarshal(data, val); err != nil {
+			return fmt.Errorf("failed to decode json: %w", err)
+		}
+
+		if err := addValue(list, val); err != nil {
+			return fmt.Errorf("failed to add value to list: %w", err)
+		}
 
-		// Check to see if the response is empty. If it is, then we can
-		// just return nil.
-		if rsp.ContentLength == 0 {
+		return nil
+	}
+}
+
+// decodeFuncCSV will decode the rows of delimited values, separated by the
+// comma, into records keyed by the header row, whose duplicate names are
+// resolved by the policy.
+func decodeFuncCSV(body []byte, comma rune, policy DuplicateHeaderPolicy) DecodeFunc {
+	return func(list *structpb.ListValue) error {
+		reader := newDelimitedReader(bytes.NewReader(body), comma)
+
+		header, err := reader.Read()
+		if errors.Is(err, io.EOF) {
 			return nil
 		}
 
-		// Decode the response into a list of values.
-		dec := json.NewDecoder(rsp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to decode csv header: %w", err)
+		}
 
-		for dec.More() {
-			val := &structpb.Value{}
-			if err := dec.Decode(val); err != nil {
-				return fmt.Errorf("failed to decode json: %w", err)
+		header, err = resolveHeader(header, policy)
+		if err != nil {
+			return err
+		}
+
+		for {
+			row, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			if err != nil {
+				return fmt.Errorf("failed to decode csv: %w", err)
+			}
+
+			fields := make(map[string]*structpb.Value, len(header))
+			for idx, key := range header {
+				fields[key] = structpb.NewStringValue(row[idx])
 			}
 
+			val := structpb.NewStructValue(&structpb.Struct{Fields: fields})
 			if err := addValue(list, val); err != nil {
 				return fmt.Errorf("failed to add value to list: %w", err)
 			}
 		}
-
-		return nil
 	}
 }
 
@@ -110,6 +363,75 @@ func decodeFuncJSONFromBytes(b []byte) DecodeFunc {
 	}
 }
 
+// decodeFuncJSONP will decode the JSON wrapped in the JSONP callback of the
+// body, see "stripJSONP".
+func decodeFuncJSONP(b []byte) DecodeFunc {
+	return func(list *structpb.ListValue) error {
+		data, err := stripJSONP(b)
+		if err != nil {
+			return err
+		}
+
+		return decodeFuncJSONFromBytes(data)(list)
+	}
+}
+
+// stripJSONP will return the JSON wrapped in the JSONP callback of the data,
+// i.e. what is between the parentheses of "name(...)". The name is a
+// JavaScript identifier, or a path of them such as "window.cb", and may be
+// preceded by an empty "/**/" comment, as some APIs do to guard against
+// content sniffing. Whitespace around each part, and a trailing semicolon, are
+// ignored. Since the JSON is taken to be everything up to the last closing
+// parenthesis, parentheses within its strings are kept, and it must be valid.
+func stripJSONP(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("/**/")))
+
+	open := bytes.IndexByte(data, '(')
+	if open < 0 {
+		return nil, fmt.Errorf("%w: no callback", ErrInvalidJSONP)
+	}
+
+	if name := bytes.TrimSpace(data[:open]); !isJSONPCallback(name) {
+		return nil, fmt.Errorf("%w: invalid callback %q", ErrInvalidJSONP, name)
+	}
+
+	rest := bytes.TrimSpace(data[open+1:])
+	rest = bytes.TrimSpace(bytes.TrimSuffix(rest, []byte(";")))
+
+	if !bytes.HasSuffix(rest, []byte(")")) {
+		return nil, fmt.Errorf("%w: unterminated callback", ErrInvalidJSONP)
+	}
+
+	// Anything but JSON in the callback, such as a second statement, is
+	// not a JSONP response.
+	arg := rest[:len(rest)-1]
+	if !json.Valid(arg) {
+		return nil, fmt.Errorf("%w: callback argument is not json", ErrInvalidJSONP)
+	}
+
+	return arg, nil
+}
+
+// isJSONPCallback will return true if the name is a JavaScript identifier, or
+// a path of identifiers separated by dots.
+func isJSONPCallback(name []byte) bool {
+	for _, part := range bytes.Split(name, []byte(".")) {
+		if len(part) == 0 {
+			return false
+		}
+
+		for idx, char := range part {
+			isLetter := char == '_' || char == '$' || ('a' <= char && char <= 'z') || ('A' <= char && char <= 'Z')
+			if !isLetter && (idx == 0 || char < '0' || char > '9') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
 func isPartialJSON(data []byte) bool {
 	if len(data) == 0 {
 		return true
@@ -9,11 +9,14 @@
 package gidari
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
 
 	"google.golang.org/protobuf/proto"
@@ -77,10 +80,7 @@ func TestDecode(t *testing.T) {
 
 			switch tcase.dataType {
 			case DecodeTypeJSON:
-				decFunc = decodeFuncJSON(&http.Response{
-					Body:          io.NopCloser(bytes.NewReader(tcase.data)),
-					ContentLength: int64(len(tcase.data)),
-				})
+				decFunc = decodeFuncJSONFromBytes(tcase.data)
 			case DecodeTypeUnknown:
 				fallthrough
 			default:
@@ -186,15 +186,833 @@ func BenchmarkDecodeUpsertRequest(b *testing.B) {
 
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
-			httpResp := &http.Response{
-				Body:          io.NopCloser(bytes.NewReader(data)),
-				ContentLength: int64(len(data)),
-			}
-
-			err := decodeFuncJSON(httpResp)(&structpb.ListValue{})
+			err := decodeFuncJSONFromBytes(data)(&structpb.ListValue{})
 			if err != nil {
 				b.Fatalf("unexpected error: %v", err)
 			}
 		}
 	})
 }
+
+func TestResponseDecodeType(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name   string
+		header http.Header
+		want   DecodeType
+	}{
+		{
+			name: "no headers",
+			want: DecodeTypeUnknown,
+		},
+		{
+			name:   "json content type",
+			header: http.Header{"Content-Type": []string{"application/vnd.api+json"}},
+			want:   DecodeTypeJSON,
+		},
+		{
+			name:   "ambiguous content type",
+			header: http.Header{"Content-Type": []string{"application/octet-stream"}},
+			want:   DecodeTypeUnknown,
+		},
+		{
+			name:   "wildcard accept",
+			header: http.Header{"Accept": []string{"*/*"}},
+			want:   DecodeTypeUnknown,
+		},
+		{
+			name:   "protobuf content type",
+			header: http.Header{"Content-Type": []string{"application/x-protobuf"}},
+			want:   DecodeTypeProtobuf,
+		},
+		{
+			name:   "protobuf content type with parameters",
+			header: http.Header{"Content-Type": []string{"application/protobuf; proto=foo.Bar"}},
+			want:   DecodeTypeProtobuf,
+		},
+		{
+			name:   "csv content type",
+			header: http.Header{"Content-Type": []string{"text/csv; charset=utf-8"}},
+			want:   DecodeTypeCSV,
+		},
+		{
+			name:   "tsv content type",
+			header: http.Header{"Content-Type": []string{"text/tab-separated-values"}},
+			want:   DecodeTypeTSV,
+		},
+		{
+			name:   "javascript content type",
+			header: http.Header{"Content-Type": []string{"text/javascript; charset=utf-8"}},
+			want:   DecodeTypeJSONP,
+		},
+		{
+			name:   "unsupported accept",
+			header: http.Header{"Accept": []string{"text/html"}},
+			want:   DecodeTypeUnknown,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			rsp := &http.Response{Header: tcase.header}
+			if rsp.Header == nil {
+				rsp.Header = http.Header{}
+			}
+
+			if got := responseDecodeType(rsp); got != tcase.want {
+				t.Errorf("expected %v, got %v", tcase.want, got)
+			}
+		})
+	}
+}
+
+func TestRequestedDecodeType(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name        string
+		accept      string
+		contentType string
+		want        DecodeType
+	}{
+		{
+			name: "no accept",
+			want: DecodeTypeUnknown,
+		},
+		{
+			name:   "csv without content type",
+			accept: "text/csv",
+			want:   DecodeTypeCSV,
+		},
+		{
+			name:        "json with generic content type",
+			accept:      "application/vnd.api+json",
+			contentType: "text/plain; charset=utf-8",
+			want:        DecodeTypeJSON,
+		},
+		{
+			name:   "most preferred supported type",
+			accept: "text/html, text/csv;q=0.5, text/tab-separated-values;q=0.8",
+			want:   DecodeTypeTSV,
+		},
+		{
+			name:   "wildcard",
+			accept: "*/*",
+			want:   DecodeTypeUnknown,
+		},
+		{
+			name:        "specific content type",
+			accept:      "text/csv",
+			contentType: "application/json",
+			want:        DecodeTypeUnknown,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := &http.Request{Header: http.Header{}}
+			if tcase.accept != "" {
+				req.Header.Set("Accept", tcase.accept)
+			}
+
+			rsp := &http.Response{Header: http.Header{}, Request: req}
+			if tcase.contentType != "" {
+				rsp.Header.Set("Content-Type", tcase.contentType)
+			}
+
+			if got := requestedDecodeType(rsp); got != tcase.want {
+				t.Errorf("expected %v, got %v", tcase.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeProtobuf(t *testing.T) {
+	t.Parallel()
+
+	msg, err := structpb.NewStruct(map[string]interface{}{"id": "1", "name": "x"})
+	if err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("failed to marshal message: %v", err)
+	}
+
+	registered := &structpb.Struct{}
+
+	list := &structpb.ListValue{}
+
+	err = decodeFuncProtobuf(data, registered)(list)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want, err := structpb.NewList([]interface{}{map[string]interface{}{"id": "1", "name": "x"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !proto.Equal(want, list) {
+		t.Errorf("unexpected list: %v", list)
+	}
+
+	if len(registered.Fields) != 0 {
+		t.Error("expected the registered message not to be modified")
+	}
+}
+
+func TestSniffDecodeType(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name string
+		data string
+		want DecodeType
+	}{
+		{name: "empty", data: "", want: DecodeTypeUnknown},
+		{name: "whitespace", data: " \n\t", want: DecodeTypeUnknown},
+		{name: "json object", data: `{"id":1}`, want: DecodeTypeJSON},
+		{name: "json list", data: " \n[{\"id\":1}]\n", want: DecodeTypeJSON},
+		{name: "json with bom", data: "\xef\xbb\xbf{\"id\":1}", want: DecodeTypeJSON},
+		{name: "invalid json", data: `{"id":`, want: DecodeTypeUnknown},
+		{name: "ndjson", data: "{\"id\":1}\n{\"id\":2}\n", want: DecodeTypeJSON},
+		{name: "json followed by text", data: "{\"id\":1}\nhello", want: DecodeTypeUnknown},
+		{name: "json followed by scalar", data: "{\"id\":1} 2", want: DecodeTypeUnknown},
+		{name: "csv", data: "id,name\n1,a\n2,b\n", want: DecodeTypeCSV},
+		{name: "csv with quotes", data: "id,name\n1,\"a, b\"\n", want: DecodeTypeCSV},
+		{name: "csv header only", data: "id,name\n", want: DecodeTypeUnknown},
+		{name: "tsv", data: "id\tname\n1\ta\n2\tb\n", want: DecodeTypeTSV},
+		{name: "tsv with commas", data: "id\tname\n1\ta, b\n2\tc, d\n", want: DecodeTypeTSV},
+		{name: "tsv with quotes", data: "id\tname\n1\ta \"b\"\n", want: DecodeTypeTSV},
+		{name: "csv with tabs", data: "id,name,note\n1,a,\"b\tc\"\n", want: DecodeTypeCSV},
+		{name: "tsv inconsistent columns", data: "id\tname\n1\ta\tx\n", want: DecodeTypeUnknown},
+		{name: "single column", data: "id\n1\n2\n", want: DecodeTypeUnknown},
+		{name: "inconsistent columns", data: "id,name\n1,a,x\n", want: DecodeTypeUnknown},
+		{name: "plain text", data: "hello world", want: DecodeTypeUnknown},
+		{name: "html", data: "<html><body>a,b</body></html>", want: DecodeTypeUnknown},
+		{name: "binary", data: "a,b\n\x00,\x01\n", want: DecodeTypeUnknown},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := sniffDecodeType([]byte(tcase.data)); got != tcase.want {
+				t.Errorf("expected %v, got %v", tcase.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeCSV(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name  string
+		data  string
+		comma rune
+		want  []interface{}
+	}{
+		{
+			name:  "csv",
+			data:  "id,name\n1,a\n2,\"b, c\"\n",
+			comma: ',',
+			want: []interface{}{
+				map[string]interface{}{"id": "1", "name": "a"},
+				map[string]interface{}{"id": "2", "name": "b, c"},
+			},
+		},
+		{
+			name:  "tsv",
+			data:  "id\tname\n1\ta\n2\tb, c\n",
+			comma: '\t',
+			want: []interface{}{
+				map[string]interface{}{"id": "1", "name": "a"},
+				map[string]interface{}{"id": "2", "name": "b, c"},
+			},
+		},
+		{
+			name:  "tsv with literal quotes",
+			data:  "id\tname\n1\ta \"b\" c\n",
+			comma: '\t',
+			want: []interface{}{
+				map[string]interface{}{"id": "1", "name": "a \"b\" c"},
+			},
+		},
+		{
+			name:  "tsv with quoted tab",
+			data:  "id\tname\n1\t\"a\tb\"\n",
+			comma: '\t',
+			want: []interface{}{
+				map[string]interface{}{"id": "1", "name": "a\tb"},
+			},
+		},
+		{
+			name:  "header only",
+			data:  "id\tname\n",
+			comma: '\t',
+			want:  []interface{}{},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list := &structpb.ListValue{}
+			if err := decodeFuncCSV([]byte(tcase.data), tcase.comma, DuplicateHeaderLast)(list); err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+
+			if got := list.AsSlice(); !reflect.DeepEqual(got, tcase.want) {
+				t.Errorf("expected %v, got %v", tcase.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeCSVDuplicateHeaders(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name   string
+		data   string
+		policy DuplicateHeaderPolicy
+		want   []interface{}
+		err    error
+	}{
+		{
+			name:   "keep last",
+			data:   "id,price,price\n1,a,b\n",
+			policy: DuplicateHeaderLast,
+			want:   []interface{}{map[string]interface{}{"id": "1", "price": "b"}},
+		},
+		{
+			name:   "suffix",
+			data:   "id,price,price,price\n1,a,b,c\n",
+			policy: DuplicateHeaderSuffix,
+			want: []interface{}{
+				map[string]interface{}{"id": "1", "price": "a", "price_1": "b", "price_2": "c"},
+			},
+		},
+		{
+			name:   "suffix skips existing names",
+			data:   "price,price,price_1\na,b,c\n",
+			policy: DuplicateHeaderSuffix,
+			want: []interface{}{
+				map[string]interface{}{"price": "a", "price_2": "b", "price_1": "c"},
+			},
+		},
+		{
+			name:   "error",
+			data:   "id,price,price\n1,a,b\n",
+			policy: DuplicateHeaderError,
+			err:    ErrDuplicateHeader,
+		},
+		{
+			name:   "error without duplicates",
+			data:   "id,price\n1,a\n",
+			policy: DuplicateHeaderError,
+			want:   []interface{}{map[string]interface{}{"id": "1", "price": "a"}},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list := &structpb.ListValue{}
+
+			err := decodeFuncCSV([]byte(tcase.data), ',', tcase.policy)(list)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if tcase.err != nil {
+				return
+			}
+
+			if got := list.AsSlice(); !reflect.DeepEqual(got, tcase.want) {
+				t.Errorf("expected %v, got %v", tcase.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONP(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name string
+		data string
+		want []interface{}
+		err  error
+	}{
+		{
+			name: "trailing semicolon",
+			data: `callback([{"id":1},{"id":2}]);`,
+			want: []interface{}{
+				map[string]interface{}{"id": 1.0},
+				map[string]interface{}{"id": 2.0},
+			},
+		},
+		{
+			name: "no trailing semicolon",
+			data: `callback({"id":1})`,
+			want: []interface{}{map[string]interface{}{"id": 1.0}},
+		},
+		{
+			name: "whitespace",
+			data: "\n  window.jQuery_123 ( {\"id\":1} ) ;\n",
+			want: []interface{}{map[string]interface{}{"id": 1.0}},
+		},
+		{
+			name: "comment guard",
+			data: `/**/ cb({"id":1});`,
+			want: []interface{}{map[string]interface{}{"id": 1.0}},
+		},
+		{
+			name: "nested parentheses in strings",
+			data: `cb({"note":"a (b) c)","open":"(("});`,
+			want: []interface{}{map[string]interface{}{"note": "a (b) c)", "open": "(("}},
+		},
+		{
+			name: "no callback",
+			data: `{"id":1}`,
+			err:  ErrInvalidJSONP,
+		},
+		{
+			name: "invalid callback",
+			data: `alert(1); cb({"id":1});`,
+			err:  ErrInvalidJSONP,
+		},
+		{
+			name: "unterminated callback",
+			data: `cb({"id":1}`,
+			err:  ErrInvalidJSONP,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list := &structpb.ListValue{}
+
+			err := decodeFuncJSONP([]byte(tcase.data))(list)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if tcase.err != nil {
+				return
+			}
+
+			if got := list.AsSlice(); !reflect.DeepEqual(got, tcase.want) {
+				t.Errorf("expected %v, got %v", tcase.want, got)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreJSONP(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		fmt.Fprintf(w, "%s([{\"id\":\"1\"},{\"id\":\"2\"}]);", r.URL.Query().Get("callback"))
+	}))
+	t.Cleanup(server.Close)
+
+	for _, tcase := range []struct {
+		name        string
+		contentType string
+		opts        []RequestOption
+	}{
+		{name: "javascript content type", contentType: "application/javascript"},
+		{
+			name:        "decode type",
+			contentType: "text/plain",
+			opts:        []RequestOption{WithDecodeType(DecodeTypeJSONP)},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			writer := &mockListWriter{}
+
+			opts := append([]RequestOption{WithWriters(writer)}, tcase.opts...)
+			svc.HTTP.Requests(newTestServerRequest(t,
+				server.URL+"?callback=cb&type="+url.QueryEscape(tcase.contentType), opts...))
+
+			if err := svc.HTTP.Store(context.Background()); err != nil {
+				t.Fatalf("failed to store: %v", err)
+			}
+
+			if len(writer.data) != 1 {
+				t.Fatalf("expected 1 write, got %d", len(writer.data))
+			}
+
+			list := &structpb.ListValue{}
+			if err := list.UnmarshalJSON(writer.data[0]); err != nil {
+				t.Fatalf("failed to unmarshal written data: %v", err)
+			}
+
+			want := []interface{}{
+				map[string]interface{}{"id": "1"},
+				map[string]interface{}{"id": "2"},
+			}
+
+			if got := list.AsSlice(); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected records %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreSniff(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name        string
+		body        string
+		wantRecords int64
+		wantErr     error
+	}{
+		{
+			name:        "json",
+			body:        `[{"id":1},{"id":2}]`,
+			wantRecords: 2,
+		},
+		{
+			name:        "csv",
+			body:        "id,name\n1,a\n2,b\n3,c\n",
+			wantRecords: 3,
+		},
+		{
+			name:        "tsv",
+			body:        "id\tname\n1\ta\n2\tb\n",
+			wantRecords: 2,
+		},
+		{
+			name:    "unknown",
+			body:    "hello world",
+			wantErr: ErrUnsupportedDecodeType,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			// The headers of the response do not identify a
+			// supported type, so the body must be sniffed.
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/octet-stream")
+
+				fmt.Fprint(w, tcase.body)
+			}))
+			defer server.Close()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			svc.HTTP.Requests(newTestServerRequest(t, server.URL, WithWriters(&mockListWriter{})))
+
+			err = svc.HTTP.Store(context.Background())
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+
+			if got := svc.HTTP.Result().Records; got != tcase.wantRecords {
+				t.Errorf("expected %d records, got %d", tcase.wantRecords, got)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreAccept(t *testing.T) {
+	t.Parallel()
+
+	// The server negotiates the format of the body from the "Accept"
+	// header, but responds with a generic "Content-Type". A CSV body with a
+	// single column cannot be sniffed, so it must be decoded as the
+	// requested type.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+
+		if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+			fmt.Fprint(w, "id\n1\n2\n")
+
+			return
+		}
+
+		fmt.Fprint(w, `[{"id":"1"},{"id":"2"}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	for _, tcase := range []struct {
+		name   string
+		accept string
+	}{
+		{name: "csv", accept: "text/csv"},
+		{name: "json", accept: "application/json"},
+		{name: "csv preferred", accept: "application/json;q=0.1, text/csv"},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			writer := &mockListWriter{}
+
+			svc.HTTP.Requests(newTestServerRequest(t, server.URL, WithWriters(writer),
+				WithAccept(tcase.accept)))
+
+			if err := svc.HTTP.Store(context.Background()); err != nil {
+				t.Fatalf("failed to store: %v", err)
+			}
+
+			if len(writer.data) != 1 {
+				t.Fatalf("expected 1 write, got %d", len(writer.data))
+			}
+
+			list := &structpb.ListValue{}
+			if err := list.UnmarshalJSON(writer.data[0]); err != nil {
+				t.Fatalf("failed to unmarshal written data: %v", err)
+			}
+
+			want := []interface{}{
+				map[string]interface{}{"id": "1"},
+				map[string]interface{}{"id": "2"},
+			}
+
+			if got := list.AsSlice(); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected records %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreDecodeType(t *testing.T) {
+	t.Parallel()
+
+	// The server responds with a "Content-Type" that can be decoded, but
+	// that does not match the body.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, "id\n1\n2\n")
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		fmt.Fprint(w, `[{"id":"1"},{"id":"2"}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	for _, tcase := range []struct {
+		name       string
+		format     string
+		decodeType DecodeType
+	}{
+		{name: "csv", format: "csv", decodeType: DecodeTypeCSV},
+		{name: "json", format: "json", decodeType: DecodeTypeJSON},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			writer := &mockListWriter{}
+
+			svc.HTTP.Requests(newTestServerRequest(t, server.URL+"?format="+tcase.format,
+				WithWriters(writer), WithDecodeType(tcase.decodeType)))
+
+			if err := svc.HTTP.Store(context.Background()); err != nil {
+				t.Fatalf("failed to store: %v", err)
+			}
+
+			if len(writer.data) != 1 {
+				t.Fatalf("expected 1 write, got %d", len(writer.data))
+			}
+
+			list := &structpb.ListValue{}
+			if err := list.UnmarshalJSON(writer.data[0]); err != nil {
+				t.Fatalf("failed to unmarshal written data: %v", err)
+			}
+
+			want := []interface{}{
+				map[string]interface{}{"id": "1"},
+				map[string]interface{}{"id": "2"},
+			}
+
+			if got := list.AsSlice(); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected records %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreEmptyBody(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name            string
+		body            string
+		header          http.Header
+		failOnEmptyBody bool
+		wantErr         error
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "whitespace",
+			body: " \n\t",
+		},
+		{
+			name:   "empty without a decode type",
+			header: http.Header{"Accept": []string{"application/octet-stream"}},
+		},
+		{
+			name:            "empty fails",
+			failOnEmptyBody: true,
+			wantErr:         ErrEmptyResponseBody,
+		},
+		{
+			name:            "whitespace fails",
+			body:            "\n",
+			failOnEmptyBody: true,
+			wantErr:         ErrEmptyResponseBody,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				for key, vals := range tcase.header {
+					w.Header()[key] = vals
+				}
+
+				fmt.Fprint(w, tcase.body)
+			}))
+			defer server.Close()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			svc.HTTP.
+				FailOnEmptyBody(tcase.failOnEmptyBody).
+				Requests(newTestServerRequest(t, server.URL, WithWriters(&mockListWriter{})))
+
+			err = svc.HTTP.Store(context.Background())
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+
+			if err != nil && !strings.Contains(err.Error(), server.URL) {
+				t.Errorf("expected error to contain the URL %q, got %v", server.URL, err)
+			}
+
+			if got := svc.HTTP.Result().Records; got != 0 {
+				t.Errorf("expected no records, got %d", got)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreObject(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name   string
+		header http.Header
+	}{
+		{
+			name:   "json",
+			header: http.Header{"Content-Type": []string{"application/json"}},
+		},
+		{
+			name:   "sniffed",
+			header: http.Header{"Accept": []string{"application/octet-stream"}},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				for key, vals := range tcase.header {
+					w.Header()[key] = vals
+				}
+
+				fmt.Fprint(w, `{"id":"1","name":"x"}`)
+			}))
+			defer server.Close()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			writer := &mockListWriter{}
+
+			svc.HTTP.Requests(newTestServerRequest(t, server.URL, WithWriters(writer)))
+
+			if err := svc.HTTP.Store(context.Background()); err != nil {
+				t.Fatalf("failed to store: %v", err)
+			}
+
+			if got := svc.HTTP.Result().Records; got != 1 {
+				t.Errorf("expected 1 record, got %d", got)
+			}
+
+			if writer.count != 1 {
+				t.Fatalf("expected 1 write, got %d", writer.count)
+			}
+
+			list := &structpb.ListValue{}
+			if err := list.UnmarshalJSON(writer.data[0]); err != nil {
+				t.Fatalf("failed to unmarshal written data: %v", err)
+			}
+
+			want := []interface{}{map[string]interface{}{"id": "1", "name": "x"}}
+			if got := list.AsSlice(); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected records %v, got %v", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrRecordsPath is returned when the path of the records is not found in a
+// JSON document, see DecodeJSONRecordsAt.
+var ErrRecordsPath = errors.New("records path not found")
+
+// DecodeRecords will decode the data into records the same way that "Store"
+// decodes a response body, for custom sinks and transforms that do not go
+// through a list writer:
+//
+//   - a JSON object is a record, and each element of a JSON array is a
+//     record; newline-delimited JSON is a sequence of such values;
+//   - each row of CSV or TSV is a record keyed by the header row, with
+//     string values.
+//
+// A value that is not an object, e.g. a number in a JSON array, is returned
+// as a record with a single "value" field, which is how TableWriter shows it.
+// Numbers are decoded as float64. If the decode type is DecodeTypeUnknown, then
+// the type is sniffed from the data. Protocol buffers need the type of their
+// message, so DecodeTypeProtobuf is not supported. Empty data has no records.
+func DecodeRecords(data []byte, decodeType DecodeType) ([]map[string]interface{}, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+
+	if decodeType == DecodeTypeUnknown {
+		decodeType = sniffDecodeType(data)
+	}
+
+	var decFunc DecodeFunc
+
+	switch decodeType {
+	case DecodeTypeJSON:
+		decFunc = decodeFuncJSONFromBytes(data)
+	case DecodeTypeCSV:
+		decFunc = decodeFuncCSV(data, ',', DuplicateHeaderLast)
+	case DecodeTypeTSV:
+		decFunc = decodeFuncCSV(data, '\t', DuplicateHeaderLast)
+	case DecodeTypeJSONP:
+		decFunc = decodeFuncJSONP(data)
+	case DecodeTypeUnknown, DecodeTypeProtobuf:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedDecodeType, decodeType)
+	}
+
+	list := &structpb.ListValue{}
+	if err := decFunc(list); err != nil {
+		return nil, err
+	}
+
+	records := make([]map[string]interface{}, len(list.GetValues()))
+
+	for idx, val := range list.GetValues() {
+		if record := val.GetStructValue(); record != nil {
+			records[idx] = record.AsMap()
+
+			continue
+		}
+
+		records[idx] = map[string]interface{}{tableValueColumn: val.AsInterface()}
+	}
+
+	return records, nil
+}
+
+// DecodeRecordsFrom will decode the records read from r one at a time, calling
+// fn with each, so that a large body can be decoded without reading it into
+// memory. The records are the same as those of DecodeRecords, but the type
+// cannot be sniffed from a stream, so DecodeTypeUnknown is not supported, and
+// nor is DecodeTypeJSONP, since the end of its callback is only found at the
+// end of the data. If fn returns an error, then decoding stops and the error
+// is returned.
+func DecodeRecordsFrom(r io.Reader, decodeType DecodeType, fn func(record map[string]interface{}) error) error {
+	switch decodeType {
+	case DecodeTypeJSON:
+		return decodeJSONRecordsFrom(r, fn)
+	case DecodeTypeCSV:
+		return decodeCSVRecordsFrom(newDelimitedReader(r, ','), fn)
+	case DecodeTypeTSV:
+		return decodeCSVRecordsFrom(newDelimitedReader(r, '\t'), fn)
+	case DecodeTypeUnknown, DecodeTypeProtobuf, DecodeTypeJSONP:
+	}
+
+	return fmt.Errorf("%w: %d", ErrUnsupportedDecodeType, decodeType)
+}
+
+// decodeJSONRecordsFrom will decode each top-level JSON object, and each
+// element of each top-level JSON array, as a record. Only a single record is
+// held in memory at a time.
+func decodeJSONRecordsFrom(r io.Reader, fn func(record map[string]interface{}) error) error {
+	dec := json.NewDecoder(r)
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to decode json: %w", err)
+		}
+
+		switch tok {
+		case json.Delim('['):
+			if err := decodeJSONElementsFrom(dec, fn); err != nil {
+				return err
+			}
+		case json.Delim('{'):
+			record, err := decodeJSONObjectFrom(dec)
+			if err != nil {
+				return err
+			}
+
+			if err := fn(record); err != nil {
+				return err
+			}
+
+			continue
+		default:
+			return fmt.Errorf("%w: %T", ErrUnsupportedProtobufType, tok)
+		}
+
+		// Consume the closing bracket of the array.
+		if _, err := dec.Token(); err != nil {
+			return fmt.Errorf("failed to decode json: %w", err)
+		}
+	}
+}
+
+// decodeJSONElementsFrom will decode each element of a JSON array whose opening
+// bracket has been read as a record, up to but not including its closing
+// bracket.
+func decodeJSONElementsFrom(dec *json.Decoder, fn func(record map[string]interface{}) error) error {
+	for dec.More() {
+		var val interface{}
+		if err := dec.Decode(&val); err != nil {
+			return fmt.Errorf("failed to decode json: %w", err)
+		}
+
+		record, ok := val.(map[string]interface{})
+		if !ok {
+			record = map[string]interface{}{tableValueColumn: val}
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DecodeJSONRecordsAt will decode the records of the value at the path of the
+// JSON document read from r one at a time, calling fn with each, e.g. the
+// elements of the "data" array of {"meta": {...}, "data": [...]}. The path is a
+// sequence of object keys and array indices separated by dots, e.g.
+// "result.items" or "pages.0.items", and an empty path is the document itself.
+// The records of the value are the same as those of DecodeRecordsFrom: each
+// element of an array, or an object itself.
+//
+// The document is read as a stream of tokens, so that however large it is,
+// only a single record is held in memory at a time: the values before the path
+// are skipped token by token, rather than decoded, and nothing after the value
+// at the path is read. If the path is not in the document, then an
+// ErrRecordsPath error is returned. If fn returns an error, then decoding stops
+// and the error is returned.
+func DecodeJSONRecordsAt(r io.Reader, path string, fn func(record map[string]interface{}) error) error {
+	dec := json.NewDecoder(r)
+
+	if path != "" {
+		for _, segment := range strings.Split(path, ".") {
+			found, err := seekJSONPath(dec, segment)
+			if err != nil {
+				return err
+			}
+
+			if !found {
+				return fmt.Errorf("%w: %q", ErrRecordsPath, path)
+			}
+		}
+	}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("failed to decode json: %w", err)
+	}
+
+	switch tok {
+	case json.Delim('['):
+		return decodeJSONElementsFrom(dec, fn)
+	case json.Delim('{'):
+		record, err := decodeJSONObjectFrom(dec)
+		if err != nil {
+			return err
+		}
+
+		return fn(record)
+	}
+
+	return fn(map[string]interface{}{tableValueColumn: tok})
+}
+
+// seekJSONPath will read the next value of the decoder up to the value of the
+// segment, i.e. the value of the key in an object, or the element at the index
+// in an array, returning false if there is no such value. The values before it
+// are skipped.
+func seekJSONPath(dec *json.Decoder, segment string) (bool, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return false, fmt.Errorf("failed to decode json: %w", err)
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return false, fmt.Errorf("failed to decode json: %w", err)
+			}
+
+			if key, _ := keyTok.(string); key == segment {
+				return true, nil
+			}
+
+			if err := skipJSONValue(dec); err != nil {
+				return false, err
+			}
+		}
+	case json.Delim('['):
+		index, err := strconv.Atoi(segment)
+		if err != nil || index < 0 {
+			return false, nil
+		}
+
+		for idx := 0; dec.More(); idx++ {
+			if idx == index {
+				return true, nil
+			}
+
+			if err := skipJSONValue(dec); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// skipJSONValue will read the next value of the decoder without decoding it,
+// one token at a time, so that a large value is not held in memory.
+func skipJSONValue(dec *json.Decoder) error {
+	depth := 0
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to decode json: %w", err)
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// decodeJSONObjectFrom will decode the fields of a JSON object whose opening
+// brace has been read, up to and including its closing brace.
+func decodeJSONObjectFrom(dec *json.Decoder) (map[string]interface{}, error) {
+	record := map[string]interface{}{}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode json: %w", err)
+		}
+
+		key, _ := tok.(string)
+
+		var val interface{}
+		if err := dec.Decode(&val); err != nil {
+			return nil, fmt.Errorf("failed to decode json: %w", err)
+		}
+
+		record[key] = val
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("failed to decode json: %w", err)
+	}
+
+	return record, nil
+}
+
+// decodeCSVRecordsFrom will decode each row read by the reader as a record
+// keyed by the header row.
+func decodeCSVRecordsFrom(reader *csv.Reader, fn func(record map[string]interface{}) error) error {
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to decode csv header: %w", err)
+	}
+
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to decode csv: %w", err)
+		}
+
+		record := make(map[string]interface{}, len(header))
+		for idx, key := range header {
+			record[key] = row[idx]
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
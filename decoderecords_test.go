@@ -0,0 +1,339 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDecodeRecords(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name       string
+		data       string
+		decodeType DecodeType
+		want       []map[string]interface{}
+		wantErr    error
+	}{
+		{
+			name:       "json object",
+			data:       `{"id":1,"tags":["a"]}`,
+			decodeType: DecodeTypeJSON,
+			want:       []map[string]interface{}{{"id": 1.0, "tags": []interface{}{"a"}}},
+		},
+		{
+			name:       "json array",
+			data:       `[{"id":1},{"id":2}]`,
+			decodeType: DecodeTypeJSON,
+			want:       []map[string]interface{}{{"id": 1.0}, {"id": 2.0}},
+		},
+		{
+			name:       "json array of scalars",
+			data:       `[1,"a",null]`,
+			decodeType: DecodeTypeJSON,
+			want:       []map[string]interface{}{{"value": 1.0}, {"value": "a"}, {"value": nil}},
+		},
+		{
+			name:       "ndjson",
+			data:       "{\"id\":1}\n{\"id\":2}\n",
+			decodeType: DecodeTypeJSON,
+			want:       []map[string]interface{}{{"id": 1.0}, {"id": 2.0}},
+		},
+		{
+			name:       "csv",
+			data:       "id,name\n1,a\n2,b\n",
+			decodeType: DecodeTypeCSV,
+			want:       []map[string]interface{}{{"id": "1", "name": "a"}, {"id": "2", "name": "b"}},
+		},
+		{
+			name:       "tsv",
+			data:       "id\tname\n1\ta\"b\n",
+			decodeType: DecodeTypeTSV,
+			want:       []map[string]interface{}{{"id": "1", "name": `a"b`}},
+		},
+		{
+			name:       "empty",
+			data:       " \n",
+			decodeType: DecodeTypeJSON,
+		},
+		{
+			name:       "json top-level scalar",
+			data:       `1`,
+			decodeType: DecodeTypeJSON,
+			wantErr:    ErrUnsupportedProtobufType,
+		},
+		{
+			name:       "protobuf",
+			data:       "\x08\x01",
+			decodeType: DecodeTypeProtobuf,
+			wantErr:    ErrUnsupportedDecodeType,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := DecodeRecords([]byte(tcase.data), tcase.decodeType)
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(got, tcase.want) {
+				t.Errorf("expected records %v, got %v", tcase.want, got)
+			}
+
+			// The streaming variant decodes the same records.
+			var streamed []map[string]interface{}
+
+			err = DecodeRecordsFrom(strings.NewReader(tcase.data), tcase.decodeType,
+				func(record map[string]interface{}) error {
+					streamed = append(streamed, record)
+
+					return nil
+				})
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected streaming error %v, got %v", tcase.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(streamed, tcase.want) {
+				t.Errorf("expected streamed records %v, got %v", tcase.want, streamed)
+			}
+		})
+	}
+}
+
+func TestDecodeRecordsSniff(t *testing.T) {
+	t.Parallel()
+
+	got, err := DecodeRecords([]byte("id,name\n1,a\n"), DecodeTypeUnknown)
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+
+	if want := []map[string]interface{}{{"id": "1", "name": "a"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected records %v, got %v", want, got)
+	}
+
+	// The type of a stream cannot be sniffed.
+	err = DecodeRecordsFrom(strings.NewReader("id\n1\n"), DecodeTypeUnknown,
+		func(map[string]interface{}) error { return nil })
+	if !errors.Is(err, ErrUnsupportedDecodeType) {
+		t.Errorf("expected %v, got %v", ErrUnsupportedDecodeType, err)
+	}
+}
+
+func TestDecodeRecordsFromStop(t *testing.T) {
+	t.Parallel()
+
+	errStop := errors.New("stop")
+	calls := 0
+
+	err := DecodeRecordsFrom(strings.NewReader(`[{"id":1},{"id":2},{"id":3}]`), DecodeTypeJSON,
+		func(map[string]interface{}) error {
+			calls++
+
+			return errStop
+		})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("expected %v, got %v", errStop, err)
+	}
+
+	if calls != 1 {
+		t.Errorf("expected decoding to stop after 1 record, got %d", calls)
+	}
+}
+
+func TestDecodeJSONRecordsAt(t *testing.T) {
+	t.Parallel()
+
+	const doc = `{"meta":{"count":2,"data":[{"id":0}]},"data":[{"id":1},{"id":2},3],` +
+		`"pages":[{"items":[{"id":4}]},{"items":[{"id":5}]}],"next":null}`
+
+	for _, tcase := range []struct {
+		name    string
+		path    string
+		want    []map[string]interface{}
+		wantErr error
+	}{
+		{
+			name: "array",
+			path: "data",
+			want: []map[string]interface{}{{"id": 1.0}, {"id": 2.0}, {"value": 3.0}},
+		},
+		{
+			name: "object",
+			path: "meta",
+			want: []map[string]interface{}{{"count": 2.0, "data": []interface{}{map[string]interface{}{"id": 0.0}}}},
+		},
+		{
+			name: "nested",
+			path: "meta.data",
+			want: []map[string]interface{}{{"id": 0.0}},
+		},
+		{
+			name: "array index",
+			path: "pages.1.items",
+			want: []map[string]interface{}{{"id": 5.0}},
+		},
+		{
+			name: "scalar",
+			path: "next",
+			want: []map[string]interface{}{{"value": nil}},
+		},
+		{
+			name: "document",
+			path: "",
+			want: []map[string]interface{}{{"id": 1.0}, {"id": 2.0}},
+		},
+		{
+			name:    "missing key",
+			path:    "results",
+			wantErr: ErrRecordsPath,
+		},
+		{
+			name:    "missing index",
+			path:    "pages.2.items",
+			wantErr: ErrRecordsPath,
+		},
+		{
+			name:    "key of scalar",
+			path:    "data.2.id",
+			wantErr: ErrRecordsPath,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			data := doc
+			if tcase.path == "" {
+				data = `[{"id":1},{"id":2}]`
+			}
+
+			var got []map[string]interface{}
+
+			err := DecodeJSONRecordsAt(strings.NewReader(data), tcase.path, func(record map[string]interface{}) error {
+				got = append(got, record)
+
+				return nil
+			})
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected %v, got %v", tcase.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(got, tcase.want) {
+				t.Errorf("expected %v, got %v", tcase.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONRecordsAtStops(t *testing.T) {
+	t.Parallel()
+
+	// The rest of the document is invalid, so it must not be read once the
+	// records have been decoded.
+	data := `{"data":[{"id":1},{"id":2}],"rest":` + strings.Repeat("x", 1<<10)
+
+	calls := 0
+
+	err := DecodeJSONRecordsAt(strings.NewReader(data), "data", func(map[string]interface{}) error {
+		calls++
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to decode records: %v", err)
+	}
+
+	if calls != 2 {
+		t.Errorf("expected 2 records, got %d", calls)
+	}
+}
+
+// recordsReader is a reader of a JSON document with a "meta" object of n
+// records and a "data" array of n records, generated as it is read so that the
+// document is never held in memory.
+func recordsReader(n int) io.Reader {
+	elements := func(prefix string) io.Reader {
+		pr, pw := io.Pipe()
+
+		go func() {
+			for idx := 0; idx < n; idx++ {
+				sep := ","
+				if idx == 0 {
+					sep = ""
+				}
+
+				_, err := fmt.Fprintf(pw, `%s{"%s":%d,"name":"record","tags":["a","b"]}`, sep, prefix, idx)
+				if err != nil {
+					return
+				}
+			}
+
+			pw.Close()
+		}()
+
+		return pr
+	}
+
+	return io.MultiReader(
+		strings.NewReader(`{"meta":{"skipped":[`), elements("skip"),
+		strings.NewReader(`]},"data":[`), elements("id"),
+		strings.NewReader(`]}`))
+}
+
+// BenchmarkDecodeJSONRecordsAt reports the peak heap in use while decoding
+// documents of growing size, which stays flat since only one record is held at
+// a time.
+func BenchmarkDecodeJSONRecordsAt(b *testing.B) {
+	for _, size := range []int{1e3, 1e4, 1e5} {
+		size := size
+
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			var peak uint64
+
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+
+				var stats runtime.MemStats
+
+				calls := 0
+
+				err := DecodeJSONRecordsAt(recordsReader(size), "data", func(map[string]interface{}) error {
+					if calls++; calls%(size/10) == 0 {
+						runtime.ReadMemStats(&stats)
+						peak = max(peak, stats.HeapInuse)
+					}
+
+					return nil
+				})
+				if err != nil {
+					b.Fatalf("failed to decode records: %v", err)
+				}
+
+				if calls != size {
+					b.Fatalf("expected %d records, got %d", size, calls)
+				}
+			}
+
+			b.ReportMetric(float64(peak)/(1<<20), "peak-heap-MiB")
+		})
+	}
+}
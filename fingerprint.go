@@ -0,0 +1,78 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// WithFingerprint will set the field on every record of the request to a hash
+// of the record, and identify the records by that field in place of any set
+// with WithIDFields, for records that have no natural key. Since the hash only
+// depends on the fields and values of the record, writing the same record
+// again resolves to the same key, so a writer that upserts on the ID fields
+// makes a re-run a no-op rather than a source of duplicates.
+//
+// The hash is the hex-encoded SHA-256 of the record's JSON with its keys
+// sorted, taken once the record has been flattened and labeled, see WithFlatten
+// and WithLabels, and without the field itself, which is overwritten. Values of
+// the list that are not records are left as they are.
+func WithFingerprint(field string) RequestOption {
+	return func(req *Request) {
+		req.fingerprint = field
+	}
+}
+
+// writeIDFields will return the fields that identify the records of the
+// request to the list writers.
+func (req *Request) writeIDFields() []string {
+	if req.fingerprint != "" {
+		return []string{req.fingerprint}
+	}
+
+	return req.idFields
+}
+
+// fingerprintList will set the field on every record in the list to the
+// fingerprint of the record.
+func fingerprintList(list *structpb.ListValue, field string) error {
+	if field == "" {
+		return nil
+	}
+
+	for _, val := range list.Values {
+		record := val.GetStructValue()
+		if record == nil {
+			continue
+		}
+
+		if record.Fields == nil {
+			record.Fields = make(map[string]*structpb.Value, 1)
+		}
+
+		delete(record.Fields, field)
+
+		// Maps are marshaled with their keys sorted, so the JSON of a
+		// record does not depend on the order of its fields.
+		data, err := json.Marshal(record.AsMap())
+		if err != nil {
+			return fmt.Errorf("failed to fingerprint record: %w", err)
+		}
+
+		sum := sha256.Sum256(data)
+		record.Fields[field] = structpb.NewStringValue(hex.EncodeToString(sum[:]))
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// mockUpsertByIDWriter is a ListWriter that upserts records keyed by the
+// values of the ID fields in the context, like a table with a primary key.
+type mockUpsertByIDWriter struct {
+	mtx  sync.Mutex
+	rows map[string]map[string]interface{}
+}
+
+func (m *mockUpsertByIDWriter) Write(ctx context.Context, list *structpb.ListValue) error {
+	fields, ok := IDFieldsFromContext(ctx)
+	if !ok {
+		return errors.New("no ID fields")
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.rows == nil {
+		m.rows = make(map[string]map[string]interface{})
+	}
+
+	for _, val := range list.Values {
+		record := val.GetStructValue().AsMap()
+
+		key := make([]string, len(fields))
+		for idx, field := range fields {
+			key[idx] = fmt.Sprint(record[field])
+		}
+
+		m.rows[strings.Join(key, "/")] = record
+	}
+
+	return nil
+}
+
+func TestHTTPServiceFingerprint(t *testing.T) {
+	t.Parallel()
+
+	// The records have no natural key, and the same trade appears twice
+	// with its fields in a different order.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"price":1.5,"size":2},{"size":2,"price":1.5},{"price":3,"size":1}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	writer := &mockUpsertByIDWriter{}
+
+	svc.HTTP.Requests(newTestServerRequest(t, server.URL,
+		WithWriters(writer),
+		WithIDFields("id"),
+		WithLabels(map[string]string{"source": "test"}),
+		WithFingerprint("_fingerprint")))
+
+	// Storing the same data again does not add any rows.
+	for run := 0; run < 2; run++ {
+		if err := svc.HTTP.Store(context.Background()); err != nil {
+			t.Fatalf("failed to store: %v", err)
+		}
+
+		if len(writer.rows) != 2 {
+			t.Errorf("expected 2 rows after run %d, got %d", run+1, len(writer.rows))
+		}
+	}
+
+	for key, row := range writer.rows {
+		if row["_fingerprint"] != key || len(key) != 64 {
+			t.Errorf("expected the fingerprint to be the key, got %q for %q", row["_fingerprint"], key)
+		}
+
+		if row["source"] != "test" {
+			t.Errorf("expected the labels to be kept, got %v", row)
+		}
+	}
+}
+
+func TestFingerprintList(t *testing.T) {
+	t.Parallel()
+
+	newList := func(record map[string]interface{}) *structpb.ListValue {
+		list, err := structpb.NewList([]interface{}{record, "scalar"})
+		if err != nil {
+			t.Fatalf("failed to create list: %v", err)
+		}
+
+		return list
+	}
+
+	// A stale fingerprint is not part of the hash.
+	first := newList(map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": true}})
+	second := newList(map[string]interface{}{"b": map[string]interface{}{"c": true}, "a": 1, "fp": "stale"})
+	other := newList(map[string]interface{}{"a": 2, "b": map[string]interface{}{"c": true}})
+
+	for _, list := range []*structpb.ListValue{first, second, other} {
+		if err := fingerprintList(list, "fp"); err != nil {
+			t.Fatalf("failed to fingerprint: %v", err)
+		}
+
+		if got := list.Values[1].GetStringValue(); got != "scalar" {
+			t.Errorf("expected the scalar to be left as it is, got %q", got)
+		}
+	}
+
+	fingerprint := func(list *structpb.ListValue) string {
+		return list.Values[0].GetStructValue().Fields["fp"].GetStringValue()
+	}
+
+	if fingerprint(first) != fingerprint(second) {
+		t.Errorf("expected equal records to have the same fingerprint")
+	}
+
+	if fingerprint(first) == fingerprint(other) {
+		t.Errorf("expected different records to have different fingerprints")
+	}
+}
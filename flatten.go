@@ -0,0 +1,133 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"sort"
+	"strconv"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// defaultFlattenSeparator is the separator used to join the keys of flattened
+// records, if the request does not set one.
+const defaultFlattenSeparator = "_"
+
+// WithFlatten will flatten the nested objects and lists of each record before
+// it is written, e.g. for relational targets that cannot store a nested object
+// in a column. The keys of a nested value are joined to the key of its parent
+// with a separator, "_" by default, and lists are indexed:
+//
+//	{"a": {"b": 1}, "items": [{"name": "x"}]}
+//
+// is flattened to
+//
+//	{"a_b": 1, "items_0_name": "x"}
+//
+// Empty objects and lists are kept as they are. If a flattened key collides
+// with a key that is already at the top level of the record, then the top-level
+// value is kept. If two flattened keys collide with each other, then the value
+// whose top-level key sorts first is kept.
+func WithFlatten() RequestOption {
+	return func(req *Request) {
+		req.flatten = true
+
+		if req.flattenSep == "" {
+			req.flattenSep = defaultFlattenSeparator
+		}
+	}
+}
+
+// WithFlattenSeparator will flatten each record using the separator to join
+// the keys, see WithFlatten.
+func WithFlattenSeparator(sep string) RequestOption {
+	return func(req *Request) {
+		req.flatten = true
+		req.flattenSep = sep
+	}
+}
+
+// flattenList will flatten every record in the list, see WithFlatten.
+func flattenList(list *structpb.ListValue, sep string) {
+	for _, val := range list.Values {
+		if record := val.GetStructValue(); record != nil {
+			val.Kind = &structpb.Value_StructValue{StructValue: flattenStruct(record, sep)}
+		}
+	}
+}
+
+// flattenStruct will return a flattened copy of the record.
+func flattenStruct(record *structpb.Struct, sep string) *structpb.Struct {
+	flat := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(record.Fields))}
+
+	// Top-level values that do not need to be flattened are set first, so
+	// that they take precedence over any colliding flattened keys.
+	keys := make([]string, 0, len(record.Fields))
+
+	for key, val := range record.Fields {
+		if isFlattenable(val) {
+			keys = append(keys, key)
+
+			continue
+		}
+
+		flat.Fields[key] = val
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		flattenValue(flat.Fields, key, record.Fields[key], sep)
+	}
+
+	return flat
+}
+
+// isFlattenable will return true if the value is a non-empty object or list.
+func isFlattenable(val *structpb.Value) bool {
+	switch kind := val.Kind.(type) {
+	case *structpb.Value_StructValue:
+		return len(kind.StructValue.Fields) > 0
+	case *structpb.Value_ListValue:
+		return len(kind.ListValue.Values) > 0
+	default:
+		return false
+	}
+}
+
+// flattenValue will set the leaves of the value on the fields, with keys
+// prefixed by the given key. A key that is already set is not overwritten.
+func flattenValue(fields map[string]*structpb.Value, prefix string, val *structpb.Value, sep string) {
+	if !isFlattenable(val) {
+		if _, ok := fields[prefix]; !ok {
+			fields[prefix] = val
+		}
+
+		return
+	}
+
+	if obj := val.GetStructValue(); obj != nil {
+		keys := make([]string, 0, len(obj.Fields))
+		for key := range obj.Fields {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			flattenValue(fields, prefix+sep+key, obj.Fields[key], sep)
+		}
+
+		return
+	}
+
+	for idx, elem := range val.GetListValue().Values {
+		flattenValue(fields, prefix+sep+strconv.Itoa(idx), elem, sep)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestFlattenStruct(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name   string
+		sep    string
+		record map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{
+			name:   "flat",
+			record: map[string]interface{}{"a": 1.0, "b": "x"},
+			want:   map[string]interface{}{"a": 1.0, "b": "x"},
+		},
+		{
+			name:   "nested object",
+			record: map[string]interface{}{"a": map[string]interface{}{"b": 1.0}},
+			want:   map[string]interface{}{"a_b": 1.0},
+		},
+		{
+			name: "deep nesting",
+			record: map[string]interface{}{
+				"a": map[string]interface{}{
+					"b": map[string]interface{}{
+						"c": map[string]interface{}{"d": true},
+						"e": nil,
+					},
+				},
+			},
+			want: map[string]interface{}{"a_b_c_d": true, "a_b_e": nil},
+		},
+		{
+			name: "list of objects",
+			record: map[string]interface{}{
+				"items": []interface{}{
+					map[string]interface{}{"name": "x", "tags": []interface{}{"t1", "t2"}},
+					map[string]interface{}{"name": "y"},
+				},
+			},
+			want: map[string]interface{}{
+				"items_0_name":   "x",
+				"items_0_tags_0": "t1",
+				"items_0_tags_1": "t2",
+				"items_1_name":   "y",
+			},
+		},
+		{
+			name:   "empty object and list",
+			record: map[string]interface{}{"a": map[string]interface{}{}, "b": []interface{}{}},
+			want:   map[string]interface{}{"a": map[string]interface{}{}, "b": []interface{}{}},
+		},
+		{
+			name:   "custom separator",
+			sep:    ".",
+			record: map[string]interface{}{"a": map[string]interface{}{"b": []interface{}{1.0}}},
+			want:   map[string]interface{}{"a.b.0": 1.0},
+		},
+		{
+			name: "top-level key takes precedence",
+			record: map[string]interface{}{
+				"a":   map[string]interface{}{"b": "nested"},
+				"a_b": "top",
+			},
+			want: map[string]interface{}{"a_b": "top"},
+		},
+		{
+			name: "first sorted key takes precedence",
+			record: map[string]interface{}{
+				"a":   map[string]interface{}{"b_c": "first"},
+				"a_b": map[string]interface{}{"c": "second"},
+			},
+			want: map[string]interface{}{"a_b_c": "first"},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			record, err := structpb.NewStruct(tcase.record)
+			if err != nil {
+				t.Fatalf("failed to create record: %v", err)
+			}
+
+			sep := tcase.sep
+			if sep == "" {
+				sep = defaultFlattenSeparator
+			}
+
+			if got := flattenStruct(record, sep).AsMap(); !reflect.DeepEqual(got, tcase.want) {
+				t.Errorf("expected %v, got %v", tcase.want, got)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceFlatten(t *testing.T) {
+	t.Parallel()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	writer := &mockListWriter{}
+
+	reqs := newHTTPRequests(1)
+	reqs[0].writers = []ListWriter{writer}
+	WithFlattenSeparator("__")(reqs[0])
+
+	svc.HTTP.Requests(reqs...)
+	svc.HTTP.client = newMockHTTPClient(withMockHTTPClientResponseBody(reqs[0],
+		[]byte(`[{"id":1,"meta":{"tags":["a"]}},{"id":2}]`)))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	if len(writer.data) != 1 {
+		t.Fatalf("expected 1 write, got %d", len(writer.data))
+	}
+
+	list := &structpb.ListValue{}
+	if err := list.UnmarshalJSON(writer.data[0]); err != nil {
+		t.Fatalf("failed to unmarshal written data: %v", err)
+	}
+
+	want := []interface{}{
+		map[string]interface{}{"id": 1.0, "meta__tags__0": "a"},
+		map[string]interface{}{"id": 2.0},
+	}
+
+	if got := list.AsSlice(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
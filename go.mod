@@ -1,10 +1,11 @@
 module github.com/alpstable/gidari
 
-go 1.19
+go 1.21
 
 require (
 	golang.org/x/time v0.3.0
 	google.golang.org/protobuf v1.28.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
@@ -0,0 +1,255 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// ErrNoGRPCConn is returned when the gRPC Service has requests but no
+// connection to make them with.
+var ErrNoGRPCConn = errors.New("no gRPC connection")
+
+// ErrNotServerStreaming is returned when a gRPC request is for a method that
+// does not stream its responses.
+var ErrNotServerStreaming = errors.New("gRPC method is not server-streaming")
+
+// GRPCStream is the receiving side of a server-streaming gRPC call. The
+// "grpc.ClientStream" type satisfies this interface. "RecvMsg" must return
+// io.EOF once the stream has completed successfully.
+type GRPCStream interface {
+	RecvMsg(m any) error
+}
+
+// GRPCConn is used to start server-streaming gRPC calls. The method is the
+// full method name, e.g. "/package.Service/Method". An implementation for a
+// "*grpc.ClientConn" will typically create the stream with "NewStream", send
+// the request message with "SendMsg", and then call "CloseSend".
+type GRPCConn interface {
+	NewServerStream(ctx context.Context, method string, req proto.Message) (GRPCStream, error)
+}
+
+// GRPCRequest is a server-streaming gRPC call, each of whose response messages
+// is written to the list writers as a record.
+type GRPCRequest struct {
+	method    protoreflect.MethodDescriptor
+	msg       proto.Message
+	writers   []ListWriter
+	writeMode WriteMode
+}
+
+// GRPCRequestOption is used to set an option on a gRPC request.
+type GRPCRequestOption func(*GRPCRequest)
+
+// NewGRPCRequest will create a new gRPC request for the server-streaming
+// method, sending the request message.
+func NewGRPCRequest(method protoreflect.MethodDescriptor, msg proto.Message,
+	opts ...GRPCRequestOption,
+) *GRPCRequest {
+	req := &GRPCRequest{method: method, msg: msg}
+
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+
+		opt(req)
+	}
+
+	return req
+}
+
+// WithGRPCWriters sets the optional writers to be used by the gRPC Service to
+// write the response messages of the request.
+func WithGRPCWriters(writers ...ListWriter) GRPCRequestOption {
+	return func(req *GRPCRequest) {
+		req.writers = writers
+	}
+}
+
+// WithGRPCWriteMode sets how failures across the request's writers are handled,
+// see WithWriteMode.
+func WithGRPCWriteMode(mode WriteMode) GRPCRequestOption {
+	return func(req *GRPCRequest) {
+		req.writeMode = mode
+	}
+}
+
+// fullMethod will return the full name of the request's method, as used by
+// gRPC.
+func (req *GRPCRequest) fullMethod() string {
+	return fmt.Sprintf("/%s/%s", req.method.Parent().FullName(), req.method.Name())
+}
+
+// newResponse will return an empty response message for the request's method.
+// The generated type is used if it is registered, otherwise the message is a
+// dynamic message built from the method descriptor.
+func (req *GRPCRequest) newResponse() proto.Message {
+	output := req.method.Output()
+
+	msgType, err := protoregistry.GlobalTypes.FindMessageByName(output.FullName())
+	if err != nil {
+		return dynamicpb.NewMessage(output)
+	}
+
+	return msgType.New().Interface()
+}
+
+// GRPCService is a service that will make server-streaming gRPC calls and send
+// each response message to the list writers of the request.
+type GRPCService struct {
+	svc *Service
+
+	conn     GRPCConn
+	requests []*GRPCRequest
+}
+
+// NewGRPCService will create a new gRPC Service.
+func NewGRPCService(svc *Service) *GRPCService {
+	return &GRPCService{svc: svc}
+}
+
+// Conn sets the connection used to make the gRPC calls.
+func (svc *GRPCService) Conn(conn GRPCConn) *GRPCService {
+	svc.conn = conn
+
+	return svc
+}
+
+// Requests sets the gRPC requests that the service will make.
+func (svc *GRPCService) Requests(reqs ...*GRPCRequest) *GRPCService {
+	svc.requests = reqs
+
+	return svc
+}
+
+// logger will return the logger of the underlying service, if any.
+func (svc *GRPCService) logger() *slog.Logger {
+	if svc.svc == nil {
+		return nil
+	}
+
+	return svc.svc.logger
+}
+
+// Store will concurrently make the gRPC calls and write each of the streamed
+// response messages to the request's list writers. This method will block
+// until every stream has completed, an error occurs, or the context is
+// canceled, and then until every list has been written and every writer that
+// implements Flusher has been flushed.
+func (svc *GRPCService) Store(ctx context.Context) error {
+	// If there are no requests, do nothing.
+	if len(svc.requests) == 0 {
+		return nil
+	}
+
+	if svc.conn == nil {
+		return ErrNoGRPCConn
+	}
+
+	if svc.svc != nil {
+		ctx = contextWithRunID(ctx, svc.svc.runID)
+	}
+
+	// Verify that the storage is reachable before making any calls.
+	writers := []ListWriter{}
+	for _, req := range svc.requests {
+		writers = append(writers, req.writers...)
+	}
+
+	if err := pingWriters(ctx, writers); err != nil {
+		return err
+	}
+
+	listWriterCh := startListWriter(ctx, defaultWriteBuffer)
+
+	// Bound the number of concurrent streams by the number of workers.
+	sem := make(chan struct{}, workerCount())
+	errs := make(chan error, len(svc.requests))
+
+	var wg sync.WaitGroup
+
+	for _, req := range svc.requests {
+		wg.Add(1)
+
+		go func(req *GRPCRequest) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := svc.stream(ctx, req, listWriterCh.jobs); err != nil {
+				errs <- err
+			}
+		}(req)
+	}
+
+	// Close the jobs channel once every stream has completed, and then
+	// wait for the list writer to finish writing the messages.
+	wg.Wait()
+	close(listWriterCh.jobs)
+	close(errs)
+
+	writeErr := <-listWriterCh.err
+
+	if err := <-errs; err != nil {
+		return fmt.Errorf("failed to stream: %w", err)
+	}
+
+	if writeErr != nil {
+		return fmt.Errorf("error in upsert worker: %w", writeErr)
+	}
+
+	return nil
+}
+
+// stream will make the gRPC call and send each response message to the list
+// writer.
+func (svc *GRPCService) stream(ctx context.Context, req *GRPCRequest, jobs chan<- listWriterJob) error {
+	method := req.fullMethod()
+
+	if !req.method.IsStreamingServer() {
+		return fmt.Errorf("%w: %q", ErrNotServerStreaming, method)
+	}
+
+	stream, err := svc.conn.NewServerStream(ctx, method, req.msg)
+	if err != nil {
+		return fmt.Errorf("failed to start stream %q: %w", method, err)
+	}
+
+	for {
+		msg := req.newResponse()
+
+		if err := stream.RecvMsg(msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return fmt.Errorf("failed to receive from %q: %w", method, err)
+		}
+
+		jobs <- listWriterJob{
+			decFunc: decodeFuncProtoMessage(msg),
+			writers: req.writers,
+			mode:    req.writeMode,
+			logger:  svc.logger(),
+			url:     method,
+		}
+	}
+}
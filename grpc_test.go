@@ -0,0 +1,228 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var errStreamFailed = errors.New("stream failed")
+
+// newTestFeedService will return the descriptor of a test service with
+// server-streaming methods that return a registered type (Struct) and an
+// unregistered type (Record), and a unary method.
+func newTestFeedService(t *testing.T) protoreflect.ServiceDescriptor {
+	t.Helper()
+
+	const structType = ".google.protobuf.Struct"
+
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("gidari_test_feed.proto"),
+		Package:    proto.String("gidari.test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/struct.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Record"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("id"),
+				JsonName: proto.String("id"),
+				Number:   proto.Int32(1),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			}},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Feed"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{
+					Name:            proto.String("Stream"),
+					InputType:       proto.String(structType),
+					OutputType:      proto.String(structType),
+					ServerStreaming: proto.Bool(true),
+				},
+				{
+					Name:            proto.String("StreamRecords"),
+					InputType:       proto.String(structType),
+					OutputType:      proto.String(".gidari.test.Record"),
+					ServerStreaming: proto.Bool(true),
+				},
+				{
+					Name:       proto.String("Get"),
+					InputType:  proto.String(structType),
+					OutputType: proto.String(structType),
+				},
+			},
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("failed to create file descriptor: %v", err)
+	}
+
+	return file.Services().ByName("Feed")
+}
+
+// mockGRPCConn is a connection that streams the messages for each method,
+// followed by the error for the method (or io.EOF).
+type mockGRPCConn struct {
+	msgs map[string][]proto.Message
+	errs map[string]error
+}
+
+func (m *mockGRPCConn) NewServerStream(_ context.Context, method string, _ proto.Message) (GRPCStream, error) {
+	err := m.errs[method]
+	if err == nil {
+		err = io.EOF
+	}
+
+	return &mockGRPCStream{msgs: m.msgs[method], err: err}, nil
+}
+
+type mockGRPCStream struct {
+	msgs []proto.Message
+	err  error
+}
+
+func (m *mockGRPCStream) RecvMsg(msg any) error {
+	if len(m.msgs) == 0 {
+		return m.err
+	}
+
+	proto.Merge(msg.(proto.Message), m.msgs[0])
+	m.msgs = m.msgs[1:]
+
+	return nil
+}
+
+func TestGRPCServiceStore(t *testing.T) {
+	t.Parallel()
+
+	feed := newTestFeedService(t)
+
+	stream := feed.Methods().ByName("Stream")
+	streamRecords := feed.Methods().ByName("StreamRecords")
+
+	newStruct := func(id string) proto.Message {
+		msg, err := structpb.NewStruct(map[string]interface{}{"id": id})
+		if err != nil {
+			t.Fatalf("failed to create struct: %v", err)
+		}
+
+		return msg
+	}
+
+	newRecord := func(id string) proto.Message {
+		msg := dynamicpb.NewMessage(streamRecords.Output())
+		msg.Set(streamRecords.Output().Fields().ByName("id"), protoreflect.ValueOfString(id))
+
+		return msg
+	}
+
+	for _, tcase := range []struct {
+		name      string
+		method    protoreflect.MethodDescriptor
+		conn      *mockGRPCConn
+		noConn    bool
+		wantErr   error
+		wantCount int
+	}{
+		{
+			name:   "registered response type",
+			method: stream,
+			conn: &mockGRPCConn{msgs: map[string][]proto.Message{
+				"/gidari.test.Feed/Stream": {newStruct("1"), newStruct("2"), newStruct("3")},
+			}},
+			wantCount: 3,
+		},
+		{
+			name:   "dynamic response type",
+			method: streamRecords,
+			conn: &mockGRPCConn{msgs: map[string][]proto.Message{
+				"/gidari.test.Feed/StreamRecords": {newRecord("1"), newRecord("2")},
+			}},
+			wantCount: 2,
+		},
+		{
+			name:   "empty stream",
+			method: stream,
+			conn:   &mockGRPCConn{},
+		},
+		{
+			name:   "stream error",
+			method: stream,
+			conn: &mockGRPCConn{
+				msgs: map[string][]proto.Message{"/gidari.test.Feed/Stream": {newStruct("1")}},
+				errs: map[string]error{"/gidari.test.Feed/Stream": errStreamFailed},
+			},
+			wantErr:   errStreamFailed,
+			wantCount: 1,
+		},
+		{
+			name:    "unary method",
+			method:  feed.Methods().ByName("Get"),
+			conn:    &mockGRPCConn{},
+			wantErr: ErrNotServerStreaming,
+		},
+		{
+			name:    "no connection",
+			method:  stream,
+			noConn:  true,
+			wantErr: ErrNoGRPCConn,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			writer := &mockListWriter{}
+
+			svc.GRPC.Requests(NewGRPCRequest(tcase.method, &structpb.Struct{}, WithGRPCWriters(writer)))
+
+			if !tcase.noConn {
+				svc.GRPC.Conn(tcase.conn)
+			}
+
+			err = svc.GRPC.Store(context.Background())
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+
+			if writer.count != tcase.wantCount {
+				t.Fatalf("expected %d writes, got %d", tcase.wantCount, writer.count)
+			}
+
+			for _, data := range writer.data {
+				list := &structpb.ListValue{}
+				if err := list.UnmarshalJSON(data); err != nil {
+					t.Fatalf("failed to unmarshal written data: %v", err)
+				}
+
+				if len(list.Values) != 1 || list.Values[0].GetStructValue().Fields["id"] == nil {
+					t.Errorf("expected a single record with an id, got %s", data)
+				}
+			}
+		})
+	}
+}
@@ -9,25 +9,99 @@
 package gidari
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math/rand"
+	"mime/multipart"
 	"net/http"
-	"runtime"
+	"net/url"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/alpstable/gidari/third_party/accept"
+	"github.com/alpstable/gidari/auth"
 	"golang.org/x/time/rate"
+	"google.golang.org/protobuf/proto"
 )
 
+// ErrBodyTooLarge is returned when a response body exceeds the maximum number
+// of bytes allowed by the HTTP Service.
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// ErrMaxRequestsExceeded is returned when a run would make more requests than
+// the HTTP Service allows, see "HTTPService.MaxRequests".
+var ErrMaxRequestsExceeded = errors.New("maximum number of requests exceeded")
+
 // Request represents a request to be made by the service to the client.
 // This object wraps the "net/http" package request object.
 type Request struct {
 	http *http.Request
 
-	auth    func(*http.Request) (*http.Response, error) // round tripper
-	writers []ListWriter
+	auth      func(*http.Request) (*http.Response, error) // round tripper
+	writers   []ListWriter
+	writeMode WriteMode
+	priority  int
+	cost      int
+
+	// protoMessage is the type of message used to decode protocol
+	// buffer responses.
+	protoMessage proto.Message
+
+	// decodeType is the type used to decode every response, in place of
+	// the type found from the response, see WithDecodeType.
+	decodeType DecodeType
+
+	// duplicateHeaders decides how the columns of a CSV header with the
+	// same name are decoded, see WithDuplicateHeaders.
+	duplicateHeaders DuplicateHeaderPolicy
+
+	header   http.Header
+	paginate PaginationFunc
+	idFields []string
+
+	// contextFields describe the request to the list writers, see
+	// WithContextFields.
+	contextFields map[string]string
+
+	// sse is true if the response is a stream of server-sent events, see
+	// WithServerSentEvents.
+	sse bool
+
+	// fingerprint is the field set to the hash of each record, see
+	// WithFingerprint.
+	fingerprint string
+
+	// queueKey is the key of the request, or of the request whose page
+	// this is, in the persisted queue of the run, see "PersistQueue".
+	queueKey string
+
+	// checkpointKey is the key of the request, or of the request whose
+	// page this is, in the checkpoint store of the run, see "Checkpoint".
+	checkpointKey string
+
+	// validate checks each record before it is written, and the records
+	// that fail are written to invalidWriter, see WithValidator.
+	validate      RecordValidator
+	invalidWriter ListWriter
+
+	flatten    bool
+	flattenSep string
+
+	labels        map[string]string
+	labelConflict LabelConflict
+
+	// expectStatus are the status codes the responses are expected to
+	// have, see WithExpectStatus.
+	expectStatus []int
+
+	// bodyFunc generates the body of each attempt, see WithBodyFunc.
+	bodyFunc BodyFunc
 }
 
 // RequestOption is used to set an option on a request.
@@ -48,8 +122,87 @@ func NewHTTPRequest(req *http.Request, opts ...RequestOption) *Request {
 	return hreq
 }
 
+// NewFormRequest will create a new HTTP POST request with a form-encoded body
+// of the values, e.g. for an OAuth token endpoint. The request sets its
+// "Content-Type" and "Content-Length" headers, and can be retried, since its
+// body can be read more than once.
+func NewFormRequest(rawURL string, values url.Values, opts ...RequestOption) (*Request, error) {
+	body := values.Encode()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, rawURL,
+		strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create form request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return NewHTTPRequest(req, opts...), nil
+}
+
+// NewMultipartRequest will create a new HTTP POST request with a
+// "multipart/form-data" body of the fields and files, e.g. for an API that
+// processes an uploaded file and responds with the data. Each file is the part
+// of the form field of its key, and is named after it. The parts are written
+// in the order of their keys, with the fields first. The files are read into
+// memory when the request is created, so that the request can be retried, and
+// it sets its "Content-Type", including the boundary of the parts, and
+// "Content-Length" headers.
+func NewMultipartRequest(rawURL string, fields map[string]string, files map[string]io.Reader,
+	opts ...RequestOption,
+) (*Request, error) {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+
+	for _, name := range sortedKeys(fields) {
+		if err := form.WriteField(name, fields[name]); err != nil {
+			return nil, fmt.Errorf("failed to write multipart field %q: %w", name, err)
+		}
+	}
+
+	for _, name := range sortedKeys(files) {
+		part, err := form.CreateFormFile(name, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create multipart file %q: %w", name, err)
+		}
+
+		if _, err := io.Copy(part, files[name]); err != nil {
+			return nil, fmt.Errorf("failed to write multipart file %q: %w", name, err)
+		}
+	}
+
+	if err := form.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close multipart body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, rawURL,
+		bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multipart request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	return NewHTTPRequest(req, opts...), nil
+}
+
+// sortedKeys will return the keys of the map in order.
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
 // WithAuth will set a round tripper to be used by the service to authenticate
-// the request during the http transport.
+// the request during the http transport. The round tripper should make the
+// request over "auth.Transport", as those of the auth package do, which is the
+// transport of the service's client, so that the transport options of the
+// service, e.g. "TLSConfig" and "Proxy", apply to the authenticated request.
 func WithAuth(auth func(*http.Request) (*http.Response, error)) RequestOption {
 	return func(req *Request) {
 		req.auth = auth
@@ -64,6 +217,82 @@ func WithWriters(w ...ListWriter) RequestOption {
 	}
 }
 
+// WithWriteMode sets how a failure in one of the request's writers affects the
+// others, see WriteMode. By default, the data is written to every writer on a
+// best-effort basis.
+func WithWriteMode(mode WriteMode) RequestOption {
+	return func(req *Request) {
+		req.writeMode = mode
+	}
+}
+
+// WithPriority sets the priority of the request. Requests are made in phases,
+// in ascending order of priority: every request in a phase must complete
+// before any request in the next phase is made. Requests with the same
+// priority are made concurrently, so ordering is only guaranteed between
+// phases. A request is complete once its response has been received, which
+// does not imply that the response data has been written. All requests have a
+// priority of 0 by default.
+//
+// Note that phases limit concurrency, since a single slow request will delay
+// every request in the subsequent phases.
+func WithPriority(priority int) RequestOption {
+	return func(req *Request) {
+		req.priority = priority
+	}
+}
+
+// WithHeaders sets headers to add to the request just before it is made. These
+// headers take precedence over the headers set on the HTTP Service, and both
+// replace any header of the same name on the "http.Request".
+func WithHeaders(header http.Header) RequestOption {
+	return func(req *Request) {
+		if req.header == nil {
+			req.header = http.Header{}
+		}
+
+		for key, vals := range header {
+			req.header[http.CanonicalHeaderKey(key)] = vals
+		}
+	}
+}
+
+// WithAccept sets the "Accept" header of the request to the media type, e.g.
+// "text/csv", to ask a server that does content negotiation for a format. If
+// the server responds without a "Content-Type", or with one that does not
+// identify the format, such as "text/plain", then the response body is decoded
+// as the requested type. The media type may be a list with quality factors,
+// e.g. "text/csv, application/json;q=0.5", in which case the most preferred
+// type that can be decoded is used. This is a shorthand for setting the header
+// with WithHeaders.
+func WithAccept(mediaType string) RequestOption {
+	return WithHeaders(http.Header{"Accept": []string{mediaType}})
+}
+
+// WithProtoMessage registers the type of message used to decode the response
+// body when the server responds with a binary protocol buffer, i.e. with a
+// "Content-Type" of "application/x-protobuf". Each response is decoded into a
+// new message of the same type and converted to a record using its JSON
+// representation. The given message is never modified.
+func WithProtoMessage(msg proto.Message) RequestOption {
+	return func(req *Request) {
+		req.protoMessage = msg
+	}
+}
+
+// WithDecodeType sets the type used to decode every response of the request,
+// e.g. DecodeTypeCSV for an endpoint known to return CSV, in place of the type
+// found from the headers or the body of the response. This is for servers whose
+// "Content-Type" is wrong or missing, where WithAccept is not enough because
+// the header names a type that can be decoded, just not the right one. A
+// request with DecodeTypeProtobuf must also register its message with
+// WithProtoMessage.
+func WithDecodeType(decodeType DecodeType) RequestOption {
+	return func(req *Request) {
+		req.decodeType = decodeType
+	}
+}
+
 // Client is an interface that wraps the "Do" method of the "net/http" package's
 // "client" type.
 type Client interface {
@@ -77,6 +306,10 @@ type HTTPService struct {
 	client Client
 	svc    *Service
 
+	// ownedClient is the client created by the service, if any, see
+	// "Close".
+	ownedClient *http.Client
+
 	// Iterator is a service that provides the functionality to
 	// asynchronously iterate over a set of requests, handling them with a
 	// custom handler. Each response in the request is achieved by calling
@@ -84,13 +317,61 @@ type HTTPService struct {
 	// defined by the "net/http" package.
 	Iterator *HTTPIteratorService
 
-	rlimiter *rate.Limiter
-	requests []*Request
+	rlimiter      *rate.Limiter
+	requests      []*Request
+	maxBodyBytes  int64
+	transportOpts transportOptions
+
+	stats      atomic.Pointer[storeStats]
+	result     StoreResult
+	checkpoint CheckpointStore
+	queuePath  string
+	queue      *persistedQueue
+	header     http.Header
+	userAgent  string
+	jitter     time.Duration
+
+	maxRetries   int
+	retryBackoff time.Duration
+	backoff      BackoffStrategy
+
+	// retryBudget and hostRetryBudget are the retries that the requests
+	// of a run can make between them, see "RetryBudget".
+	retryBudget     int
+	hostRetryBudget int
+
+	requestsChan <-chan *Request
+	rewriteURL   URLRewriter
+
+	probe  ProbeFunc
+	probes map[string]*probedHost
+
+	maxInFlight int
+	maxRequests int
+	writeBuffer int
+	breaker     *circuitBreaker
+	tuner       *rateTuner
+	costHeader  string
+	capturer    *failureCapturer
+
+	failOnEmptyBody    bool
+	dryRun             bool
+	fetchOnly          bool
+	ordered            bool
+	disableCompression bool
+
+	reqInterceptors []RequestInterceptor
+	rspInterceptors []ResponseInterceptor
+
+	closeOnce sync.Once
+	closeErr  error
 }
 
 // NewHTTPService will create a new HTTPService.
 func NewHTTPService(svc *Service) *HTTPService {
-	httpSvc := &HTTPService{svc: svc, client: http.DefaultClient}
+	httpSvc := &HTTPService{svc: svc, userAgent: defaultUserAgent}
+	httpSvc.stats.Store(&storeStats{})
+	httpSvc.ownClient()
 	httpSvc.Iterator = NewHTTPIteratorService(httpSvc)
 
 	return httpSvc
@@ -104,9 +385,141 @@ func (svc *HTTPService) RateLimiter(rlimiter *rate.Limiter) *HTTPService {
 	return svc
 }
 
+// Jitter sets the upper bound of a random delay added before each request,
+// after waiting on the rate limiter. When a rate limiter's burst refills, every
+// waiting worker is released at once; jitter spreads those requests across the
+// period instead. A value of zero (the default) means there is no jitter.
+func (svc *HTTPService) Jitter(maxJitter time.Duration) *HTTPService {
+	svc.jitter = maxJitter
+
+	return svc
+}
+
+// DryRun sets whether "Store" makes the requests and decodes the responses
+// without writing them, e.g. to try a new endpoint against a live API without
+// touching the storage. Every step up to the write is run, so a response that
+// cannot be decoded is still an error, and the result's "Records" is the number
+// of records that would have been written. Writers are not pinged, and
+// checkpoints are neither marked nor cleared.
+func (svc *HTTPService) DryRun(dryRun bool) *HTTPService {
+	svc.dryRun = dryRun
+
+	return svc
+}
+
+// FetchOnly sets whether "Store" skips decoding the responses of requests that
+// have no writers, e.g. for a run that only tests connectivity to an API. The
+// bodies are still read, and checkpoints are still marked, but a body that
+// cannot be decoded is not an error, and its records are not counted. The
+// responses of a request with a validator, see WithValidator, are decoded
+// regardless, since its invalid records are written to the dead-letter writer.
+// To decode the responses of a request without storing them, give it a
+// NopWriter instead. By default, every response is decoded.
+func (svc *HTTPService) FetchOnly(fetchOnly bool) *HTTPService {
+	svc.fetchOnly = fetchOnly
+
+	return svc
+}
+
+// Ordered sets whether the iterator returns the responses in the order that
+// the requests were given, with the pages of a request in order, rather than in
+// the order that they complete. Requests are still made concurrently, but a
+// response is held back until every response before it has been returned. The
+// trade-off is latency and memory: a slow early request holds back the later
+// requests that have completed, each of which keeps its response in memory and
+// does not request its next page until the slow request is done. Requests with
+// a priority are ordered by phase first, see WithPriority.
+func (svc *HTTPService) Ordered(ordered bool) *HTTPService {
+	svc.ordered = ordered
+
+	return svc
+}
+
+// FailOnEmptyBody sets whether a 200 (OK) response with an empty or
+// whitespace-only body is an ErrEmptyResponseBody error when storing the
+// response. By default, such a response is skipped since it has no records,
+// e.g. a feed with no new data.
+func (svc *HTTPService) FailOnEmptyBody(fail bool) *HTTPService {
+	svc.failOnEmptyBody = fail
+
+	return svc
+}
+
+// MaxInFlight sets the maximum number of requests that can be made at the same
+// time, i.e. the number of concurrent calls to the client's "Do" method. The
+// number of web workers does not bound this, since a worker makes each of its
+// requests concurrently; it only bounds the number of requests queued at once.
+// A slot is only held while a request is made: a request that is waiting on the
+// rate limiter, a retry backoff, or jitter does not hold one, so a throttled
+// host does not hold back the requests to other hosts. A value of zero (the
+// default) means there is no limit.
+func (svc *HTTPService) MaxInFlight(n int) *HTTPService {
+	svc.maxInFlight = n
+
+	return svc
+}
+
+// MaxRequests sets the maximum number of requests made in a run, including
+// retries and pages, e.g. to stop a pagination function that never returns a
+// last page. Once the limit is reached, no more requests are made and the run
+// fails with an ErrMaxRequestsExceeded error; the data of the responses already
+// received is still stored. A value of zero (the default) means there is no
+// limit.
+func (svc *HTTPService) MaxRequests(n int) *HTTPService {
+	svc.maxRequests = n
+
+	return svc
+}
+
+// WriteBuffer sets the number of responses that "Store" can queue for the list
+// writers while they write the responses before them. Once the queue is full,
+// the iterator stops reading responses until the writers catch up, so the
+// buffer bounds the memory held by responses waiting to be written, however
+// many requests or pages there are. A value of zero (the default) uses a
+// buffer of 16 responses.
+func (svc *HTTPService) WriteBuffer(n int) *HTTPService {
+	svc.writeBuffer = n
+
+	return svc
+}
+
+// MaxBodyBytes sets the maximum number of bytes that will be read from a
+// response body. A body that exceeds the limit will result in an
+// ErrBodyTooLarge error from the iterator, rather than silently truncating the
+// body. A value of zero (the default) means there is no limit.
+func (svc *HTTPService) MaxBodyBytes(n int64) *HTTPService {
+	svc.maxBodyBytes = n
+
+	return svc
+}
+
+// Headers sets headers to add to every request just before it is made, e.g. an
+// API version or a user agent. Headers set on a request with "WithHeaders"
+// take precedence over these. The headers are set on a copy of each request,
+// so the caller's request is not modified.
+func (svc *HTTPService) Headers(header http.Header) *HTTPService {
+	if svc.header == nil {
+		svc.header = http.Header{}
+	}
+
+	for key, vals := range header {
+		svc.header[http.CanonicalHeaderKey(key)] = vals
+	}
+
+	return svc
+}
+
+// UserAgent sets the User-Agent header for requests that do not already set
+// one. The default is "gidari/" followed by the Version of the library.
+func (svc *HTTPService) UserAgent(userAgent string) *HTTPService {
+	svc.userAgent = userAgent
+
+	return svc
+}
+
 // Client sets the optional client to be used by the service. If no client is
-// set, the default "http.DefaultClient" defined by the "net/http" package
-// will be used.
+// set, the service will use a client with a transport tuned for the web worker
+// pool, see "newTransport". A client set with this method is used as-is.
 func (svc *HTTPService) Client(client Client) *HTTPService {
 	svc.client = client
 
@@ -114,45 +527,51 @@ func (svc *HTTPService) Client(client Client) *HTTPService {
 }
 
 // Requests sets the option requests to be made by the service to the client.
-// If no client has been set for the service, the default "http.DefaultClient"
-// defined by the "net/http" package will be used.
 func (svc *HTTPService) Requests(reqs ...*Request) *HTTPService {
 	svc.requests = append(svc.requests, reqs...)
 
 	return svc
 }
 
-// isDecodeTypeJSON will check if the provided "accept" struct is typed for
-// decoding into JSON.
-func isDecodeTypeJSON(acceptHeader accept.Accept) bool {
-	return acceptHeader.Typ == "application" &&
-		(acceptHeader.Subtype == "json" || acceptHeader.Subtype == "*") ||
-		acceptHeader.Typ == "*" && acceptHeader.Subtype == "*"
+// RequestsChan sets a channel that requests are received from while the
+// service runs, for requests that are not known up front, e.g. ones that are
+// read from a message queue. Each request is made as soon as it is received,
+// after the requests set with "Requests", and a run only completes once the
+// channel is closed and every request received from it has completed. Since
+// the requests are not known up front, their writers are not pinged, they are
+// not skipped by a checkpoint, and their priority is ignored. A channel can
+// only be consumed once, so a run after it is closed only makes the requests
+// set with "Requests".
+func (svc *HTTPService) RequestsChan(ch <-chan *Request) *HTTPService {
+	svc.requestsChan = ch
+
+	return svc
 }
 
-// bestFitDecodeType will parse the provided Accept(-Charset|-Encoding|-Language)
-// header and return the header that best fits the decoding algorithm. If the
-// "Accept" header is not set, then this method will return a decodeTypeJSON.
-// If the "Accept" header is set, but no match is found, then this method will
-// return a decodeTypeUnkown.
-//
-// See the "acceptSlice.Less" method in the "third_party/accept" package for
-// more informaiton on how the "best fit" is determined.
-func bestFitDecodeType(header string) DecodeType {
-	decodeType := DecodeTypeUnknown
+// logger will return the structured logger for the service, if any.
+func (svc *HTTPService) logger() *slog.Logger {
+	if svc.svc == nil {
+		return nil
+	}
 
-	for _, acceptHeader := range accept.ParseAcceptHeader(header) {
-		if isDecodeTypeJSON(acceptHeader) {
-			decodeType = DecodeTypeJSON
+	return svc.svc.logger
+}
 
-			break
-		}
+// clock will return the source of time of the underlying service, defaulting
+// to the real time.
+func (svc *HTTPService) clock() clock {
+	if svc.svc == nil || svc.svc.clock == nil {
+		return realClock{}
 	}
 
-	return decodeType
+	return svc.svc.clock
 }
 
-func (svc *HTTPService) store(ctx context.Context, jobs chan<- listWriterJob, done <-chan struct{}) error {
+func (svc *HTTPService) store(ctx context.Context, jobs chan<- listWriterJob) error {
+	// Close the iterator even if storing fails part way through, so that
+	// the remaining responses are discarded.
+	defer svc.Iterator.Close() //nolint:errcheck
+
 	for svc.Iterator.Next(ctx) {
 		rsp := svc.Iterator.Current.Response
 
@@ -161,86 +580,376 @@ func (svc *HTTPService) store(ctx context.Context, jobs chan<- listWriterJob, do
 			continue
 		}
 
-		// If response status code is not 200 (OK) return with an error
-		if rsp.StatusCode != http.StatusOK {
-			return fmt.Errorf("%w: %d", ErrBadResponse, rsp.StatusCode)
+		// A skipped response ends its request, with nothing to store.
+		if svc.Iterator.Current.skipped {
+			svc.markCheckpoint(jobs, svc.Iterator.Current)
+
+			continue
+		}
+
+		// If the status code is not expected, then return with an
+		// error. An expected status may have no data to store.
+		hasData, err := svc.Iterator.Current.req.checkStatus(rsp)
+		if err != nil {
+			svc.newCapturedResponse(svc.Iterator.Current).capture(ctx, err)
+
+			return err
+		}
+
+		if !hasData {
+			svc.markCheckpoint(jobs, svc.Iterator.Current)
+
+			continue
+		}
+
+		job := &listWriterJob{
+			writers:       svc.Iterator.Current.req.writers,
+			mode:          svc.Iterator.Current.req.writeMode,
+			idFields:      svc.Iterator.Current.req.writeIDFields(),
+			contextFields: svc.Iterator.Current.req.contextFields,
+			fingerprint:   svc.Iterator.Current.req.fingerprint,
+			validate:      svc.Iterator.Current.req.validate,
+			invalidWriter: svc.Iterator.Current.req.invalidWriter,
+			flatten:       svc.Iterator.Current.req.flatten,
+			flattenSep:    svc.Iterator.Current.req.flattenSep,
+			labels:        svc.Iterator.Current.req.labels,
+			labelConflict: svc.Iterator.Current.req.labelConflict,
+			logger:        svc.logger(),
+			url:           rsp.Request.URL.Redacted(),
+			stats:         svc.stats.Load(),
+			dryRun:        svc.dryRun,
+			capture:       svc.newCapturedResponse(svc.Iterator.Current),
+		}
+
+		// The request is only marked once the last of its pages has
+		// been written, see "Checkpoint".
+		if current := svc.Iterator.Current; svc.checkpointed(current) {
+			job.checkpoint = svc.checkpoint
+			job.checkpointKey = current.req.checkpointKey
+			job.checkpointLast = current.next == nil && !current.nextErr
 		}
 
-		job := &listWriterJob{writers: svc.Iterator.Current.writers}
+		if current := svc.Iterator.Current; svc.queue != nil && current.req.queueKey != "" &&
+			!current.nextErr && !current.req.sse {
+			job.queue = svc.queue
+			job.queueKey = current.req.queueKey
 
-		// Get the best fit type for decoding the response body. If the
-		// best fit is "Unknown", then return an error.
-		switch bestFitDecodeType(rsp.Header.Get("Accept")) {
-		case DecodeTypeJSON:
-			job.decFunc = decodeFuncJSON(rsp)
-		case DecodeTypeUnknown:
-			return fmt.Errorf("%w: %q", ErrUnsupportedDecodeType, rsp.Request.URL.String())
+			if current.next != nil {
+				job.queueNext = current.next.http
+			}
+		}
+
+		// In a fetch-only run, there is nothing to decode the data of
+		// a request without writers for.
+		job.decFunc = decodeFuncEmpty
+
+		if current := svc.Iterator.Current; !svc.fetchOnly || len(current.req.writers) > 0 ||
+			current.req.validate != nil {
+			decFunc, err := svc.decodeFunc(current)
+			if err != nil {
+				job.capture.capture(ctx, err)
+
+				return err
+			}
+
+			job.decFunc = decFunc
 		}
 
 		jobs <- *job
+
+		observeQueue(&svc.stats.Load().maxWriteQueue, len(jobs))
 	}
 
 	if err := svc.Iterator.Err(); err != nil {
 		return fmt.Errorf("error iterating over requests: %w", err)
 	}
 
-	for w := 1; w <= len(svc.requests); w++ {
-		<-done
+	return nil
+}
+
+// checkpointed will return true if the request of the response is marked in
+// the checkpoint store once it completes. A stream of events has no end to
+// resume from, so it is never checkpointed.
+func (svc *HTTPService) checkpointed(current *Current) bool {
+	return svc.checkpoint != nil && !svc.dryRun && current.req.checkpointKey != "" && !current.req.sse
+}
+
+// markCheckpoint will queue the marking of the request of a response that has
+// no data to store, e.g. one that was skipped or has an expected status with
+// no data, if the response is the last of the request. The marking is queued
+// behind the writes of the earlier pages of the request, so that it is only
+// marked if they were written.
+func (svc *HTTPService) markCheckpoint(jobs chan<- listWriterJob, current *Current) {
+	if !svc.checkpointed(current) || (!current.skipped && (current.next != nil || current.nextErr)) {
+		return
+	}
+
+	jobs <- listWriterJob{
+		checkpoint:     svc.checkpoint,
+		checkpointKey:  current.req.checkpointKey,
+		checkpointLast: true,
+		markOnly:       true,
 	}
+}
 
-	// Close the jobs channel.
-	close(jobs)
+// decodeFunc will return the function used to decode the records of the
+// response, see the "decodeFunc" method of Request. An empty body has no
+// records, unless the service fails on empty bodies.
+func (svc *HTTPService) decodeFunc(current *Current) (DecodeFunc, error) {
+	rsp, data := current.Response, current.Data
+
+	// An empty body has no records to decode. Unless the service treats
+	// it as an error, the response is stored without any records.
+	if len(bytes.TrimSpace(data)) == 0 {
+		if svc.failOnEmptyBody {
+			return nil, fmt.Errorf("%w: %q", ErrEmptyResponseBody, rsp.Request.URL.Redacted())
+		}
 
-	if err := svc.Iterator.Close(); err != nil {
-		return fmt.Errorf("failed to close iterator: %w", err)
+		return decodeFuncEmpty, nil
 	}
 
-	return nil
+	return current.req.decodeFunc(rsp, data)
+}
+
+// decodeFunc will return the function used to decode the records of a response
+// to the request. The type set on the request, if any, is used as-is.
+// Otherwise, the best fit type for decoding is found from the headers of the
+// response, preferring the type requested by the "Accept" header of the
+// request if the "Content-Type" of the response is ambiguous. If the headers
+// cannot be used to find one, then the body is sniffed as a last resort. If the
+// best fit is still "Unknown", then an error is returned.
+func (req *Request) decodeFunc(rsp *http.Response, data []byte) (DecodeFunc, error) {
+	// The data of an event is the JSON record of the event.
+	if req.sse {
+		return decodeFuncJSONFromBytes(data), nil
+	}
+
+	decodeType := req.decodeType
+	if decodeType == DecodeTypeUnknown {
+		decodeType = requestedDecodeType(rsp)
+	}
+
+	if decodeType == DecodeTypeUnknown {
+		decodeType = responseDecodeType(rsp)
+	}
+
+	if decodeType == DecodeTypeUnknown {
+		decodeType = sniffDecodeType(data)
+	}
+
+	switch decodeType {
+	case DecodeTypeJSON:
+		return decodeFuncJSONFromBytes(data), nil
+	case DecodeTypeCSV:
+		return decodeFuncCSV(data, ',', req.duplicateHeaders), nil
+	case DecodeTypeTSV:
+		return decodeFuncCSV(data, '\t', req.duplicateHeaders), nil
+	case DecodeTypeJSONP:
+		return decodeFuncJSONP(data), nil
+	case DecodeTypeProtobuf:
+		msgType := req.protoMessage
+		if msgType == nil {
+			return nil, fmt.Errorf("%w: no proto message registered for %q",
+				ErrUnsupportedDecodeType, rsp.Request.URL.String())
+		}
+
+		return decodeFuncProtobuf(data, msgType), nil
+	case DecodeTypeUnknown:
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedDecodeType, rsp.Request.URL.String())
 }
 
 // Store will concurrently make the requests to the client and store the data
 // from the responses in the provided storage. If no storage is provided, then
-// the data will be discarded.
+// the data will be decoded and discarded, or not decoded at all in a fetch-only
+// run, see "FetchOnly".
+//
+// Store only returns once every list has been written, and every writer that
+// implements Flusher, such as a BufferedWriter, has been flushed, even if the
+// run fails. So once Store returns without an error, every record has been
+// given to the storage and none is still queued in gidari.
 func (svc *HTTPService) Store(ctx context.Context) error {
-	reqCount := len(svc.requests)
-
 	// If there are no requests, do nothing.
-	if reqCount == 0 {
+	if len(svc.requests) == 0 && svc.requestsChan == nil {
 		return nil
 	}
 
-	// Reset the iterator.
+	if svc.svc != nil {
+		ctx = contextWithRunID(ctx, svc.svc.runID)
+	}
+
+	// Verify that the storage is reachable before making any requests.
+	writers := []ListWriter{}
+	for _, req := range svc.requests {
+		writers = append(writers, req.writers...)
+	}
+
+	if !svc.dryRun {
+		if err := pingWriters(ctx, writers); err != nil {
+			return err
+		}
+	}
+
+	reqs, err := svc.pendingRequests(ctx)
+	if err != nil {
+		return err
+	}
+
+	svc.queue = nil
+	if svc.queuePath != "" && !svc.dryRun {
+		if svc.queue, err = loadQueue(svc.queuePath); err != nil {
+			return err
+		}
+
+		if reqs, err = svc.queue.resume(reqs); err != nil {
+			return err
+		}
+	}
+
+	if err := svc.probeHosts(ctx, reqs); err != nil {
+		return err
+	}
+
+	// Reset the iterator and the counters for the run. The skipped
+	// responses are returned so that their requests can be checkpointed.
 	svc.Iterator = NewHTTPIteratorService(svc)
+	svc.Iterator.requests = reqs
+	svc.Iterator.skipped = svc.checkpoint != nil
+	clk := svc.clock()
+	start := clk.Now()
+
+	// The number of requests is not known up front if they are received
+	// from a channel.
+	total := len(reqs)
+	if svc.requestsChan != nil {
+		total = 0
+	}
+
+	svc.stats.Store(newStoreStats(start, total))
+
+	defer func() {
+		end := clk.Now()
+
+		stats := svc.stats.Load()
+		stats.finish(end)
+
+		svc.result = stats.result(end.Sub(start))
+		svc.result.DryRun = svc.dryRun
+	}()
+
+	if len(reqs) > 0 || svc.requestsChan != nil {
+		listWriterCh := startListWriter(ctx, svc.writeBuffer)
 
-	listWriterCh := startListWriter(ctx, reqCount)
+		// Close the jobs channel once every response has been
+		// sent to the list writer, and then wait for the list writer
+		// to finish writing them. The number of responses is not
+		// known up front, since a request may be paginated.
+		err := svc.store(ctx, listWriterCh.jobs)
+		close(listWriterCh.jobs)
 
-	upsertWorkerJobs := listWriterCh.jobs
-	done := listWriterCh.done
-	errCh := listWriterCh.err
+		writeErr := <-listWriterCh.err
+
+		if err != nil {
+			return fmt.Errorf("failed to upsert data: %w", err)
+		}
 
-	if err := svc.store(ctx, upsertWorkerJobs, done); err != nil {
-		return fmt.Errorf("failed to upsert data: %w", err)
+		if writeErr != nil {
+			return fmt.Errorf("error in upsert worker: %w", writeErr)
+		}
 	}
 
-	if err := <-errCh; err != nil {
-		return fmt.Errorf("error in upsert worker: %w", err)
+	// Every request has completed, so the checkpoints are no longer
+	// needed.
+	if svc.checkpoint != nil && !svc.dryRun {
+		if err := svc.checkpoint.Done(ctx); err != nil {
+			return fmt.Errorf("failed to clear checkpoints: %w", err)
+		}
+	}
+
+	if svc.queue != nil {
+		if err := svc.queue.done(); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// Close will release the resources held by the service: it closes the
+// iterator, flushes every writer of the requests that implements Flusher, and
+// then closes every writer that implements "io.Closer", returning the errors
+// of every writer that fails. The idle connections of the client are closed if
+// the service created the client, but not if it was set with "Client". Writers
+// of requests received from "RequestsChan" are not known to the service, so
+// they must be closed by the caller.
+//
+// Close is safe to call more than once, and after "Store", but every call after
+// the first does nothing and returns the same error. The service must not be
+// used once it is closed.
+func (svc *HTTPService) Close() error {
+	svc.closeOnce.Do(func() {
+		_ = svc.Iterator.Close()
+
+		writers := []ListWriter{}
+		for _, req := range svc.requests {
+			writers = append(writers, req.writers...)
+		}
+
+		errs := []error{flushWriters(context.Background(), writers)}
+
+		for _, writer := range uniqueWriters(writers) {
+			closer, ok := writer.(io.Closer)
+			if !ok {
+				continue
+			}
+
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to close writer %T: %w", writer, err))
+			}
+		}
+
+		if svc.ownedClient != nil && svc.client == svc.ownedClient {
+			svc.ownedClient.CloseIdleConnections()
+		}
+
+		svc.closeErr = errors.Join(errs...)
+	})
+
+	return svc.closeErr
+}
+
 // Current is a struct that represents the most recent response by calling the
 // "Next" method on the HTTPIteratorService.
 type Current struct {
 	Response *http.Response // HTTP response from the request.
-	writers  []ListWriter   // Writer for storage.
+	Data     []byte         // Body of the response.
+	req      *Request       // Request that produced the response.
+
+	// next is the next page of the request, if any, and nextErr is true
+	// if the next page could not be found.
+	next    *Request
+	nextErr bool
+
+	// skipped is true if the response was skipped by an interceptor. A
+	// skipped response is only returned by the iterator of "Store", so
+	// that its request can be checkpointed.
+	skipped bool
 }
 
 // HTTPIteratorService is a service that will iterate over the requests defined
 // for the HTTPService and return the response from each request.
+//
+// The requests are made once "Next" is called for the first time, and "Next"
+// will return false once every response has been returned or an error is
+// encountered. To make the requests again, call "Reset".
 type HTTPIteratorService struct {
 	svc *HTTPService
 
+	// requests are the requests to iterate over. If nil, then the
+	// requests of the HTTP Service are used.
+	requests []*Request
+
 	// Current is the most recent response from the iterator. This value is
 	// set and blocked by the "Next" method, updating with each iteration.
 	Current *Current
@@ -248,6 +957,26 @@ type HTTPIteratorService struct {
 	currentChan chan *Current
 	errCh       chan error
 
+	// inFlight is a semaphore that bounds the number of requests made at
+	// the same time, see "HTTPService.MaxInFlight".
+	inFlight chan struct{}
+
+	// calls is the number of requests made, or about to be made, in the
+	// run, see "HTTPService.MaxRequests".
+	calls *atomic.Int64
+
+	// retryBudget is the number of retries left to the requests of the
+	// run, or nil if it is unlimited.
+	retryBudget *retryBudget
+
+	// stream is true if the responses of the run are streamed rather than
+	// read into memory, see "NextStream".
+	stream bool
+
+	// skipped is true if the responses skipped by an interceptor are
+	// returned, see "Current.skipped".
+	skipped bool
+
 	// closemu prevents the iterator from closing while there is an active
 	// streaming  result. It is held for read during non-close operations
 	// and exclusively during close.
@@ -265,7 +994,54 @@ func NewHTTPIteratorService(svc *HTTPService) *HTTPIteratorService {
 	return iter
 }
 
-// Close closes the iterator.
+// Reset will return the iterator to its initial state, so that the next call to
+// "Next" will make the requests again. The iterator can be reset at any point
+// in its lifecycle: before it is started, part way through, once it has been
+// exhausted, or once it has been closed. If the iterator is reset part way
+// through, the remaining responses are discarded.
+func (iter *HTTPIteratorService) Reset() {
+	iter.closemu.Lock()
+	defer iter.closemu.Unlock()
+
+	// If the workers have been started, then discard whatever they have
+	// yet to send so that they can run to completion.
+	if iter.currentChan != nil {
+		go drainCurrent(iter.currentChan, iter.errCh)
+	}
+
+	iter.Current = nil
+	iter.currentChan = nil
+	iter.errCh = make(chan error, 1)
+	iter.closed = false
+	iter.lasterr = nil
+	iter.skipped = false
+}
+
+// drainCurrent will discard the responses and errors from the web workers
+// until the web workers close their channels.
+func drainCurrent(currentCh <-chan *Current, errCh <-chan error) {
+	for currentCh != nil || errCh != nil {
+		select {
+		case current, ok := <-currentCh:
+			if !ok {
+				currentCh = nil
+
+				continue
+			}
+
+			if current.Response != nil {
+				_ = current.Response.Body.Close()
+			}
+		case _, ok := <-errCh:
+			if !ok {
+				errCh = nil
+			}
+		}
+	}
+}
+
+// Close closes the iterator, after which "Next" will return false. Any
+// responses that have yet to be returned are discarded.
 func (iter *HTTPIteratorService) Close() error {
 	iter.closemu.Lock()
 	defer iter.closemu.Unlock()
@@ -276,6 +1052,12 @@ func (iter *HTTPIteratorService) Close() error {
 
 	iter.closed = true
 
+	// Discard whatever the workers have yet to send so that they can run
+	// to completion.
+	if iter.currentChan != nil {
+		go drainCurrent(iter.currentChan, iter.errCh)
+	}
+
 	return nil
 }
 
@@ -293,31 +1075,400 @@ func (iter *HTTPIteratorService) Err() error {
 }
 
 type webWorkerJob struct {
-	req      *Request
-	client   Client
-	rlimiter *rate.Limiter
+	req          *Request
+	phase        *sync.WaitGroup
+	client       Client
+	rlimiter     *rate.Limiter
+	logger       *slog.Logger
+	maxBodyBytes int64
+	stats        *storeStats
+	header       http.Header
+	userAgent    string
+	jitter       time.Duration
+	maxRetries   int
+	backoff      BackoffStrategy
+	retryBudget  *retryBudget
+	inFlight     chan struct{}
+	maxRequests  int
+	calls        *atomic.Int64
+	clock        clock
+	breaker      *circuitBreaker
+	tuner        *rateTuner
+	costHeader   string
+	stream       bool
+
+	disableCompression bool
+	rewriteURL         URLRewriter
+
+	// accept is the media type asked for if the request has no "Accept"
+	// header, as advertised by the probe of its host.
+	accept string
+
+	reqInterceptors []RequestInterceptor
+	rspInterceptors []ResponseInterceptor
+
+	// out is the channel that the responses of the job are sent to in
+	// place of the iterator's, if the iterator preserves the order of the
+	// requests. It is closed once the job has sent its last response.
+	out chan *Current
 }
 
 type webWorkerConfig struct {
-	// id is a unique identifier for the worker. This value MUST be set in
-	// order to start a web worker. One and only one web worker
-	// configuration MUST have an ID of 1 in order to close the response
-	// channel.
-	id int
-
 	jobs      chan webWorkerJob
 	currentCh chan *Current
-	done      chan bool
 	errCh     chan error
+
+	// pending is the number of jobs that have been sent to the workers
+	// and have yet to complete, including all of their pages. It is
+	// incremented for each job before it is sent, and decremented once
+	// the job has sent its last response.
+	pending *sync.WaitGroup
+
+	// skipped is true if the responses skipped by an interceptor are sent
+	// to the iterator, see "Current.skipped".
+	skipped bool
+}
+
+// sendErr will send the error to the iterator, if no other error has been
+// sent. Only the first error is kept, so that a worker never blocks on an
+// error that the iterator will not read.
+func (cfg *webWorkerConfig) sendErr(err error) {
+	select {
+	case cfg.errCh <- err:
+	default:
+	}
+}
+
+// sendCurrent will send the response of the job to the iterator, returning
+// false if the context is canceled first, in which case the response is
+// discarded.
+func (cfg *webWorkerConfig) sendCurrent(ctx context.Context, job *webWorkerJob, current *Current) bool {
+	currentCh := cfg.currentCh
+	if job.out != nil {
+		currentCh = job.out
+	}
+
+	select {
+	case currentCh <- current:
+		return true
+	case <-ctx.Done():
+		if current.Response != nil {
+			_ = current.Response.Body.Close()
+		}
+
+		return false
+	}
+}
+
+// sleepJitter will sleep for a random duration in [0, maxJitter), returning
+// early with an error if the context is canceled.
+func sleepJitter(ctx context.Context, clk clock, maxJitter time.Duration) error {
+	if maxJitter <= 0 {
+		return nil
+	}
+
+	return clk.Sleep(ctx, time.Duration(rand.Int63n(int64(maxJitter)))) //nolint:gosec
+}
+
+// mergeHeader will set every header in src on dst, replacing any values of the
+// same key.
+func mergeHeader(dst, src http.Header) {
+	for key, vals := range src {
+		dst[key] = append([]string(nil), vals...)
+	}
+}
+
+// readBody will read and close the response body, replacing it with a reader
+// over the data read so that it can be read again.
+func readBody(rsp *http.Response) ([]byte, error) {
+	data, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		_ = rsp.Body.Close()
+
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if err := rsp.Body.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close response body: %w", err)
+	}
+
+	rsp.Body = io.NopCloser(bytes.NewReader(data))
+	rsp.ContentLength = int64(len(data))
+
+	return data, nil
+}
+
+// limitedBody is a response body that will return an ErrBodyTooLarge error once
+// more than "limit" bytes have been read from the underlying body.
+type limitedBody struct {
+	body  io.ReadCloser
+	url   string
+	limit int64
+
+	remaining int64 // bytes remaining before the limit is exceeded
+	err       error // sticky error
+}
+
+func newLimitedBody(body io.ReadCloser, url string, limit int64) *limitedBody {
+	return &limitedBody{body: body, url: url, limit: limit, remaining: limit}
+}
+
+// Read will read from the underlying body, returning an ErrBodyTooLarge error
+// if the body exceeds the limit.
+func (lb *limitedBody) Read(buf []byte) (int, error) {
+	if lb.err != nil {
+		return 0, lb.err
+	}
+
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	// Read at most one byte past the limit, so that we can tell if the
+	// body exceeds it.
+	if int64(len(buf)) > lb.remaining+1 {
+		buf = buf[:lb.remaining+1]
+	}
+
+	n, err := lb.body.Read(buf)
+	if int64(n) <= lb.remaining {
+		lb.remaining -= int64(n)
+		lb.err = err
+
+		return n, err //nolint:wrapcheck
+	}
+
+	n = int(lb.remaining)
+	lb.remaining = 0
+	lb.err = fmt.Errorf("%w: %q exceeds %d bytes", ErrBodyTooLarge, lb.url, lb.limit)
+
+	return n, lb.err
 }
 
+// Close will close the underlying body.
+func (lb *limitedBody) Close() error {
+	return lb.body.Close() //nolint:wrapcheck
+}
+
+// authRoundTripper is the transport of a request with an auth round tripper,
+// see WithAuth. The auth round tripper is given the transport of the client
+// in the context of the request, see "auth.WithTransport", so that the
+// authenticated request is made with the settings of the client.
 type authRoundTripper struct {
-	rt func(*http.Request) (*http.Response, error)
+	rt   func(*http.Request) (*http.Response, error)
+	next http.RoundTripper
 }
 
 // RoundTrip will execute the request and return the response.
 func (a *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	return a.rt(req)
+	return a.rt(req.WithContext(auth.WithTransport(req.Context(), a.next)))
+}
+
+// wait will block until the job's request can be attempted, waiting for the
+// rate limiter and any retry backoff. The response is that of the previous
+// attempt, if any.
+func (job *webWorkerJob) wait(ctx context.Context, attempt int, rsp *http.Response) error {
+	start := job.clock.Now()
+
+	var backoff time.Duration
+	if attempt > 0 {
+		backoff = nextDelay(job.backoff, attempt, rsp, start)
+	}
+
+	limited, err := waitTurn(ctx, job.clock, job.rlimiter, job.req.tokens(), backoff)
+	if err != nil {
+		return fmt.Errorf("rate limiter error: %w", err)
+	}
+
+	job.stats.rateLimitWait.Add(int64(limited))
+
+	if job.logger != nil && job.rlimiter != nil {
+		job.logger.LogAttrs(ctx, slog.LevelDebug, "waited for rate limiter",
+			slog.String("url", job.req.http.URL.Redacted()),
+			slog.Int("attempt", attempt),
+			slog.Duration("duration", job.clock.Now().Sub(start)))
+	}
+
+	// Spread out the requests released by the rate limiter.
+	if err := sleepJitter(ctx, job.clock, job.jitter); err != nil {
+		return fmt.Errorf("jitter error: %w", err)
+	}
+
+	return nil
+}
+
+// logSkipped will log that the job's response was skipped by an interceptor.
+func (job *webWorkerJob) logSkipped(ctx context.Context) {
+	if job.logger != nil {
+		job.logger.LogAttrs(ctx, slog.LevelDebug, "response skipped by interceptor",
+			slog.String("url", job.req.http.URL.Redacted()))
+	}
+}
+
+// do will make a single attempt at the job's request. If intercept is false,
+// then the request interceptors are called by the transport of the client
+// instead, after the request is authenticated.
+func (job *webWorkerJob) do(ctx context.Context, client Client, intercept bool) (*http.Response, error) {
+	// Make the attempt with a clone of the request, so that the headers
+	// merged into it, and any changes made by the interceptors, are not
+	// left on the caller's request, nor carried over to the next attempt
+	// or page.
+	httpReq := job.req.http.Clone(job.req.http.Context())
+
+	// Merge the service and request headers, in order of precedence.
+	if httpReq.Header == nil {
+		httpReq.Header = http.Header{}
+	}
+
+	mergeHeader(httpReq.Header, job.header)
+	mergeHeader(httpReq.Header, job.req.header)
+
+	if httpReq.Header.Get("User-Agent") == "" && job.userAgent != "" {
+		httpReq.Header.Set("User-Agent", job.userAgent)
+	}
+
+	if httpReq.Header.Get("Accept") == "" && job.req.sse {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	if httpReq.Header.Get("Accept") == "" && job.accept != "" {
+		httpReq.Header.Set("Accept", job.accept)
+	}
+
+	acceptEncoding(httpReq, job.disableCompression)
+
+	if job.logger != nil {
+		job.logger.LogAttrs(ctx, slog.LevelDebug, "request started",
+			requestAttrs(httpReq)...)
+	}
+
+	// Wait for a slot, if the number of requests in flight is bounded.
+	if job.inFlight != nil {
+		select {
+		case job.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to make request: %w", ctx.Err())
+		}
+
+		defer func() { <-job.inFlight }()
+	}
+
+	if err := job.req.generateBody(httpReq); err != nil {
+		return nil, err
+	}
+
+	if intercept {
+		if err := interceptRequest(httpReq, job.reqInterceptors); err != nil {
+			return nil, err
+		}
+	}
+
+	// Count the request against the limit of the run before it is made,
+	// so that concurrent requests cannot exceed it.
+	if job.maxRequests > 0 && job.calls.Add(1) > int64(job.maxRequests) {
+		return nil, fmt.Errorf("%w: %d", ErrMaxRequestsExceeded, job.maxRequests)
+	}
+
+	host := job.req.http.URL.Host
+
+	if job.breaker != nil {
+		from, to, err := job.breaker.allow(host, job.clock.Now())
+		logCircuit(ctx, job.logger, host, from, to)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to make request: %w: %q", err, host)
+		}
+	}
+
+	start := job.clock.Now()
+
+	job.stats.inFlight.Add(1)
+
+	//nolint:bodyclose
+	rsp, err := client.Do(rewriteRequest(httpReq, job.rewriteURL))
+
+	job.stats.inFlight.Add(-1)
+
+	if err != nil {
+		err = fmt.Errorf("failed to make request: %w", err)
+	}
+
+	if job.breaker != nil {
+		from, to := job.breaker.record(host, job.clock.Now(), isCircuitFailure(rsp, err))
+		logCircuit(ctx, job.logger, host, from, to)
+	}
+
+	if job.tuner != nil {
+		from, to := job.tuner.record(host, job.clock.Now(), rsp)
+		logTunedRate(ctx, job.logger, host, from, to)
+	}
+
+	latency := job.clock.Now().Sub(start)
+
+	if job.logger != nil {
+		logRequestComplete(ctx, job.logger, httpReq, rsp, err, latency)
+	}
+
+	if rsp != nil {
+		decompressResponse(rsp)
+
+		job.stats.requests.Add(1)
+		job.stats.latency.Add(int64(latency))
+		rsp.Body = &countingBody{body: rsp.Body, stats: job.stats}
+
+		job.chargeCost(ctx, rsp)
+	}
+
+	return rsp, err
+}
+
+// retry will return true if the outcome of the attempt should be retried,
+// discarding the response and preparing the request to be sent again. If the
+// attempt is not retried because the retry budget of the run is used up, then
+// an ErrRetryBudgetExhausted error is returned.
+func (job *webWorkerJob) retry(ctx context.Context, attempt int, rsp *http.Response, err error) (bool, error) {
+	if attempt >= job.maxRetries || ctx.Err() != nil || !isRetryable(rsp, err) {
+		return false, nil
+	}
+
+	// A generated body is replaced on every attempt, so it does not need
+	// to be rewound.
+	if job.req.bodyFunc == nil {
+		if ok, rewindErr := rewindBody(job.req.http); !ok || rewindErr != nil {
+			return false, nil
+		}
+	}
+
+	if !job.retryBudget.take(job.req.http.URL.Host) {
+		job.stats.retriesDenied.Add(1)
+
+		if job.logger != nil {
+			job.logger.LogAttrs(ctx, slog.LevelWarn, "retry budget exhausted, not retrying request",
+				requestAttrs(job.req.http)...)
+		}
+
+		return false, fmt.Errorf("%w: %s", ErrRetryBudgetExhausted, job.req.http.URL.Redacted())
+	}
+
+	if rsp != nil {
+		_, _ = io.Copy(io.Discard, rsp.Body)
+		_ = rsp.Body.Close()
+	}
+
+	job.stats.retries.Add(1)
+
+	if job.logger != nil {
+		attrs := append(requestAttrs(job.req.http), slog.Int("attempt", attempt+1))
+		if err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		} else {
+			attrs = append(attrs, slog.Int("status", rsp.StatusCode))
+		}
+
+		job.logger.LogAttrs(ctx, slog.LevelWarn, "retrying request", attrs...)
+	}
+
+	return true, nil
 }
 
 func fetch(ctx context.Context, job *webWorkerJob) (<-chan *http.Response, <-chan error) {
@@ -325,127 +1476,413 @@ func fetch(ctx context.Context, job *webWorkerJob) (<-chan *http.Response, <-cha
 	errs := make(chan error, 1)
 
 	go func() {
-		// If the rate limiter is not set, set it with defaults.
-		if rlimiter := job.rlimiter; rlimiter != nil {
-			if err := job.rlimiter.Wait(ctx); err != nil {
-				errs <- fmt.Errorf("rate limiter error: %w", err)
-			}
-		}
+		defer func() {
+			close(out)
+			close(errs)
+		}()
 
-		// Copy the client in case it is modified.
 		client := job.client
 
 		// If the client is an *http.Client, then set the auth
-		// round-tripper.
-		if client, ok := client.(*http.Client); ok && job.req.auth != nil {
-			client.Transport = &authRoundTripper{rt: job.req.auth}
+		// round-tripper on a copy of the client so that the shared
+		// client is not modified. The auth round-tripper makes the
+		// request over the client's own transport.
+		// The request interceptors are then called by the transport,
+		// so that they see the authenticated request.
+		intercept := true
+
+		if httpClient, ok := client.(*http.Client); ok && job.req.auth != nil {
+			next := httpClient.Transport
+			if next == nil {
+				next = http.DefaultTransport
+			}
+
+			authClient := *httpClient
+			authClient.Transport = &authRoundTripper{
+				rt:   job.req.auth,
+				next: &interceptTransport{next: next, interceptors: job.reqInterceptors},
+			}
+
+			client = &authClient
+			intercept = false
+		}
+
+		var (
+			rsp      *http.Response
+			err      error
+			retryErr error
+		)
+
+		for attempt := 0; ; attempt++ {
+			// The response of a previous attempt has already been
+			// discarded by "retry", so it is not returned if the
+			// attempt cannot be made.
+			if err = job.wait(ctx, attempt, rsp); err != nil {
+				rsp = nil
+
+				break
+			}
+
+			rsp, err = job.do(ctx, client, intercept)
+
+			var retry bool
+			if retry, retryErr = job.retry(ctx, attempt, rsp, err); !retry {
+				break
+			}
+		}
+
+		// A request that could not be retried for want of a retry
+		// budget fails with the budget error, so its response is
+		// discarded rather than checked for its status.
+		if retryErr != nil && err == nil {
+			err = fmt.Errorf("%w: %d", ErrBadResponse, rsp.StatusCode)
+
+			_, _ = io.Copy(io.Discard, rsp.Body)
+			_ = rsp.Body.Close()
+			rsp = nil
 		}
 
-		//nolint:bodyclose
-		rsp, err := client.Do(job.req.http)
 		if err != nil {
-			errs <- fmt.Errorf("failed to make request: %w", err)
+			if retryErr != nil {
+				err = fmt.Errorf("%w: %w", retryErr, err)
+			}
+
+			job.stats.errors.Add(1)
+			errs <- err
 		}
 
-		out <- rsp
+		if rsp != nil && job.maxBodyBytes > 0 {
+			rsp.Body = newLimitedBody(rsp.Body, job.req.http.URL.Redacted(), job.maxBodyBytes)
+		}
 
-		close(out)
-		close(errs)
+		out <- rsp
 	}()
 
 	return out, errs
 }
 
-// startWebWorker will start a worker upto the given specifications of the
-// configuration. The worker will listen for jobs defined by the confirugation,
-// asynchronous make web requests, and then propagate them onto the response
-// channel.
-//
-// This function should be the only function that sends to the response channel
-// (i.e. "rspCh"). Because this function is meant to be used as a worker pool,
-// it is important that the response channel is not closed until all workers
-// have finished. Therefore, this function will close the response channel ONLY
-// when the worker with ID 1 has finished. This works because all workers will
-// be blocked from the "defer" method until the "jobs" channel is closed.
-//
-// If an error is encountered, the worker will push the error onto the error
-// channel and then exit. Note that only the  most recent error will be
-// propagated to the "errCh" channel, per the rules of "errgroup.Group". Also,
-// regardless of errors encountered, the worker will always continue to process
-// jobs until the jobs channel is closed.
+// startWebWorker will start a worker that makes the requests of the jobs it
+// receives, along with each of their pages, sending every response to the
+// iterator. The worker returns once the jobs channel is closed, but the
+// requests of the jobs it received may still be in progress: the iterator's
+// channels must only be closed once every pending job has completed, see
+// "webWorkerConfig.pending".
 func startWebWorker(ctx context.Context, cfg *webWorkerConfig) {
 	for job := range cfg.jobs {
 		go func(job webWorkerJob) {
-			defer func() {
-				cfg.done <- true
-			}()
+			defer cfg.pending.Done()
+
+			if job.out != nil {
+				defer close(job.out)
+			}
 
-			//nolint:bodyclose
-			rspCh, errCh := fetch(ctx, &job)
+			// Make the request, and then each of the pages that
+			// follow it. A page can only be requested once the
+			// previous page has completed.
+			for req := job.req; req != nil; {
+				job.req = req
 
-			err := <-errCh
-			if err != nil {
-				cfg.errCh <- err
+				//nolint:bodyclose
+				rspCh, errCh := fetch(ctx, &job)
+
+				err := <-errCh
+				if err != nil {
+					cfg.sendErr(err)
+				}
+
+				rsp := <-rspCh
+
+				// A stream of events is read as it arrives,
+				// and has no pages.
+				if rsp != nil && job.req.sse && !job.stream {
+					if hasData, statusErr := job.req.checkStatus(rsp); hasData && statusErr == nil {
+						cfg.sendEvents(ctx, &job, rsp)
+
+						break
+					}
+				}
+
+				// Read the body once, so that it can be
+				// shared by the pagination function, the
+				// iterator, and the list writers. A streamed
+				// body is left for the caller to read.
+				var (
+					data     []byte
+					streamed *streamBody
+				)
+
+				if rsp != nil && job.stream {
+					streamed = newStreamBody(rsp.Body)
+					rsp.Body = streamed
+				}
+
+				if rsp != nil && !job.stream {
+					data, err = readBody(rsp)
+					if err == nil {
+						err = interceptResponse(rsp, data, job.rspInterceptors)
+					}
+
+					// A skipped response ends the pages of
+					// the request.
+					if errors.Is(err, ErrSkipResponse) {
+						job.logSkipped(ctx)
+
+						if cfg.skipped {
+							cfg.sendCurrent(ctx, &job, &Current{
+								Response: rsp, Data: data, req: job.req, skipped: true,
+							})
+						}
+
+						break
+					}
+
+					if err != nil {
+						cfg.sendErr(err)
+						rsp = nil
+					}
+				}
+
+				req, err = req.nextPage(rsp, data)
+				if err != nil {
+					cfg.sendErr(err)
+				}
+
+				current := &Current{Response: rsp, Data: data, req: job.req, next: req, nextErr: err != nil}
+				if !cfg.sendCurrent(ctx, &job, current) {
+					break
+				}
+
+				// Only request the next page once the caller
+				// is done with the body of this one.
+				if streamed != nil && req != nil {
+					streamed.wait(ctx)
+				}
 			}
 
-			cfg.currentCh <- &Current{
-				Response: <-rspCh,
-				writers:  job.req.writers,
+			job.stats.completed.Add(1)
+
+			if job.phase != nil {
+				job.phase.Done()
 			}
 		}(job)
 	}
+}
 
-	if cfg.id == 1 {
-		close(cfg.currentCh)
-		close(cfg.done)
-		close(cfg.errCh)
+// newWebWorkerJob will create a job for the web workers to make the request.
+func (iter *HTTPIteratorService) newWebWorkerJob(req *Request) webWorkerJob {
+	return webWorkerJob{
+		req:          req,
+		client:       iter.svc.client,
+		rlimiter:     iter.svc.rlimiter,
+		logger:       iter.svc.logger(),
+		maxBodyBytes: iter.svc.maxBodyBytes,
+		stats:        iter.svc.stats.Load(),
+		header:       iter.svc.header,
+		userAgent:    iter.svc.userAgent,
+		jitter:       iter.svc.jitter,
+		maxRetries:   iter.svc.maxRetries,
+		backoff:      iter.svc.backoffStrategy(),
+		retryBudget:  iter.retryBudget,
+		inFlight:     iter.inFlight,
+		maxRequests:  iter.svc.maxRequests,
+		calls:        iter.calls,
+		clock:        iter.svc.clock(),
+		breaker:      iter.svc.breaker,
+		tuner:        iter.svc.tuner,
+		costHeader:   iter.svc.costHeader,
+		stream:       iter.stream,
+
+		disableCompression: iter.svc.disableCompression,
+		rewriteURL:         iter.svc.rewriteURL,
+
+		reqInterceptors: iter.svc.reqInterceptors,
+		rspInterceptors: iter.svc.rspInterceptors,
 	}
 }
 
+// requestPhases will group the requests by priority, in ascending order. The
+// order of the requests within each phase is preserved.
+func requestPhases(reqs []*Request) [][]*Request {
+	sorted := make([]*Request, len(reqs))
+	copy(sorted, reqs)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].priority < sorted[j].priority
+	})
+
+	var phases [][]*Request
+
+	for idx, req := range sorted {
+		if idx == 0 || req.priority != sorted[idx-1].priority {
+			phases = append(phases, nil)
+		}
+
+		phases[len(phases)-1] = append(phases[len(phases)-1], req)
+	}
+
+	return phases
+}
+
 // startWorkers will start the iterator's web workers and response workers. This
 // method can be used to lazy load the underlying buffered channels.
 func (iter *HTTPIteratorService) startWorkers(ctx context.Context) {
-	reqCount := len(iter.svc.requests)
-	iter.currentChan = make(chan *Current, reqCount)
+	reqs := iter.requests
+	if reqs == nil {
+		reqs = iter.svc.requests
+	}
+
+	reqCount := len(reqs)
+	currentCh := make(chan *Current, reqCount)
+	errCh := iter.errCh
+
+	iter.currentChan = currentCh
+
+	iter.calls = &atomic.Int64{}
+	iter.retryBudget = newRetryBudget(iter.svc.retryBudget, iter.svc.hostRetryBudget)
+
+	// Read the counters of the run before the dispatcher starts, since
+	// they are replaced by the next run.
+	stats := iter.svc.stats.Load()
+	probes := iter.svc.probes
+
+	iter.inFlight = nil
+	if iter.svc.maxInFlight > 0 {
+		iter.inFlight = make(chan struct{}, iter.svc.maxInFlight)
+	}
 
 	// webWorkerJobChan is responsible for making HTTP requests and pushing
 	// the response body onto the responseWorkerJobChan. This channel is
 	// buffered to be equal to the number of requests made.
 	webWorkerJobChan := make(chan webWorkerJob, reqCount)
-	done := make(chan bool, reqCount)
+	pending := &sync.WaitGroup{}
 
 	// Start the web workers.
-	for i := 0; i < runtime.NumCPU(); i++ {
+	for i := 0; i < workerCount(); i++ {
 		go startWebWorker(ctx, &webWorkerConfig{
-			id:        i + 1,
 			jobs:      webWorkerJobChan,
-			currentCh: iter.currentChan,
-			done:      done,
-			errCh:     iter.errCh,
+			currentCh: currentCh,
+			errCh:     errCh,
+			pending:   pending,
+			skipped:   iter.skipped,
 		})
 	}
 
+	// If the order of the requests is preserved, then each job sends its
+	// responses to its own channel, and the channels are forwarded to the
+	// iterator one at a time, in the order the jobs are sent.
+	var order chan chan *Current
+
+	forwarded := make(chan struct{})
+
+	if iter.svc.ordered {
+		order = make(chan chan *Current, reqCount)
+
+		go forwardOrdered(ctx, order, currentCh, forwarded)
+	} else {
+		close(forwarded)
+	}
+
+	// dispatch will send the request to the web workers, marking the phase
+	// done once the request and its pages have completed.
+	dispatch := func(req *Request, phase *sync.WaitGroup) {
+		job := iter.newWebWorkerJob(req)
+		job.phase = phase
+		job.stats = stats
+
+		probed := probes[req.http.URL.Host]
+		probed.apply(&job)
+
+		if job.tuner != nil {
+			job.rlimiter = job.tuner.limiter(req.http.URL.Host, probed.rateLimit())
+		}
+
+		if order != nil {
+			job.out = make(chan *Current, 1)
+			order <- job.out
+		}
+
+		pending.Add(1)
+		webWorkerJobChan <- job
+
+		observeQueue(&stats.maxRequestQueue, len(webWorkerJobChan))
+	}
+
+	incoming := iter.svc.requestsChan
+
 	go func() {
-		// Send the flattened requests to the web workers for processing.
-		for _, req := range iter.svc.requests {
-			webWorkerJobChan <- webWorkerJob{
-				req:      req,
-				client:   iter.svc.client,
-				rlimiter: iter.svc.rlimiter,
+		// Send the flattened requests to the web workers for processing,
+		// one phase at a time.
+		for _, phase := range requestPhases(reqs) {
+			wg := &sync.WaitGroup{}
+			wg.Add(len(phase))
+
+			for _, req := range phase {
+				dispatch(req, wg)
 			}
+
+			// Wait for every request in the phase to complete
+			// before starting the next phase.
+			wg.Wait()
 		}
-	}()
 
-	go func() {
-		// Wait for all the web workers to finish.
-		for i := 0; i < reqCount; i++ {
-			<-done
+		// Then send the requests received from the channel, as they
+		// are received, until it is closed or the run is canceled.
+		for incoming != nil {
+			select {
+			case req, ok := <-incoming:
+				if !ok {
+					incoming = nil
+
+					continue
+				}
+
+				if req != nil {
+					dispatch(req, nil)
+				}
+			case <-ctx.Done():
+				incoming = nil
+			}
 		}
 
 		close(webWorkerJobChan)
+
+		if order != nil {
+			close(order)
+		}
+
+		// No more jobs will be sent, so once the pending jobs have
+		// completed and their responses have been forwarded, there are
+		// no more responses or errors.
+		pending.Wait()
+		<-forwarded
+
+		close(currentCh)
+		close(errCh)
 	}()
 }
 
+// forwardOrdered will forward the responses of each job to the iterator, one
+// job at a time in the order that the jobs' channels are received, until the
+// order channel is closed. If the context is canceled, then the remaining
+// responses are discarded so that the jobs can run to completion.
+func forwardOrdered(ctx context.Context, order <-chan chan *Current, currentCh chan<- *Current,
+	done chan<- struct{},
+) {
+	defer close(done)
+
+	for out := range order {
+		for current := range out {
+			select {
+			case currentCh <- current:
+			case <-ctx.Done():
+				if current.Response != nil {
+					_ = current.Response.Body.Close()
+				}
+			}
+		}
+	}
+}
+
 func (iter *HTTPIteratorService) next(ctx context.Context) error {
 	for {
 		select {
@@ -481,13 +1918,25 @@ func (iter *HTTPIteratorService) next(ctx context.Context) error {
 // The HTTP requests used to define the configuration will be fetched
 // concurrently once the "Next" method is called for the first time.
 func (iter *HTTPIteratorService) Next(ctx context.Context) bool {
+	return iter.advance(ctx, false)
+}
+
+// advance will push the next response onto the iterator, starting the workers
+// if they have not been started. If the workers are started, then stream sets
+// whether the responses of the run are streamed.
+func (iter *HTTPIteratorService) advance(ctx context.Context, stream bool) bool {
 	iter.closemu.RLock()
 	defer iter.closemu.RUnlock()
 
+	if iter.closed {
+		return false
+	}
+
 	// If the current channel is nil, then we need to start the workers.
 	// This will lazy load the web workers and the response workers, each
 	// buffered by the number of requests.
 	if iter.currentChan == nil {
+		iter.stream = stream
 		iter.startWorkers(ctx)
 	}
 
@@ -9,12 +9,27 @@
 package gidari
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"golang.org/x/time/rate"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 var errMissingURL = errors.New("missing URL")
@@ -333,3 +348,1382 @@ func BenchmarkHTTPServiceDo(b *testing.B) {
 		}
 	}
 }
+
+// staticClient is a client that responds to every request with the same body.
+type staticClient struct {
+	body []byte
+}
+
+func (c staticClient) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(c.body)),
+		Request:    req,
+	}, nil
+}
+
+// BenchmarkHTTPServiceStorePipeline compares "Store", whose responses go
+// through the iterator to the list writer, with a caller that decodes and
+// writes the responses of the iterator itself, to measure the cost of the
+// hop between them.
+func BenchmarkHTTPServiceStorePipeline(b *testing.B) {
+	const requests = 1000
+
+	records := make([]string, 100)
+	for i := range records {
+		records[i] = fmt.Sprintf(`{"id":%d,"name":"record %d"}`, i, i)
+	}
+
+	client := staticClient{body: []byte("[" + strings.Join(records, ",") + "]")}
+
+	newService := func(b *testing.B, writer ListWriter) *Service {
+		b.Helper()
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			b.Fatalf("failed to create service: %v", err)
+		}
+
+		for i := 0; i < requests; i++ {
+			req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://example/%d", i), nil)
+			svc.HTTP.Requests(NewHTTPRequest(req, WithWriters(writer)))
+		}
+
+		svc.HTTP.Client(client)
+
+		return svc
+	}
+
+	b.Run("store", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			svc := newService(b, NopWriter{})
+
+			if err := svc.HTTP.Store(context.Background()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("iterator", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			svc := newService(b, NopWriter{})
+
+			for svc.HTTP.Iterator.Next(context.Background()) {
+				current := svc.HTTP.Iterator.Current
+
+				list := &structpb.ListValue{}
+				if err := decodeFuncJSONFromBytes(current.Data)(list); err != nil {
+					b.Fatal(err)
+				}
+
+				for _, writer := range current.req.writers {
+					if err := writer.Write(context.Background(), list); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+
+			if err := svc.HTTP.Iterator.Err(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestHTTPServiceLogger(t *testing.T) {
+	t.Parallel()
+
+	const secret = "Bearer secret-token"
+
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	svc, err := NewService(context.Background(), WithLogger(logger))
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	reqs := newHTTPRequests(2)
+	for _, req := range reqs {
+		req.http.Header.Set("Authorization", secret)
+	}
+
+	svc.HTTP.Requests(reqs...)
+	svc.HTTP.client = newMockHTTPClient(withMockHTTPClientRequests(reqs...))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	logs := buf.String()
+
+	for _, msg := range []string{"request started", "request completed", "wrote list"} {
+		if !strings.Contains(logs, msg) {
+			t.Errorf("expected logs to contain %q, got %s", msg, logs)
+		}
+	}
+
+	if strings.Contains(logs, secret) {
+		t.Errorf("expected logs to redact the authorization header, got %s", logs)
+	}
+}
+
+func TestRedactHeader(t *testing.T) {
+	t.Parallel()
+
+	header := http.Header{}
+	header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	header.Set("Accept", "application/json")
+
+	got := redactHeader(header)
+
+	if got.Get("Authorization") != redacted {
+		t.Errorf("expected authorization to be redacted, got %q", got.Get("Authorization"))
+	}
+
+	if got.Get("Accept") != "application/json" {
+		t.Errorf("expected accept to be preserved, got %q", got.Get("Accept"))
+	}
+
+	if header.Get("Authorization") == redacted {
+		t.Errorf("expected original header to be unmodified")
+	}
+}
+
+func TestHTTPServiceMaxBodyBytes(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`[{"id":1},{"id":2},{"id":3}]`)
+
+	for _, tcase := range []struct {
+		name         string
+		maxBodyBytes int64
+		wantErr      error
+	}{
+		{
+			name: "unlimited",
+		},
+		{
+			name:         "within limit",
+			maxBodyBytes: int64(len(body)),
+		},
+		{
+			name:         "exceeds limit",
+			maxBodyBytes: int64(len(body)) - 1,
+			wantErr:      ErrBodyTooLarge,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			reqs := newHTTPRequests(1)
+
+			svc.HTTP.Requests(reqs...).MaxBodyBytes(tcase.maxBodyBytes)
+			svc.HTTP.client = newMockHTTPClient(withMockHTTPClientResponseBody(reqs[0], body))
+
+			err = svc.HTTP.Store(context.Background())
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLimitedBody(t *testing.T) {
+	t.Parallel()
+
+	body := newLimitedBody(io.NopCloser(strings.NewReader("0123456789")), "http://example", 5)
+
+	got, err := io.ReadAll(body)
+	if !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("expected error %v, got %v", ErrBodyTooLarge, err)
+	}
+
+	if string(got) != "01234" {
+		t.Errorf("expected to read up to the limit, got %q", got)
+	}
+}
+
+func TestHTTPServicePriority(t *testing.T) {
+	t.Parallel()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	const phaseSize = 5
+
+	// The low priority requests are listed first, to ensure that the
+	// ordering is driven by priority and not by the order of the requests.
+	reqs := newHTTPRequests(2 * phaseSize)
+	for _, req := range reqs[:phaseSize] {
+		WithPriority(1)(req)
+	}
+
+	client := newMockHTTPClient(withMockHTTPClientRequests(reqs...))
+
+	svc.HTTP.Requests(reqs...)
+	svc.HTTP.client = client
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	if len(client.calls) != len(reqs) {
+		t.Fatalf("expected %d calls, got %d", len(reqs), len(client.calls))
+	}
+
+	for idx, call := range client.calls {
+		want := 0
+		if idx >= phaseSize {
+			want = 1
+		}
+
+		var priority int
+
+		for _, req := range reqs {
+			if req.http.URL.String() == call.URL.String() {
+				priority = req.priority
+			}
+		}
+
+		if priority != want {
+			t.Errorf("expected call %d to have priority %d, got %d", idx, want, priority)
+		}
+	}
+}
+
+func TestHTTPServiceHeaders(t *testing.T) {
+	t.Parallel()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	reqs := newHTTPRequests(2)
+	reqs[0].http.Header.Set("X-Original", "original")
+	reqs[0].http.Header.Set("X-Shared", "original")
+
+	WithHeaders(http.Header{"x-shared": []string{"request"}})(reqs[1])
+
+	client := newMockHTTPClient(withMockHTTPClientRequests(reqs...))
+
+	svc.HTTP.Requests(reqs...).Headers(http.Header{
+		"X-Api-Version": []string{"2"},
+		"X-Shared":      []string{"service"},
+	})
+	svc.HTTP.client = client
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	made := make(map[string]http.Header)
+	for _, call := range client.calls {
+		made[call.URL.String()] = call.Header
+	}
+
+	for _, tcase := range []struct {
+		req  *Request
+		key  string
+		want string
+	}{
+		{req: reqs[0], key: "X-Original", want: "original"},
+		{req: reqs[0], key: "X-Shared", want: "service"},
+		{req: reqs[0], key: "X-Api-Version", want: "2"},
+		{req: reqs[1], key: "X-Shared", want: "request"},
+		{req: reqs[1], key: "X-Api-Version", want: "2"},
+	} {
+		if got := made[tcase.req.http.URL.String()].Get(tcase.key); got != tcase.want {
+			t.Errorf("expected %s header of %q on %s, got %q", tcase.key, tcase.want,
+				tcase.req.http.URL, got)
+		}
+	}
+
+	// The headers are merged into the request that is made, not the
+	// caller's request.
+	want := http.Header{"X-Original": []string{"original"}, "X-Shared": []string{"original"}}
+	if got := reqs[0].http.Header; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the caller's request headers to be %v, got %v", want, got)
+	}
+
+	if got := reqs[1].http.Header; len(got) != 0 {
+		t.Errorf("expected the caller's request to have no headers, got %v", got)
+	}
+}
+
+func TestHTTPServiceUserAgent(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name      string
+		userAgent string
+		reqHeader http.Header
+		want      string
+	}{
+		{
+			name: "default",
+			want: defaultUserAgent,
+		},
+		{
+			name:      "override",
+			userAgent: "custom/1.0",
+			want:      "custom/1.0",
+		},
+		{
+			name:      "set by request",
+			userAgent: "custom/1.0",
+			reqHeader: http.Header{"User-Agent": []string{"request/1.0"}},
+			want:      "request/1.0",
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			userAgents := make(chan string, 1)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userAgents <- r.UserAgent()
+
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			svc.HTTP.Requests(newTestServerRequest(t, server.URL, WithHeaders(tcase.reqHeader)))
+
+			if tcase.userAgent != "" {
+				svc.HTTP.UserAgent(tcase.userAgent)
+			}
+
+			if _, err := iterateAll(t, svc.HTTP); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := <-userAgents; got != tcase.want {
+				t.Errorf("expected user agent %q, got %q", tcase.want, got)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceJitter(t *testing.T) {
+	t.Parallel()
+
+	const (
+		reqCount = 16
+		jitter   = 200 * time.Millisecond
+	)
+
+	var (
+		mtx    sync.Mutex
+		starts []time.Time
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mtx.Lock()
+		starts = append(starts, time.Now())
+		mtx.Unlock()
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	reqs := make([]*Request, reqCount)
+	for idx := range reqs {
+		reqs[idx] = newTestServerRequest(t, server.URL)
+	}
+
+	// Allow every request through the limiter at once, so that any spread
+	// is due to the jitter.
+	svc.HTTP.
+		RateLimiter(rate.NewLimiter(rate.Inf, reqCount)).
+		Jitter(jitter).
+		Requests(reqs...)
+
+	if _, err := iterateAll(t, svc.HTTP); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(starts) != reqCount {
+		t.Fatalf("expected %d requests, got %d", reqCount, len(starts))
+	}
+
+	first, last := starts[0], starts[0]
+
+	for _, start := range starts {
+		if start.Before(first) {
+			first = start
+		}
+
+		if start.After(last) {
+			last = start
+		}
+	}
+
+	if spread := last.Sub(first); spread < jitter/4 {
+		t.Errorf("expected requests to be spread over at least %v, got %v", jitter/4, spread)
+	}
+}
+
+func TestSleepJitter(t *testing.T) {
+	t.Parallel()
+
+	if err := sleepJitter(context.Background(), realClock{}, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := sleepJitter(ctx, realClock{}, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected error %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestHTTPIteratorServiceReset(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	reqs := make([]*Request, 5)
+	for idx := range reqs {
+		reqs[idx] = newTestServerRequest(t, fmt.Sprintf("%s/%d", server.URL, idx))
+	}
+
+	svc.HTTP.Requests(reqs...)
+
+	// iterateURLs will iterate over the responses, returning the sorted
+	// URLs of the requests that produced them.
+	iterateURLs := func(t *testing.T) []string {
+		t.Helper()
+
+		rsps, err := iterateAll(t, svc.HTTP)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		urls := make([]string, len(rsps))
+		for idx, rsp := range rsps {
+			urls[idx] = rsp.Request.URL.String()
+		}
+
+		sort.Strings(urls)
+
+		return urls
+	}
+
+	want := iterateURLs(t)
+	if len(want) != len(reqs) {
+		t.Fatalf("expected %d responses, got %d", len(reqs), len(want))
+	}
+
+	// An exhausted iterator will not produce any more responses.
+	if svc.HTTP.Iterator.Next(context.Background()) {
+		t.Fatal("expected the iterator to be exhausted")
+	}
+
+	svc.HTTP.Iterator.Reset()
+
+	if got := iterateURLs(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected responses %v after reset, got %v", want, got)
+	}
+
+	// Reset part way through the iteration.
+	svc.HTTP.Iterator.Reset()
+
+	if !svc.HTTP.Iterator.Next(context.Background()) {
+		t.Fatalf("expected a response, got error: %v", svc.HTTP.Iterator.Err())
+	}
+
+	svc.HTTP.Iterator.Reset()
+
+	if got := iterateURLs(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected responses %v after a partial reset, got %v", want, got)
+	}
+}
+
+func TestNewFormRequest(t *testing.T) {
+	t.Parallel()
+
+	values := url.Values{
+		"grant_type": []string{"client_credentials"},
+		"scope":      []string{"read write"},
+	}
+
+	type received struct {
+		contentType   string
+		contentLength int64
+		values        url.Values
+	}
+
+	receivedCh := make(chan received, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		receivedCh <- received{
+			contentType:   r.Header.Get("Content-Type"),
+			contentLength: r.ContentLength,
+			values:        r.PostForm,
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	req, err := NewFormRequest(server.URL, values)
+	if err != nil {
+		t.Fatalf("failed to create form request: %v", err)
+	}
+
+	if req.http.Method != http.MethodPost {
+		t.Errorf("expected method %s, got %s", http.MethodPost, req.http.Method)
+	}
+
+	// The body must be readable again for retries.
+	if req.http.GetBody == nil {
+		t.Fatal("expected the request to set GetBody")
+	}
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	svc.HTTP.Requests(req)
+
+	if _, err := iterateAll(t, svc.HTTP); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := <-receivedCh
+
+	if got.contentType != "application/x-www-form-urlencoded" {
+		t.Errorf("expected form content type, got %q", got.contentType)
+	}
+
+	if want := int64(len(values.Encode())); got.contentLength != want {
+		t.Errorf("expected content length %d, got %d", want, got.contentLength)
+	}
+
+	if !reflect.DeepEqual(got.values, values) {
+		t.Errorf("expected form values %v, got %v", values, got.values)
+	}
+
+	if _, err := NewFormRequest("://invalid", values); err == nil {
+		t.Error("expected an error for an invalid URL")
+	}
+}
+
+func TestNewMultipartRequest(t *testing.T) {
+	t.Parallel()
+
+	// The server echoes the name of each field and file, along with the
+	// contents of each file.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		var records []string
+
+		for _, name := range sortedKeys(r.MultipartForm.Value) {
+			records = append(records, fmt.Sprintf(`{"field":%q,"value":%q}`, name, r.FormValue(name)))
+		}
+
+		for _, name := range sortedKeys(r.MultipartForm.File) {
+			file, _, err := r.FormFile(name)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+
+				return
+			}
+
+			data, _ := io.ReadAll(file)
+			records = append(records, fmt.Sprintf(`{"file":%q,"value":%q}`, name, data))
+		}
+
+		fmt.Fprintf(w, "[%s]", strings.Join(records, ","))
+	}))
+	t.Cleanup(server.Close)
+
+	req, err := NewMultipartRequest(server.URL,
+		map[string]string{"format": "csv", "delimiter": ","},
+		map[string]io.Reader{"upload": strings.NewReader("id,name\n1,a\n")})
+	if err != nil {
+		t.Fatalf("failed to create multipart request: %v", err)
+	}
+
+	if req.http.Method != http.MethodPost {
+		t.Errorf("expected method %s, got %s", http.MethodPost, req.http.Method)
+	}
+
+	if !strings.HasPrefix(req.http.Header.Get("Content-Type"), "multipart/form-data; boundary=") {
+		t.Errorf("expected a multipart content type, got %q", req.http.Header.Get("Content-Type"))
+	}
+
+	// The body must be readable again for retries.
+	if req.http.GetBody == nil || req.http.ContentLength <= 0 {
+		t.Fatal("expected the request to set GetBody and a content length")
+	}
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	writer := &mockListWriter{}
+
+	WithWriters(writer)(req)
+	svc.HTTP.Requests(req)
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	if len(writer.data) != 1 {
+		t.Fatalf("expected 1 write, got %d", len(writer.data))
+	}
+
+	list := &structpb.ListValue{}
+	if err := list.UnmarshalJSON(writer.data[0]); err != nil {
+		t.Fatalf("failed to unmarshal written data: %v", err)
+	}
+
+	want := []interface{}{
+		map[string]interface{}{"field": "delimiter", "value": ","},
+		map[string]interface{}{"field": "format", "value": "csv"},
+		map[string]interface{}{"file": "upload", "value": "id,name\n1,a\n"},
+	}
+
+	if got := list.AsSlice(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected records %v, got %v", want, got)
+	}
+}
+
+func TestHTTPIteratorServiceCurrentData(t *testing.T) {
+	t.Parallel()
+
+	body := `[{"id":1},{"id":2}]`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	svc.HTTP.Requests(newTestServerRequest(t, server.URL))
+
+	if !svc.HTTP.Iterator.Next(context.Background()) {
+		t.Fatalf("expected a response, got error: %v", svc.HTTP.Iterator.Err())
+	}
+
+	current := svc.HTTP.Iterator.Current
+
+	if string(current.Data) != body {
+		t.Errorf("expected data %q, got %q", body, current.Data)
+	}
+
+	// Reading the response body must not consume the data.
+	got, err := io.ReadAll(current.Response.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+
+	if string(got) != body {
+		t.Errorf("expected body %q, got %q", body, got)
+	}
+
+	if string(current.Data) != body {
+		t.Errorf("expected data %q after reading the body, got %q", body, current.Data)
+	}
+
+	if svc.HTTP.Iterator.Next(context.Background()) {
+		t.Error("expected the iterator to be exhausted")
+	}
+}
+
+func TestHTTPServiceMaxInFlight(t *testing.T) {
+	t.Parallel()
+
+	const (
+		reqCount    = 20
+		maxInFlight = 2
+	)
+
+	var inFlight, maxSeen int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+
+		for {
+			seen := atomic.LoadInt32(&maxSeen)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxSeen, seen, current) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	reqs := make([]*Request, reqCount)
+	for idx := range reqs {
+		reqs[idx] = newTestServerRequest(t, server.URL)
+	}
+
+	// Use a client that does not bound the connections per host, so that
+	// only the service bounds the requests in flight.
+	svc.HTTP.
+		Client(&http.Client{Transport: &http.Transport{}}).
+		MaxInFlight(maxInFlight).
+		Requests(reqs...)
+
+	rsps, err := iterateAll(t, svc.HTTP)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(rsps) != reqCount {
+		t.Fatalf("expected %d responses, got %d", reqCount, len(rsps))
+	}
+
+	if got := atomic.LoadInt32(&maxSeen); got > maxInFlight {
+		t.Errorf("expected at most %d requests in flight, got %d", maxInFlight, got)
+	}
+}
+
+func TestHTTPServiceMaxInFlightThrottledHost(t *testing.T) {
+	t.Parallel()
+
+	const (
+		slowCount = 3
+		fastCount = 10
+		backoff   = 300 * time.Millisecond
+	)
+
+	var (
+		mtx       sync.Mutex
+		attempts  = map[string]int{}
+		fastDone  time.Time
+		slowRetry time.Time
+	)
+
+	// The slow host throttles the first attempt at each request, so its
+	// requests wait out a backoff before they are retried.
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		attempts[r.URL.RawQuery]++
+		if attempts[r.URL.RawQuery] == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+
+			return
+		}
+
+		if slowRetry.IsZero() {
+			slowRetry = time.Now()
+		}
+	}))
+	t.Cleanup(slow.Close)
+
+	fast := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		fastDone = time.Now()
+	}))
+	t.Cleanup(fast.Close)
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	reqs := []*Request{}
+	for idx := 0; idx < slowCount; idx++ {
+		reqs = append(reqs, newTestServerRequest(t, fmt.Sprintf("%s?id=%d", slow.URL, idx)))
+	}
+
+	for idx := 0; idx < fastCount; idx++ {
+		reqs = append(reqs, newTestServerRequest(t, fast.URL))
+	}
+
+	svc.HTTP.
+		MaxInFlight(1).
+		MaxRetries(1).
+		Backoff(ConstantBackoff{Delay: backoff}).
+		Requests(reqs...)
+
+	if _, err := iterateAll(t, svc.HTTP); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The requests to the fast host are made while the slow host's
+	// requests wait out their backoff, rather than after them.
+	if !fastDone.Before(slowRetry) {
+		t.Errorf("expected the fast host to be done before the slow host was retried, "+
+			"done at %v and retried at %v", fastDone, slowRetry)
+	}
+}
+
+func TestRequestPhases(t *testing.T) {
+	t.Parallel()
+
+	reqs := newHTTPRequests(4)
+	WithPriority(2)(reqs[0])
+	WithPriority(1)(reqs[2])
+
+	phases := requestPhases(reqs)
+
+	want := [][]*Request{{reqs[1], reqs[3]}, {reqs[2]}, {reqs[0]}}
+	if len(phases) != len(want) {
+		t.Fatalf("expected %d phases, got %d", len(want), len(phases))
+	}
+
+	for idx := range want {
+		if len(phases[idx]) != len(want[idx]) {
+			t.Fatalf("expected phase %d to have %d requests, got %d",
+				idx, len(want[idx]), len(phases[idx]))
+		}
+
+		for jdx := range want[idx] {
+			if phases[idx][jdx] != want[idx][jdx] {
+				t.Errorf("unexpected request at phase %d index %d", idx, jdx)
+			}
+		}
+	}
+}
+
+func TestHTTPServiceStoreProtobuf(t *testing.T) {
+	t.Parallel()
+
+	msg, err := structpb.NewStruct(map[string]interface{}{"id": "1"})
+	if err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("failed to marshal message: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	writer := &mockListWriter{}
+
+	svc.HTTP.Requests(newTestServerRequest(t, server.URL,
+		WithWriters(writer), WithProtoMessage(&structpb.Struct{})))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	assertSocketWrites(t, []ListWriter{writer}, [][]byte{[]byte(`[{"id":"1"}]`)})
+}
+
+func TestHTTPServiceFetchOnly(t *testing.T) {
+	t.Parallel()
+
+	const malformed = `[{"id":`
+
+	for _, tcase := range []struct {
+		name      string
+		fetchOnly bool
+		writers   []ListWriter
+		wantErr   bool
+	}{
+		{name: "fetch only without writers", fetchOnly: true},
+		{name: "without writers", wantErr: true},
+		{name: "fetch only with a nop writer", fetchOnly: true, writers: []ListWriter{NopWriter{}}, wantErr: true},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			reqs := newHTTPRequests(1)
+			reqs[0].writers = tcase.writers
+
+			svc.HTTP.FetchOnly(tcase.fetchOnly).Requests(reqs...)
+			svc.HTTP.client = newMockHTTPClient(withMockHTTPClientResponseBody(reqs[0], []byte(malformed)))
+
+			err = svc.HTTP.Store(context.Background())
+			if tcase.wantErr != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tcase.wantErr, err)
+			}
+
+			result := svc.HTTP.Result()
+
+			if result.Requests != 1 || result.Bytes != int64(len(malformed)) {
+				t.Errorf("expected 1 request of %d bytes, got %d of %d", len(malformed),
+					result.Requests, result.Bytes)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceDryRun(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name        string
+		body        string
+		wantErr     bool
+		wantRecords int64
+	}{
+		{
+			name:        "records are counted",
+			body:        `[{"id":1},{"id":2},{"id":3}]`,
+			wantRecords: 3,
+		},
+		{
+			name:    "decode errors surface",
+			body:    `[{"id":`,
+			wantErr: true,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			store, err := NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoints.json"))
+			if err != nil {
+				t.Fatalf("failed to create checkpoint store: %v", err)
+			}
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			// The writer is unreachable, but it is never pinged in a
+			// dry run.
+			writer := &mockPingWriter{pingErr: errors.New("unreachable")}
+
+			reqs := newHTTPRequests(1)
+			reqs[0].writers = []ListWriter{writer}
+
+			svc.HTTP.
+				DryRun(true).
+				Checkpoint(store).
+				Requests(reqs...)
+			svc.HTTP.client = newMockHTTPClient(withMockHTTPClientResponseBody(reqs[0], []byte(tcase.body)))
+
+			err = svc.HTTP.Store(context.Background())
+			if tcase.wantErr != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tcase.wantErr, err)
+			}
+
+			result := svc.HTTP.Result()
+
+			if !result.DryRun {
+				t.Errorf("expected the result to be a dry run")
+			}
+
+			if result.Requests != 1 {
+				t.Errorf("expected 1 request, got %d", result.Requests)
+			}
+
+			if result.Records != tcase.wantRecords {
+				t.Errorf("expected %d records, got %d", tcase.wantRecords, result.Records)
+			}
+
+			if writer.pings != 0 || writer.count != 0 {
+				t.Errorf("expected no pings or writes, got %d pings and %d writes", writer.pings, writer.count)
+			}
+
+			done, err := store.IsDone(context.Background(), checkpointKey(reqs[0].http))
+			if err != nil {
+				t.Fatalf("failed to check checkpoint: %v", err)
+			}
+
+			if done {
+				t.Errorf("expected the request not to be checkpointed")
+			}
+		})
+	}
+}
+
+func TestHTTPIteratorServiceVariablePages(t *testing.T) {
+	t.Parallel()
+
+	// The number of pages of each request is in its path, and each page
+	// follows the previous one by cursor.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var pages, page int
+
+		fmt.Sscanf(r.URL.Path, "/%d", &pages)         //nolint:errcheck
+		fmt.Sscan(r.URL.Query().Get("cursor"), &page) //nolint:errcheck
+
+		next := ""
+		if page < pages-1 {
+			next = fmt.Sprint(page + 1)
+		}
+
+		fmt.Fprintf(w, `{"page":%d,"next_cursor":%q}`, page, next)
+	}))
+	defer server.Close()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	// Many more responses than requests, across two phases, so that the
+	// responses outnumber the buffer of the iterator.
+	var (
+		reqs []*Request
+		want int
+	)
+
+	for pages := 1; pages <= 12; pages++ {
+		reqs = append(reqs, newTestServerRequest(t, fmt.Sprintf("%s/%d", server.URL, pages),
+			WithPriority(pages%2), WithPagination(CursorPaginate("next_cursor", "cursor"))))
+
+		want += pages
+	}
+
+	svc.HTTP.Requests(reqs...)
+
+	rsps, err := iterateAll(t, svc.HTTP)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(rsps) != want {
+		t.Errorf("expected %d responses, got %d", want, len(rsps))
+	}
+}
+
+func TestHTTPIteratorServiceManyErrors(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	// Every request fails, so there are more errors than the iterator
+	// will read.
+	reqs := make([]*Request, 10)
+	for idx := range reqs {
+		reqs[idx] = newTestServerRequest(t, url)
+	}
+
+	svc.HTTP.Requests(reqs...)
+
+	if _, err := iterateAll(t, svc.HTTP); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	currentCh := svc.HTTP.Iterator.currentChan
+
+	if err := svc.HTTP.Iterator.Close(); err != nil {
+		t.Fatalf("failed to close iterator: %v", err)
+	}
+
+	if svc.HTTP.Iterator.Next(context.Background()) {
+		t.Errorf("expected a closed iterator to have no more responses")
+	}
+
+	// The workers must run to completion rather than blocking on an
+	// error or a response, at which point the channel is closed.
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case _, ok := <-currentCh:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("expected the workers to complete once the iterator is closed")
+		}
+	}
+}
+
+func TestHTTPServiceWriteBuffer(t *testing.T) {
+	t.Parallel()
+
+	// Each page has 1,000 records, and the last page is the tenth, so a
+	// single request decodes into 10,000 records. The cursor to the next
+	// page is in a header, so that the body is the array of records.
+	const pages, perPage = 10, 1000
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var page int
+
+		fmt.Sscan(r.URL.Query().Get("cursor"), &page) //nolint:errcheck
+
+		records := make([]string, perPage)
+		for idx := range records {
+			records[idx] = fmt.Sprintf(`{"id":%d}`, page*perPage+idx)
+		}
+
+		if page < pages-1 {
+			w.Header().Set("X-Next-Cursor", fmt.Sprint(page+1))
+		}
+
+		fmt.Fprintf(w, "[%s]", strings.Join(records, ","))
+	}))
+	t.Cleanup(server.Close)
+
+	for _, buffer := range []int{0, 1} {
+		buffer := buffer
+
+		t.Run(fmt.Sprintf("buffer %d", buffer), func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			svc, err := NewService(ctx)
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			svc.HTTP.WriteBuffer(buffer).Requests(newTestServerRequest(t, server.URL,
+				WithWriters(&mockListWriter{}),
+				WithPagination(CursorPaginate("X-Next-Cursor", "cursor", WithCursorHeader()))))
+
+			if err := svc.HTTP.Store(ctx); err != nil {
+				t.Fatalf("failed to store: %v", err)
+			}
+
+			if got := svc.HTTP.Result().Records; got != pages*perPage {
+				t.Errorf("expected %d records, got %d", pages*perPage, got)
+			}
+		})
+	}
+}
+
+func TestHTTPIteratorServiceOrdered(t *testing.T) {
+	t.Parallel()
+
+	const reqCount = 5
+
+	// The earlier the request, the slower its response, so that the
+	// responses complete in the reverse of the order they were requested.
+	// Each request has two pages.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var idx int
+
+		fmt.Sscanf(r.URL.Path, "/%d", &idx) //nolint:errcheck
+
+		time.Sleep(time.Duration(reqCount-idx) * 20 * time.Millisecond)
+
+		if r.URL.Query().Get("page") == "" {
+			w.Header().Set("X-Next-Page", "1")
+		}
+
+		fmt.Fprint(w, `[]`)
+	}))
+	t.Cleanup(server.Close)
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	var want []string
+
+	for idx := 0; idx < reqCount; idx++ {
+		svc.HTTP.Requests(newTestServerRequest(t, fmt.Sprintf("%s/%d", server.URL, idx),
+			WithPagination(CursorPaginate("X-Next-Page", "page", WithCursorHeader()))))
+
+		want = append(want, fmt.Sprintf("/%d", idx), fmt.Sprintf("/%d?page=1", idx))
+	}
+
+	svc.HTTP.Ordered(true)
+
+	rsps, err := iterateAll(t, svc.HTTP)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := make([]string, 0, len(rsps))
+	for _, rsp := range rsps {
+		got = append(got, rsp.Request.URL.RequestURI())
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected responses in order %v, got %v", want, got)
+	}
+}
+
+func TestHTTPServiceRequestsChan(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":%q}]`, r.URL.Query().Get("id"))
+	}))
+	t.Cleanup(server.Close)
+
+	t.Run("requests received over time", func(t *testing.T) {
+		t.Parallel()
+
+		const count = 5
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		writer := &mockListWriter{}
+		reqs := make(chan *Request)
+
+		go func() {
+			defer close(reqs)
+
+			for idx := 0; idx < count; idx++ {
+				time.Sleep(5 * time.Millisecond)
+
+				reqs <- newTestServerRequest(t, fmt.Sprintf("%s?id=%d", server.URL, idx),
+					WithWriters(writer))
+			}
+		}()
+
+		svc.HTTP.
+			Requests(newTestServerRequest(t, server.URL+"?id=static", WithWriters(writer))).
+			RequestsChan(reqs)
+
+		if err := svc.HTTP.Store(context.Background()); err != nil {
+			t.Fatalf("failed to store: %v", err)
+		}
+
+		// Every request, including the ones received from the
+		// channel, has been written before Store returns.
+		if writer.count != count+1 {
+			t.Errorf("expected %d lists, got %d", count+1, writer.count)
+		}
+	})
+
+	t.Run("canceled before the channel is closed", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		svc, err := NewService(ctx)
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		svc.HTTP.RequestsChan(make(chan *Request))
+
+		if err := svc.HTTP.Store(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	})
+}
+
+func TestHTTPServiceClose(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id":1}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	writer := &mockCloseWriter{}
+
+	// The writer is shared by both requests, but is only closed once.
+	svc.HTTP.Requests(
+		newTestServerRequest(t, server.URL, WithWriters(writer)),
+		newTestServerRequest(t, server.URL, WithWriters(writer, &mockListWriter{})))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := svc.HTTP.Close(); err != nil {
+			t.Fatalf("failed to close: %v", err)
+		}
+	}
+
+	if writer.closes != 1 {
+		t.Errorf("expected the writer to be closed once, got %d", writer.closes)
+	}
+
+	if writer.committedAtClose != 2 {
+		t.Errorf("expected 2 lists committed before the writer was closed, got %d", writer.committedAtClose)
+	}
+}
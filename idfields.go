@@ -0,0 +1,43 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import "context"
+
+type idFieldsKey struct{}
+
+// WithIDFields sets the fields of a record that together identify it, e.g.
+// "id", or "product_id" and "unix". The fields are propagated to the list
+// writers through the context, see IDFieldsFromContext, so that a writer can
+// use them to resolve conflicts instead of inferring a key from the target's
+// schema. For example, a MongoDB writer could derive the "_id" from them, and a
+// Postgres writer could use them as the "ON CONFLICT" target.
+func WithIDFields(fields ...string) RequestOption {
+	return func(req *Request) {
+		req.idFields = fields
+	}
+}
+
+// IDFieldsFromContext will return the fields that identify the records being
+// written, if the request that produced them set any, see WithIDFields.
+func IDFieldsFromContext(ctx context.Context) ([]string, bool) {
+	fields, ok := ctx.Value(idFieldsKey{}).([]string)
+
+	return fields, ok
+}
+
+// contextWithIDFields will return a copy of the context carrying the ID fields.
+// If there are no ID fields, then the context is returned unchanged.
+func contextWithIDFields(ctx context.Context, fields []string) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, idFieldsKey{}, fields)
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestIDFields(t *testing.T) {
+	t.Parallel()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	writer := &mockContextWriter{}
+
+	reqs := newHTTPRequests(2)
+	for _, req := range reqs {
+		req.writers = []ListWriter{writer}
+	}
+
+	idFields := []string{"product_id", "unix"}
+	WithIDFields(idFields...)(reqs[0])
+
+	svc.HTTP.Requests(reqs...)
+	svc.HTTP.client = newMockHTTPClient(withMockHTTPClientRequests(reqs...))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	if len(writer.ctxs) != len(reqs) {
+		t.Fatalf("expected %d writes, got %d", len(reqs), len(writer.ctxs))
+	}
+
+	var withFields, withoutFields int
+
+	for _, ctx := range writer.ctxs {
+		got, ok := IDFieldsFromContext(ctx)
+		if !ok {
+			withoutFields++
+
+			continue
+		}
+
+		withFields++
+
+		if !reflect.DeepEqual(got, idFields) {
+			t.Errorf("expected ID fields %v, got %v", idFields, got)
+		}
+	}
+
+	if withFields != 1 || withoutFields != 1 {
+		t.Errorf("expected one write with ID fields and one without, got %d and %d",
+			withFields, withoutFields)
+	}
+}
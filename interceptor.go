@@ -0,0 +1,130 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrRequestInterceptor is returned when a request interceptor fails, wrapping
+// the interceptor's error.
+var ErrRequestInterceptor = errors.New("request interceptor failed")
+
+// ErrResponseInterceptor is returned when a response interceptor fails,
+// wrapping the interceptor's error.
+var ErrResponseInterceptor = errors.New("response interceptor failed")
+
+// ErrSkipResponse can be returned by a response interceptor to skip the
+// response: it is not stored or returned by the iterator, and any following
+// pages are not requested. Unlike any other error, it does not fail the run.
+var ErrSkipResponse = errors.New("skip response")
+
+// RequestInterceptor is a function that can modify an outgoing request just
+// before it is made, e.g. to sign a nonce or to add a correlation header. An
+// error aborts the request.
+type RequestInterceptor func(req *http.Request) error
+
+// RequestInterceptors adds interceptors that are called, in the order they are
+// added, immediately before each attempt at a request is made. They see the
+// final request, after the service and request headers and the user agent have
+// been set, and after the request has been authenticated by its auth round
+// tripper, see WithAuth. An interceptor is called again for each retry of a
+// request, with a fresh copy of the request, so its changes are not carried
+// over to the next attempt. If an interceptor returns an error, then the
+// request is not made or retried, and the error is returned wrapped in an
+// ErrRequestInterceptor error.
+func (svc *HTTPService) RequestInterceptors(interceptors ...RequestInterceptor) *HTTPService {
+	svc.reqInterceptors = append(svc.reqInterceptors, interceptors...)
+
+	return svc
+}
+
+// interceptRequest will call each of the interceptors on the request, in
+// order, stopping at the first error.
+func interceptRequest(req *http.Request, interceptors []RequestInterceptor) error {
+	for _, intercept := range interceptors {
+		if err := intercept(req); err != nil {
+			return fmt.Errorf("%w: %w", ErrRequestInterceptor, err)
+		}
+	}
+
+	return nil
+}
+
+// interceptTransport is a transport that calls the request interceptors on
+// each request before making it over the next transport. It follows the auth
+// round tripper of a request, so that the interceptors see the authenticated
+// request.
+type interceptTransport struct {
+	next         http.RoundTripper
+	interceptors []RequestInterceptor
+}
+
+// RoundTrip will intercept the request and then make it.
+func (it *interceptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := interceptRequest(req, it.interceptors); err != nil {
+		return nil, err
+	}
+
+	return it.next.RoundTrip(req) //nolint:wrapcheck
+}
+
+// ResponseInterceptor is a function that can inspect or modify a response
+// before it is stored, e.g. to detect a soft-ban page or to record rate limit
+// headers. It can return ErrSkipResponse to skip the response, and any other
+// error aborts it.
+type ResponseInterceptor func(rsp *http.Response) error
+
+// ResponseInterceptors adds interceptors that are called, in the order they
+// are added, on each response once any retries are done, before it is
+// paginated, decoded, or returned by the iterator. The body has already been
+// read: each interceptor is given a body over the same data, so reading it
+// does not consume it for the others, but replacing it has no effect.
+//
+// Interceptors see every response, including those that do not have a 200
+// (OK) status, which "Store" fails on with an ErrBadResponse error unless the
+// request expects it, see WithExpectStatus. An interceptor can override that,
+// e.g. by returning ErrSkipResponse for a 404 (Not Found), or by changing the
+// status code of a soft error. If an interceptor returns ErrSkipResponse, then
+// no more interceptors are called. If it returns any other error, then the
+// error is returned wrapped in an ErrResponseInterceptor error and the
+// response is discarded.
+func (svc *HTTPService) ResponseInterceptors(interceptors ...ResponseInterceptor) *HTTPService {
+	svc.rspInterceptors = append(svc.rspInterceptors, interceptors...)
+
+	return svc
+}
+
+// interceptResponse will call each of the interceptors on the response, in
+// order, stopping at the first error. The body of the response is reset to the
+// data before each interceptor, and once they are done.
+func interceptResponse(rsp *http.Response, data []byte, interceptors []ResponseInterceptor) error {
+	defer func() {
+		rsp.Body = io.NopCloser(bytes.NewReader(data))
+	}()
+
+	for _, intercept := range interceptors {
+		rsp.Body = io.NopCloser(bytes.NewReader(data))
+
+		err := intercept(rsp)
+		if errors.Is(err, ErrSkipResponse) {
+			return err
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrResponseInterceptor, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,341 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alpstable/gidari/auth"
+)
+
+var errInterceptor = errors.New("interceptor failed")
+
+func TestHTTPServiceRequestInterceptors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("in order on the final request", func(t *testing.T) {
+		t.Parallel()
+
+		var got atomic.Value
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got.Store(r.Header.Get("X-Trace"))
+		}))
+		defer server.Close()
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		// Each interceptor appends to the header, which starts as the
+		// request's header, so the value records the order.
+		appendTrace := func(name string) RequestInterceptor {
+			return func(req *http.Request) error {
+				req.Header.Set("X-Trace", req.Header.Get("X-Trace")+","+name)
+
+				return nil
+			}
+		}
+
+		svc.HTTP.
+			RequestInterceptors(appendTrace("a")).
+			RequestInterceptors(appendTrace("b"), appendTrace("c")).
+			Requests(newTestServerRequest(t, server.URL,
+				WithHeaders(http.Header{"X-Trace": []string{"req"}})))
+
+		if err := svc.HTTP.Store(context.Background()); err != nil {
+			t.Fatalf("failed to store: %v", err)
+		}
+
+		if want := "req,a,b,c"; got.Load() != want {
+			t.Errorf("expected header %q, got %q", want, got.Load())
+		}
+	})
+
+	t.Run("called for each retry", func(t *testing.T) {
+		t.Parallel()
+
+		server, calls := newFlakyServer(t, 2, http.StatusServiceUnavailable, "")
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		var intercepted int32
+
+		svc.HTTP.
+			MaxRetries(2).
+			RetryBackoff(time.Millisecond).
+			RequestInterceptors(func(*http.Request) error {
+				atomic.AddInt32(&intercepted, 1)
+
+				return nil
+			}).
+			Requests(newTestServerRequest(t, server.URL))
+
+		if err := svc.HTTP.Store(context.Background()); err != nil {
+			t.Fatalf("failed to store: %v", err)
+		}
+
+		if got, want := atomic.LoadInt32(&intercepted), atomic.LoadInt32(calls); got != want || got != 3 {
+			t.Errorf("expected 3 interceptions and calls, got %d and %d", got, want)
+		}
+	})
+
+	t.Run("error aborts the request", func(t *testing.T) {
+		t.Parallel()
+
+		server, calls := newFlakyServer(t, 0, http.StatusOK, "")
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		var later int32
+
+		svc.HTTP.
+			MaxRetries(2).
+			RequestInterceptors(
+				func(*http.Request) error { return errInterceptor },
+				func(*http.Request) error {
+					atomic.AddInt32(&later, 1)
+
+					return nil
+				}).
+			Requests(newTestServerRequest(t, server.URL))
+
+		err = svc.HTTP.Store(context.Background())
+		if !errors.Is(err, ErrRequestInterceptor) || !errors.Is(err, errInterceptor) {
+			t.Fatalf("expected error %v, got %v", errInterceptor, err)
+		}
+
+		if got := atomic.LoadInt32(calls); got != 0 {
+			t.Errorf("expected no requests to be made, got %d", got)
+		}
+
+		if got := atomic.LoadInt32(&later); got != 0 {
+			t.Errorf("expected later interceptors not to be called, got %d", got)
+		}
+	})
+
+	t.Run("after auth", func(t *testing.T) {
+		t.Parallel()
+
+		server, calls := newFlakyServer(t, 0, http.StatusOK, "")
+
+		basicAuth, err := auth.NewBasicAuthRoundTrip("user", "pass")
+		if err != nil {
+			t.Fatalf("failed to create auth round tripper: %v", err)
+		}
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		var authorized atomic.Bool
+
+		svc.HTTP.
+			RequestInterceptors(func(req *http.Request) error {
+				_, _, ok := req.BasicAuth()
+				authorized.Store(ok)
+
+				return nil
+			}).
+			Requests(newTestServerRequest(t, server.URL, WithAuth(basicAuth)))
+
+		if err := svc.HTTP.Store(context.Background()); err != nil {
+			t.Fatalf("failed to store: %v", err)
+		}
+
+		if !authorized.Load() {
+			t.Error("expected the interceptor to see the authenticated request")
+		}
+
+		if got := atomic.LoadInt32(calls); got != 1 {
+			t.Errorf("expected one request to be made, got %d", got)
+		}
+	})
+
+	t.Run("error aborts the authenticated request", func(t *testing.T) {
+		t.Parallel()
+
+		server, calls := newFlakyServer(t, 0, http.StatusOK, "")
+
+		basicAuth, err := auth.NewBasicAuthRoundTrip("user", "pass")
+		if err != nil {
+			t.Fatalf("failed to create auth round tripper: %v", err)
+		}
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		svc.HTTP.
+			MaxRetries(2).
+			RequestInterceptors(func(*http.Request) error { return errInterceptor }).
+			Requests(newTestServerRequest(t, server.URL, WithAuth(basicAuth)))
+
+		err = svc.HTTP.Store(context.Background())
+		if !errors.Is(err, ErrRequestInterceptor) || !errors.Is(err, errInterceptor) {
+			t.Fatalf("expected error %v, got %v", errInterceptor, err)
+		}
+
+		if got := atomic.LoadInt32(calls); got != 0 {
+			t.Errorf("expected no requests to be made, got %d", got)
+		}
+	})
+}
+
+func TestHTTPServiceResponseInterceptors(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Ratelimit-Remaining", "9")
+
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/banned":
+			fmt.Fprint(w, `{"error":"slow down"}`)
+		case "/paged":
+			fmt.Fprint(w, `{"id":1,"next_cursor":"2"}`)
+		default:
+			fmt.Fprint(w, `[{"id":1},{"id":2}]`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	// skipMissing will skip a 404 (Not Found) response, rather than
+	// failing the run.
+	skipMissing := func(rsp *http.Response) error {
+		if rsp.StatusCode == http.StatusNotFound {
+			return ErrSkipResponse
+		}
+
+		return nil
+	}
+
+	// detectBan will abort a soft-ban page, which has a 200 (OK) status.
+	detectBan := func(rsp *http.Response) error {
+		body, err := io.ReadAll(rsp.Body)
+		if err != nil {
+			return err
+		}
+
+		if strings.Contains(string(body), "slow down") {
+			return errInterceptor
+		}
+
+		return nil
+	}
+
+	for _, tcase := range []struct {
+		name         string
+		path         string
+		opts         []RequestOption
+		interceptors []ResponseInterceptor
+		wantErr      error
+		wantRequests int64
+		wantRecords  int64
+	}{
+		{
+			name:         "records are stored after reading the body",
+			interceptors: []ResponseInterceptor{skipMissing, detectBan, detectBan},
+			wantRequests: 1,
+			wantRecords:  2,
+		},
+		{
+			name:         "non-2xx fails by default",
+			path:         "/missing",
+			wantErr:      ErrBadResponse,
+			wantRequests: 1,
+		},
+		{
+			name:         "skip",
+			path:         "/missing",
+			interceptors: []ResponseInterceptor{skipMissing},
+			wantRequests: 1,
+		},
+		{
+			name:         "abort",
+			path:         "/banned",
+			interceptors: []ResponseInterceptor{detectBan},
+			wantErr:      errInterceptor,
+			wantRequests: 1,
+		},
+		{
+			name:         "skip ends pagination",
+			path:         "/paged",
+			opts:         []RequestOption{WithPagination(CursorPaginate("next_cursor", "cursor"))},
+			interceptors: []ResponseInterceptor{func(*http.Response) error { return ErrSkipResponse }},
+			wantRequests: 1,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			var remaining atomic.Value
+
+			opts := append([]RequestOption{WithWriters(&mockListWriter{})}, tcase.opts...)
+
+			svc.HTTP.
+				ResponseInterceptors(func(rsp *http.Response) error {
+					remaining.Store(rsp.Header.Get("X-Ratelimit-Remaining"))
+
+					return nil
+				}).
+				ResponseInterceptors(tcase.interceptors...).
+				Requests(newTestServerRequest(t, server.URL+tcase.path, opts...))
+
+			err = svc.HTTP.Store(context.Background())
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+
+			if err != nil && tcase.wantErr == errInterceptor && !errors.Is(err, ErrResponseInterceptor) {
+				t.Errorf("expected error %v, got %v", ErrResponseInterceptor, err)
+			}
+
+			if got := remaining.Load(); got != "9" {
+				t.Errorf("expected the rate limit header to be captured, got %v", got)
+			}
+
+			result := svc.HTTP.Result()
+
+			if result.Requests != tcase.wantRequests {
+				t.Errorf("expected %d requests, got %d", tcase.wantRequests, result.Requests)
+			}
+
+			if result.Records != tcase.wantRecords {
+				t.Errorf("expected %d records, got %d", tcase.wantRecords, result.Records)
+			}
+		})
+	}
+}
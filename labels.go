@@ -0,0 +1,91 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"errors"
+	"fmt"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrLabelConflict is returned when a label has the same key as a field of a
+// record and the request's label conflict policy is LabelConflictError.
+var ErrLabelConflict = errors.New("label conflicts with a record field")
+
+// LabelConflict determines what happens when a label set with WithLabels has
+// the same key as a field of a record.
+type LabelConflict uint8
+
+const (
+	// LabelConflictKeepField keeps the record's field and ignores the
+	// label. This is the default.
+	LabelConflictKeepField LabelConflict = iota
+
+	// LabelConflictOverwrite replaces the record's field with the label.
+	LabelConflictOverwrite
+
+	// LabelConflictError fails the write with an ErrLabelConflict error.
+	LabelConflictError
+)
+
+// WithLabels will set static fields on every record of the request before it
+// is written, e.g. {"source": "coinbase", "asset": "BTC-USD"}, so that records
+// from many endpoints can share a table and still be told apart. Labels are
+// set after the record has been flattened, see WithFlatten. By default, a
+// record's own field takes precedence over a label with the same key, see
+// WithLabelConflict.
+func WithLabels(labels map[string]string) RequestOption {
+	return func(req *Request) {
+		req.labels = labels
+	}
+}
+
+// WithLabelConflict sets how a label that has the same key as a field of a
+// record is handled, see LabelConflict.
+func WithLabelConflict(policy LabelConflict) RequestOption {
+	return func(req *Request) {
+		req.labelConflict = policy
+	}
+}
+
+// labelList will set the labels on every record in the list. Values of the
+// list that are not records are left as they are.
+func labelList(list *structpb.ListValue, labels map[string]string, policy LabelConflict) error {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	for _, val := range list.Values {
+		record := val.GetStructValue()
+		if record == nil {
+			continue
+		}
+
+		if record.Fields == nil {
+			record.Fields = make(map[string]*structpb.Value, len(labels))
+		}
+
+		for key, label := range labels {
+			if _, ok := record.Fields[key]; ok {
+				switch policy {
+				case LabelConflictKeepField:
+					continue
+				case LabelConflictError:
+					return fmt.Errorf("%w: %q", ErrLabelConflict, key)
+				case LabelConflictOverwrite:
+				}
+			}
+
+			record.Fields[key] = structpb.NewStringValue(label)
+		}
+	}
+
+	return nil
+}
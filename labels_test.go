@@ -0,0 +1,116 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestHTTPServiceLabels(t *testing.T) {
+	t.Parallel()
+
+	const body = `[{"id":1,"source":"body"},{"id":2},"not a record"]`
+
+	labels := map[string]string{"source": "coinbase", "asset": "BTC-USD"}
+
+	for _, tcase := range []struct {
+		name    string
+		opts    []RequestOption
+		want    []interface{}
+		wantErr error
+	}{
+		{
+			name: "keep field",
+			want: []interface{}{
+				map[string]interface{}{"id": 1.0, "source": "body", "asset": "BTC-USD"},
+				map[string]interface{}{"id": 2.0, "source": "coinbase", "asset": "BTC-USD"},
+				"not a record",
+			},
+		},
+		{
+			name: "overwrite",
+			opts: []RequestOption{WithLabelConflict(LabelConflictOverwrite)},
+			want: []interface{}{
+				map[string]interface{}{"id": 1.0, "source": "coinbase", "asset": "BTC-USD"},
+				map[string]interface{}{"id": 2.0, "source": "coinbase", "asset": "BTC-USD"},
+				"not a record",
+			},
+		},
+		{
+			name:    "error",
+			opts:    []RequestOption{WithLabelConflict(LabelConflictError)},
+			wantErr: ErrLabelConflict,
+		},
+		{
+			name: "flattened before labeling",
+			opts: []RequestOption{WithFlatten(), WithLabels(map[string]string{"meta_source": "label"})},
+			want: []interface{}{
+				map[string]interface{}{"id": 1.0, "source": "body", "meta_source": "label"},
+				map[string]interface{}{"id": 2.0, "meta_source": "label"},
+				"not a record",
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			writer := &mockListWriter{}
+
+			reqs := newHTTPRequests(1)
+			reqs[0].writers = []ListWriter{writer}
+
+			WithLabels(labels)(reqs[0])
+
+			for _, opt := range tcase.opts {
+				opt(reqs[0])
+			}
+
+			svc.HTTP.Requests(reqs...)
+			svc.HTTP.client = newMockHTTPClient(withMockHTTPClientResponseBody(reqs[0], []byte(body)))
+
+			err = svc.HTTP.Store(context.Background())
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+
+			if tcase.wantErr != nil {
+				if len(writer.data) != 0 {
+					t.Errorf("expected no writes, got %d", len(writer.data))
+				}
+
+				return
+			}
+
+			if len(writer.data) != 1 {
+				t.Fatalf("expected 1 write, got %d", len(writer.data))
+			}
+
+			list := &structpb.ListValue{}
+			if err := list.UnmarshalJSON(writer.data[0]); err != nil {
+				t.Fatalf("failed to unmarshal written data: %v", err)
+			}
+
+			if got := list.AsSlice(); !reflect.DeepEqual(got, tcase.want) {
+				t.Errorf("expected %v, got %v", tcase.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// redacted is the value used in place of sensitive header values when logging.
+const redacted = "REDACTED"
+
+// sensitiveHeaders are the canonical header keys whose values must never be
+// written to a log.
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+}
+
+// redactHeader will return a copy of the provided header with the values of
+// sensitive keys, and of any extra keys, replaced. The original header is not
+// modified.
+func redactHeader(header http.Header, extra ...string) http.Header {
+	clone := header.Clone()
+
+	for _, keys := range [][]string{sensitiveHeaders, extra} {
+		for _, key := range keys {
+			key = http.CanonicalHeaderKey(key)
+			if _, ok := clone[key]; ok {
+				clone.Set(key, redacted)
+			}
+		}
+	}
+
+	return clone
+}
+
+// requestAttrs will return the attributes used to identify a request in a log
+// entry.
+func requestAttrs(req *http.Request) []slog.Attr {
+	return []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", req.URL.Redacted()),
+		slog.Any("header", redactHeader(req.Header)),
+	}
+}
+
+// logRequestComplete will log the outcome of a request made by a web worker.
+func logRequestComplete(ctx context.Context, logger *slog.Logger, req *http.Request, rsp *http.Response,
+	err error, duration time.Duration,
+) {
+	attrs := append(requestAttrs(req), slog.Duration("duration", duration))
+
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+		logger.LogAttrs(ctx, slog.LevelError, "request failed", attrs...)
+
+		return
+	}
+
+	attrs = append(attrs, slog.Int("status", rsp.StatusCode))
+	logger.LogAttrs(ctx, slog.LevelDebug, "request completed", attrs...)
+}
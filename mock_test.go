@@ -66,14 +66,18 @@ type mockHTTPClientResponseError struct {
 
 type mockHTTPClient struct {
 	mutex     sync.Mutex
-	responses map[*http.Request]*mockHTTPClientResponseError
+	responses map[string]*mockHTTPClientResponseError
+
+	// calls are the requests made to the client, in the order they were
+	// made.
+	calls []*http.Request
 }
 
 type mockHTTPClientOption func(*mockHTTPClient)
 
 func newMockHTTPClient(opts ...mockHTTPClientOption) *mockHTTPClient {
 	client := &mockHTTPClient{
-		responses: make(map[*http.Request]*mockHTTPClientResponseError),
+		responses: make(map[string]*mockHTTPClientResponseError),
 	}
 
 	for _, opt := range opts {
@@ -101,17 +105,38 @@ func withMockHTTPClientRequests(reqs ...*Request) mockHTTPClientOption {
 
 			// If the request has already been set, then just
 			// update the response.
-			if _, ok := client.responses[req.http]; ok {
-				client.responses[req.http].rsp = rspErr.rsp
+			if _, ok := client.responses[checkpointKey(req.http)]; ok {
+				client.responses[checkpointKey(req.http)].rsp = rspErr.rsp
 
 				continue
 			}
 
-			client.responses[req.http] = rspErr
+			client.responses[checkpointKey(req.http)] = rspErr
 		}
 	}
 }
 
+// withMockHTTPClientResponseBody will set the body of the response for the
+// provided request.
+func withMockHTTPClientResponseBody(req *Request, body []byte) mockHTTPClientOption {
+	return func(client *mockHTTPClient) {
+		rsp := &http.Response{
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			StatusCode:    http.StatusOK,
+			Request:       req.http,
+		}
+
+		if _, ok := client.responses[checkpointKey(req.http)]; ok {
+			client.responses[checkpointKey(req.http)].rsp = rsp
+
+			return
+		}
+
+		client.responses[checkpointKey(req.http)] = &mockHTTPClientResponseError{rsp: rsp}
+	}
+}
+
 func withMockHTTPClientResponseError(req *Request, err error) mockHTTPClientOption {
 	return func(client *mockHTTPClient) {
 		if req == nil {
@@ -124,13 +149,13 @@ func withMockHTTPClientResponseError(req *Request, err error) mockHTTPClientOpti
 
 		// If the request has already been set, then just
 		// update the error.
-		if _, ok := client.responses[req.http]; ok {
-			client.responses[req.http].err = err
+		if _, ok := client.responses[checkpointKey(req.http)]; ok {
+			client.responses[checkpointKey(req.http)].err = err
 
 			return
 		}
 
-		client.responses[req.http] = &mockHTTPClientResponseError{
+		client.responses[checkpointKey(req.http)] = &mockHTTPClientResponseError{
 			err: err,
 		}
 	}
@@ -140,7 +165,11 @@ func (m *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	rsp := m.responses[req]
+	m.calls = append(m.calls, req)
+
+	// The request made is a clone of the request given to the service, so
+	// it is matched by its method and URL.
+	rsp := m.responses[checkpointKey(req)]
 
 	// If the response has an error, return it.
 	if rsp.err != nil {
@@ -222,3 +251,105 @@ func (m *mockConnBlocker) Read(b []byte) (int, error) {
 func (m *mockConnBlocker) Write(b []byte) (int, error) {
 	return len(b), nil
 }
+
+// mockPingWriter is a ListWriter that implements the Pinger interface.
+type mockPingWriter struct {
+	mockUpsertWriter
+
+	pingErr error
+	pings   int
+	pingsMu sync.Mutex
+}
+
+func (m *mockPingWriter) Ping(context.Context) error {
+	m.pingsMu.Lock()
+	defer m.pingsMu.Unlock()
+
+	m.pings++
+
+	return m.pingErr
+}
+
+// mockContextWriter is a ListWriter that records the contexts it is given.
+type mockContextWriter struct {
+	ctxs   []context.Context
+	ctxsMu sync.Mutex
+}
+
+func (m *mockContextWriter) Write(ctx context.Context, _ *structpb.ListValue) error {
+	m.ctxsMu.Lock()
+	defer m.ctxsMu.Unlock()
+
+	m.ctxs = append(m.ctxs, ctx)
+
+	return nil
+}
+
+// mockErrWriter is a ListWriter that always returns an error.
+type mockErrWriter struct {
+	err error
+}
+
+func (m *mockErrWriter) Write(context.Context, *structpb.ListValue) error {
+	return m.err
+}
+
+// mockBlockingWriter is a ListWriter that blocks until the context is done.
+type mockBlockingWriter struct{}
+
+func (m *mockBlockingWriter) Write(ctx context.Context, _ *structpb.ListValue) error {
+	<-ctx.Done()
+
+	return ctx.Err()
+}
+
+// mockTxWriter is a ListWriter that stages the lists written to it in a
+// transaction, which is only committed when it is flushed.
+type mockTxWriter struct {
+	mtx       sync.Mutex
+	staged    int
+	committed int
+	flushes   int
+}
+
+func (m *mockTxWriter) Write(context.Context, *structpb.ListValue) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.staged++
+
+	return nil
+}
+
+func (m *mockTxWriter) Flush(context.Context) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.committed += m.staged
+	m.staged = 0
+	m.flushes++
+
+	return nil
+}
+
+// mockCloseWriter is a transactional ListWriter that counts the times it is
+// closed, and the lists that were committed when it was first closed.
+type mockCloseWriter struct {
+	mockTxWriter
+
+	closes           int
+	committedAtClose int
+}
+
+func (m *mockCloseWriter) Close() error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.closes == 0 {
+		m.committedAtClose = m.committed
+	}
+
+	m.closes++
+
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// WriteMode determines how a MultiWriter handles a failure in one of its
+// writers.
+type WriteMode int32
+
+const (
+	// WriteModeBestEffort will attempt the write on every writer, even if
+	// some of them fail, and return the errors of all failed writers. This
+	// is the default mode, so that a transient failure in one writer does
+	// not prevent the data from reaching the others.
+	WriteModeBestEffort WriteMode = iota
+
+	// WriteModeFailFast will cancel the context given to the remaining
+	// writers as soon as one writer fails, returning the first error.
+	WriteModeFailFast
+)
+
+// MultiWriter is a ListWriter that concurrently writes a list to many
+// writers.
+type MultiWriter struct {
+	mode    WriteMode
+	writers []ListWriter
+}
+
+// NewMultiWriter will create a new MultiWriter that fans out writes to the
+// given writers using the given mode.
+func NewMultiWriter(mode WriteMode, writers ...ListWriter) *MultiWriter {
+	return &MultiWriter{mode: mode, writers: writers}
+}
+
+// Write will write the list to every writer concurrently. The method blocks
+// until every writer has returned, regardless of the mode.
+func (mw *MultiWriter) Write(ctx context.Context, list *structpb.ListValue) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		firstErr  error
+		firstOnce sync.Once
+	)
+
+	errs := make([]error, len(mw.writers))
+
+	wg := &sync.WaitGroup{}
+	wg.Add(len(mw.writers))
+
+	for idx, writer := range mw.writers {
+		go func(idx int, writer ListWriter) {
+			defer wg.Done()
+
+			err := writer.Write(ctx, list)
+			if err == nil {
+				return
+			}
+
+			errs[idx] = fmt.Errorf("failed to write to %T: %w", writer, err)
+
+			if mw.mode == WriteModeFailFast {
+				firstOnce.Do(func() {
+					firstErr = errs[idx]
+
+					cancel()
+				})
+			}
+		}(idx, writer)
+	}
+
+	wg.Wait()
+
+	if mw.mode == WriteModeFailFast {
+		return firstErr
+	}
+
+	return errors.Join(errs...)
+}
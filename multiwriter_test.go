@@ -0,0 +1,93 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+var (
+	errWriteFailed  = errors.New("write failed")
+	errWriteFailed2 = errors.New("second write failed")
+)
+
+func TestMultiWriter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("best effort writes to every writer", func(t *testing.T) {
+		t.Parallel()
+
+		healthy := &mockUpsertWriter{}
+		writer := NewMultiWriter(WriteModeBestEffort,
+			&mockErrWriter{err: errWriteFailed},
+			healthy,
+			&mockErrWriter{err: errWriteFailed2})
+
+		err := writer.Write(context.Background(), &structpb.ListValue{})
+		if !errors.Is(err, errWriteFailed) || !errors.Is(err, errWriteFailed2) {
+			t.Fatalf("expected both errors to be aggregated, got %v", err)
+		}
+
+		if healthy.count != 1 {
+			t.Errorf("expected the healthy writer to be written once, got %d", healthy.count)
+		}
+	})
+
+	t.Run("fail fast cancels the other writers", func(t *testing.T) {
+		t.Parallel()
+
+		writer := NewMultiWriter(WriteModeFailFast,
+			&mockBlockingWriter{},
+			&mockErrWriter{err: errWriteFailed})
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- writer.Write(context.Background(), &structpb.ListValue{})
+		}()
+
+		select {
+		case err := <-errs:
+			if !errors.Is(err, errWriteFailed) {
+				t.Fatalf("expected error %v, got %v", errWriteFailed, err)
+			}
+		case <-time.After(defaultTestTimeout):
+			t.Fatal("timed out waiting for the write to fail")
+		}
+	})
+
+	t.Run("store is best effort by default", func(t *testing.T) {
+		t.Parallel()
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		healthy := &mockUpsertWriter{}
+
+		reqs := newHTTPRequests(1)
+		reqs[0].writers = []ListWriter{&mockErrWriter{err: errWriteFailed}, healthy}
+
+		svc.HTTP.Requests(reqs...)
+		svc.HTTP.client = newMockHTTPClient(withMockHTTPClientRequests(reqs...))
+
+		if err := svc.HTTP.Store(context.Background()); !errors.Is(err, errWriteFailed) {
+			t.Fatalf("expected error %v, got %v", errWriteFailed, err)
+		}
+
+		if healthy.count != 1 {
+			t.Errorf("expected the healthy writer to be written once, got %d", healthy.count)
+		}
+	})
+}
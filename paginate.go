@@ -0,0 +1,250 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrPagination is returned when the next page of a paginated request cannot
+// be determined.
+var ErrPagination = errors.New("pagination error")
+
+// PaginationFunc will return the request for the page that follows the given
+// response, or nil if there are no more pages. The body is the complete
+// response body, which remains readable from the response itself.
+type PaginationFunc func(req *http.Request, rsp *http.Response, body []byte) (*http.Request, error)
+
+// WithPagination sets the function used to request the pages that follow the
+// first response. Each page is made with the same options as the original
+// request, e.g. writers and authentication, and is only requested once the
+// previous page has completed with a 200 (OK) status.
+func WithPagination(fn PaginationFunc) RequestOption {
+	return func(req *Request) {
+		req.paginate = fn
+	}
+}
+
+// nextPage will return the request for the page that follows the response, or
+// nil if the request is not paginated or there are no more pages.
+func (req *Request) nextPage(rsp *http.Response, body []byte) (*Request, error) {
+	if req.paginate == nil || rsp == nil || rsp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+
+	// The pagination function is given the decode function of the request
+	// in the context, so that it can count the records of the response in
+	// the same way as they are decoded for the writers.
+	ctx := context.WithValue(req.http.Context(), pageDecoderKey{}, func() (DecodeFunc, error) {
+		return req.decodeFunc(rsp, body)
+	})
+
+	next, err := req.paginate(req.http.WithContext(ctx), rsp, body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", ErrPagination, req.http.URL.Redacted(), err)
+	}
+
+	if next == nil {
+		return nil, nil
+	}
+
+	if next.Context() == ctx {
+		next = next.WithContext(req.http.Context())
+	}
+
+	page := *req
+	page.http = next
+
+	return &page, nil
+}
+
+// pageDecoderKey is the context key of the function that returns the decode
+// function for the response given to a pagination function, see nextPage.
+type pageDecoderKey struct{}
+
+// pageDecodeFunc will return the function used to decode the records of the
+// response to the request, as they are decoded for the writers. Outside of an
+// HTTP Service, the decode function is found from the response alone.
+func pageDecodeFunc(req *http.Request, rsp *http.Response, body []byte) (DecodeFunc, error) {
+	if decoder, ok := req.Context().Value(pageDecoderKey{}).(func() (DecodeFunc, error)); ok {
+		return decoder()
+	}
+
+	return (&Request{}).decodeFunc(rsp, body)
+}
+
+// cursorOptions are the options used to configure cursor pagination.
+type cursorOptions struct {
+	header bool
+}
+
+// CursorOption is a function that will configure cursor pagination.
+type CursorOption func(*cursorOptions)
+
+// WithCursorHeader will read the cursor from the response header named by the
+// cursor path, rather than from the response body.
+func WithCursorHeader() CursorOption {
+	return func(opts *cursorOptions) {
+		opts.header = true
+	}
+}
+
+// CursorPaginate will return a pagination function for APIs that return a
+// cursor to the next page in the response. The cursor is read from the JSON
+// body at the "cursorPath", a dot-separated list of object keys (e.g.
+// "meta.next_cursor"), and set as the "paramName" query parameter on a clone of
+// the request. Pagination stops when the cursor is absent, null, or empty, or
+// when it matches the cursor of the current request.
+func CursorPaginate(cursorPath, paramName string, opts ...CursorOption) PaginationFunc {
+	cfg := &cursorOptions{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(req *http.Request, rsp *http.Response, body []byte) (*http.Request, error) {
+		var (
+			cursor string
+			err    error
+		)
+
+		if cfg.header {
+			cursor = rsp.Header.Get(cursorPath)
+		} else {
+			cursor, err = jsonCursor(body, cursorPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if cursor == "" || cursor == req.URL.Query().Get(paramName) {
+			return nil, nil
+		}
+
+		return cloneRequestWithQuery(req, paramName, cursor)
+	}
+}
+
+// OffsetPaginate will return a pagination function for APIs that page through
+// results with an offset and a limit. Each page sets the "offsetParam" query
+// parameter to the offset of the previous page plus the "pageSize", and sets
+// the "limitParam" query parameter to the "pageSize". The offset of the first
+// page is read from the request, defaulting to zero. Pagination stops when a
+// page returns fewer than "pageSize" records, where the records are counted in
+// the same way as they are decoded for the writers, e.g. a JSON list is a
+// record per element, a JSON object is a single record, and a CSV body is a
+// record per row. An empty body has no records.
+func OffsetPaginate(offsetParam, limitParam string, pageSize int) PaginationFunc {
+	return func(req *http.Request, rsp *http.Response, body []byte) (*http.Request, error) {
+		if pageSize <= 0 {
+			return nil, fmt.Errorf("page size must be positive, got %d", pageSize)
+		}
+
+		if len(bytes.TrimSpace(body)) == 0 {
+			return nil, nil
+		}
+
+		decFunc, err := pageDecodeFunc(req, rsp, body)
+		if err != nil {
+			return nil, err
+		}
+
+		list := &structpb.ListValue{}
+		if err := decFunc(list); err != nil {
+			return nil, err
+		}
+
+		if len(list.Values) < pageSize {
+			return nil, nil
+		}
+
+		offset := 0
+
+		if param := req.URL.Query().Get(offsetParam); param != "" {
+			offset, err = strconv.Atoi(param)
+			if err != nil {
+				return nil, fmt.Errorf("invalid offset %q: %w", param, err)
+			}
+		}
+
+		next, err := cloneRequestWithQuery(req, offsetParam, strconv.Itoa(offset+pageSize))
+		if err != nil {
+			return nil, err
+		}
+
+		query := next.URL.Query()
+		query.Set(limitParam, strconv.Itoa(pageSize))
+
+		next.URL.RawQuery = query.Encode()
+
+		return next, nil
+	}
+}
+
+// jsonCursor will return the value at the dot-separated path of the JSON body
+// as a string. An empty string is returned if the value is absent or null.
+func jsonCursor(body []byte, path string) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var val any
+	if err := dec.Decode(&val); err != nil {
+		return "", fmt.Errorf("failed to decode cursor: %w", err)
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := val.(map[string]any)
+		if !ok {
+			return "", nil
+		}
+
+		val = obj[key]
+	}
+
+	switch cursor := val.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return cursor, nil
+	case json.Number:
+		return cursor.String(), nil
+	default:
+		return "", fmt.Errorf("cursor at %q is a %T, expected a string or number", path, val)
+	}
+}
+
+// cloneRequestWithQuery will return a clone of the request with the query
+// parameter set to the value.
+func cloneRequestWithQuery(req *http.Request, key, val string) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get request body: %w", err)
+		}
+
+		clone.Body = body
+	}
+
+	query := clone.URL.Query()
+	query.Set(key, val)
+
+	clone.URL.RawQuery = query.Encode()
+
+	return clone, nil
+}
@@ -0,0 +1,449 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCursorPaginate(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name       string
+		cursorPath string
+		opts       []CursorOption
+		url        string
+		header     http.Header
+		body       string
+		want       string // want is the URL of the next page, if any
+		wantErr    bool
+	}{
+		{
+			name:       "top level cursor",
+			cursorPath: "next_cursor",
+			url:        "http://example/items?limit=2",
+			body:       `{"data":[],"next_cursor":"abc"}`,
+			want:       "http://example/items?cursor=abc&limit=2",
+		},
+		{
+			name:       "nested cursor",
+			cursorPath: "meta.next",
+			url:        "http://example/items",
+			body:       `{"data":[],"meta":{"next":"abc"}}`,
+			want:       "http://example/items?cursor=abc",
+		},
+		{
+			name:       "numeric cursor",
+			cursorPath: "next_cursor",
+			url:        "http://example/items?cursor=1",
+			body:       `{"next_cursor":12345678901234567890}`,
+			want:       "http://example/items?cursor=12345678901234567890",
+		},
+		{
+			name:       "absent cursor",
+			cursorPath: "next_cursor",
+			url:        "http://example/items",
+			body:       `{"data":[]}`,
+		},
+		{
+			name:       "null cursor",
+			cursorPath: "meta.next",
+			url:        "http://example/items",
+			body:       `{"meta":{"next":null}}`,
+		},
+		{
+			name:       "empty cursor",
+			cursorPath: "next_cursor",
+			url:        "http://example/items",
+			body:       `{"next_cursor":""}`,
+		},
+		{
+			name:       "repeated cursor",
+			cursorPath: "next_cursor",
+			url:        "http://example/items?cursor=abc",
+			body:       `{"next_cursor":"abc"}`,
+		},
+		{
+			name:       "list body",
+			cursorPath: "next_cursor",
+			url:        "http://example/items",
+			body:       `[{"next_cursor":"abc"}]`,
+		},
+		{
+			name:       "object cursor",
+			cursorPath: "next_cursor",
+			url:        "http://example/items",
+			body:       `{"next_cursor":{"id":1}}`,
+			wantErr:    true,
+		},
+		{
+			name:       "header cursor",
+			cursorPath: "X-Next-Cursor",
+			opts:       []CursorOption{WithCursorHeader()},
+			url:        "http://example/items",
+			header:     http.Header{"X-Next-Cursor": []string{"abc"}},
+			body:       `[]`,
+			want:       "http://example/items?cursor=abc",
+		},
+		{
+			name:       "absent header cursor",
+			cursorPath: "X-Next-Cursor",
+			opts:       []CursorOption{WithCursorHeader()},
+			url:        "http://example/items",
+			body:       `{"X-Next-Cursor":"abc"}`,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, tcase.url, nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+
+			rsp := &http.Response{StatusCode: http.StatusOK, Header: tcase.header}
+
+			paginate := CursorPaginate(tcase.cursorPath, "cursor", tcase.opts...)
+
+			next, err := paginate(req, rsp, []byte(tcase.body))
+			if tcase.wantErr != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tcase.wantErr, err)
+			}
+
+			var got string
+			if next != nil {
+				got = next.URL.String()
+			}
+
+			if got != tcase.want {
+				t.Errorf("expected next page %q, got %q", tcase.want, got)
+			}
+
+			// The original request must not be modified.
+			if req.URL.String() != tcase.url {
+				t.Errorf("expected request URL to be %q, got %q", tcase.url, req.URL)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceCursorPagination(t *testing.T) {
+	t.Parallel()
+
+	const pageCount = 5
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var page int
+
+		if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+			if _, err := fmt.Sscanf(cursor, "page-%d", &page); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+
+				return
+			}
+		}
+
+		next := ""
+		if page < pageCount-1 {
+			next = fmt.Sprintf("page-%d", page+1)
+		}
+
+		fmt.Fprintf(w, `{"data":[{"page":%d}],"next_cursor":%q}`, page, next)
+	}))
+	defer server.Close()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	// Use more pages than requests, to ensure that the number of
+	// responses is not assumed to be the number of requests.
+	writer := &mockListWriter{}
+
+	svc.HTTP.Requests(
+		newTestServerRequest(t, server.URL+"/a", WithWriters(writer),
+			WithPagination(CursorPaginate("next_cursor", "cursor"))),
+		newTestServerRequest(t, server.URL+"/b", WithWriters(writer),
+			WithPagination(CursorPaginate("next_cursor", "cursor"))),
+	)
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	if writer.count != 2*pageCount {
+		t.Errorf("expected %d writes, got %d", 2*pageCount, writer.count)
+	}
+
+	if got := svc.HTTP.Result().Requests; got != 2*pageCount {
+		t.Errorf("expected %d requests, got %d", 2*pageCount, got)
+	}
+}
+
+func TestOffsetPaginate(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name        string
+		url         string
+		contentType string
+		body        string
+		want        string // want is the URL of the next page, if any
+		wantErr     bool
+	}{
+		{
+			name: "full first page",
+			url:  "http://example/items?limit=2",
+			body: `[{"id":1},{"id":2}]`,
+			want: "http://example/items?limit=2&offset=2",
+		},
+		{
+			name: "full page",
+			url:  "http://example/items?limit=2&offset=4",
+			body: `[{"id":5},{"id":6}]`,
+			want: "http://example/items?limit=2&offset=6",
+		},
+		{
+			name: "limit not set",
+			url:  "http://example/items",
+			body: `[{"id":1},{"id":2}]`,
+			want: "http://example/items?limit=2&offset=2",
+		},
+		{
+			name: "partial page",
+			url:  "http://example/items?limit=2&offset=4",
+			body: `[{"id":5}]`,
+		},
+		{
+			name: "empty page",
+			url:  "http://example/items?limit=2&offset=4",
+			body: `[]`,
+		},
+		{
+			name: "object is a single record",
+			url:  "http://example/items?limit=2",
+			body: `{"data":[{"id":1},{"id":2}]}`,
+		},
+		{
+			name:        "full csv page",
+			url:         "http://example/items?limit=2",
+			contentType: "text/csv",
+			body:        "id\n1\n2\n",
+			want:        "http://example/items?limit=2&offset=2",
+		},
+		{
+			name:        "partial csv page",
+			url:         "http://example/items?limit=2",
+			contentType: "text/csv",
+			body:        "id\n1\n",
+		},
+		{
+			name: "empty body",
+			url:  "http://example/items?limit=2",
+		},
+		{
+			name:    "invalid offset",
+			url:     "http://example/items?offset=abc",
+			body:    `[{"id":1},{"id":2}]`,
+			wantErr: true,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, tcase.url, nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+
+			rsp := &http.Response{StatusCode: http.StatusOK, Request: req, Header: http.Header{}}
+			if tcase.contentType != "" {
+				rsp.Header.Set("Content-Type", tcase.contentType)
+			}
+
+			next, err := OffsetPaginate("offset", "limit", 2)(req, rsp, []byte(tcase.body))
+			if tcase.wantErr != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tcase.wantErr, err)
+			}
+
+			var got string
+			if next != nil {
+				got = next.URL.String()
+			}
+
+			if got != tcase.want {
+				t.Errorf("expected next page %q, got %q", tcase.want, got)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceOffsetPagination(t *testing.T) {
+	t.Parallel()
+
+	const pageSize = 3
+
+	for _, tcase := range []struct {
+		name         string
+		csv          bool
+		recordCount  int
+		wantRequests int64
+	}{
+		{
+			name:         "exact multiple",
+			recordCount:  2 * pageSize,
+			wantRequests: 3, // the final page is empty
+		},
+		{
+			name:         "csv exact multiple",
+			csv:          true,
+			recordCount:  2 * pageSize,
+			wantRequests: 3, // the final page has only a header
+		},
+		{
+			name:         "csv partial final page",
+			csv:          true,
+			recordCount:  2*pageSize + 1,
+			wantRequests: 3,
+		},
+		{
+			name:         "partial final page",
+			recordCount:  2*pageSize + 1,
+			wantRequests: 3,
+		},
+		{
+			name:         "partial first page",
+			recordCount:  pageSize - 1,
+			wantRequests: 1,
+		},
+		{
+			name:         "no records",
+			wantRequests: 1,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var offset, limit int
+
+				fmt.Sscan(r.URL.Query().Get("offset"), &offset) //nolint:errcheck
+				fmt.Sscan(r.URL.Query().Get("limit"), &limit)   //nolint:errcheck
+
+				// The CSV is served as plain text, so that it is
+				// only decoded as CSV as the request says.
+				if tcase.csv {
+					fmt.Fprint(w, "id\n")
+
+					for id := offset; id < offset+limit && id < tcase.recordCount; id++ {
+						fmt.Fprintf(w, "%d\n", id)
+					}
+
+					return
+				}
+
+				fmt.Fprint(w, "[")
+
+				for id := offset; id < offset+limit && id < tcase.recordCount; id++ {
+					if id > offset {
+						fmt.Fprint(w, ",")
+					}
+
+					fmt.Fprintf(w, `{"id":%d}`, id)
+				}
+
+				fmt.Fprint(w, "]")
+			}))
+			defer server.Close()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			url := fmt.Sprintf("%s?limit=%d", server.URL, pageSize)
+
+			opts := []RequestOption{WithPagination(OffsetPaginate("offset", "limit", pageSize))}
+			if tcase.csv {
+				opts = append(opts, WithDecodeType(DecodeTypeCSV))
+			}
+
+			svc.HTTP.Requests(newTestServerRequest(t, url, opts...))
+
+			if err := svc.HTTP.Store(context.Background()); err != nil {
+				t.Fatalf("failed to store: %v", err)
+			}
+
+			result := svc.HTTP.Result()
+
+			if result.Requests != tcase.wantRequests {
+				t.Errorf("expected %d requests, got %d", tcase.wantRequests, result.Requests)
+			}
+
+			if result.Records != int64(tcase.recordCount) {
+				t.Errorf("expected %d records, got %d", tcase.recordCount, result.Records)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceMaxRequests(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id":1}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	// The pagination function never returns a last page.
+	endless := func(req *http.Request, _ *http.Response, _ []byte) (*http.Request, error) {
+		return req.Clone(req.Context()), nil
+	}
+
+	const maxRequests = 5
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	writer := &mockListWriter{}
+
+	svc.HTTP.
+		MaxRequests(maxRequests).
+		MaxRetries(3).
+		Requests(newTestServerRequest(t, server.URL, WithWriters(writer), WithPagination(endless)))
+
+	err = svc.HTTP.Store(context.Background())
+	if !errors.Is(err, ErrMaxRequestsExceeded) {
+		t.Fatalf("expected error %v, got %v", ErrMaxRequestsExceeded, err)
+	}
+
+	if got := svc.HTTP.Result().Requests; got != maxRequests {
+		t.Errorf("expected %d requests, got %d", maxRequests, got)
+	}
+
+	// The pages received before the limit was reached are still stored.
+	if writer.count != maxRequests {
+		t.Errorf("expected %d writes, got %d", maxRequests, writer.count)
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alpstable/gidari/third_party/accept"
+	"golang.org/x/time/rate"
+)
+
+// ErrProbe is returned when the probe request of a host cannot be created, see
+// "HTTPService.Probe".
+var ErrProbe = errors.New("failed to create probe request")
+
+// ProbeFunc returns the request that probes a host, e.g. an OPTIONS request or a
+// request to a metadata endpoint, see "HTTPService.Probe". The host is that of
+// the URLs of the requests, including the port, if any. If the returned request
+// is nil, then the host is not probed.
+type ProbeFunc func(host string) (*http.Request, error)
+
+// ProbeResult is what a host advertised in the response to its probe.
+type ProbeResult struct {
+	// Response is the response to the probe. Its body has been closed.
+	Response *http.Response
+
+	// Formats are the types that the host can respond with, in order of
+	// preference, from the "Accept" header of the response. Media types
+	// that cannot be decoded are left out.
+	Formats []DecodeType
+
+	// RateLimit is the number of requests per second that the host
+	// allows, and Burst is the number of requests it allows at once, from
+	// the "RateLimit-Policy" or "X-RateLimit-Limit" header of the
+	// response, in the form "<limit>;w=<seconds>". If neither header is
+	// set, then the rate limit is zero.
+	RateLimit rate.Limit
+	Burst     int
+}
+
+// probedHost is the result of the probe of a host, and the rate limiter of its
+// requests, if it advertised a rate limit.
+type probedHost struct {
+	result   ProbeResult
+	rlimiter *rate.Limiter
+}
+
+// Probe sets a function that returns a request to probe each host before the
+// requests of "Store" are made, for APIs that advertise their capabilities.
+// Every host is probed once per run, and what it advertises is used as the
+// defaults of its requests:
+//
+//   - A request with neither an "Accept" header nor a type set with
+//     WithDecodeType asks for the first advertised format that it can decode,
+//     as if it were set with WithAccept.
+//   - If the HTTP Service has no rate limiter, then the requests to the host
+//     are limited to the advertised rate.
+//
+// A probe that fails, or that does not respond with a 2xx status, is logged and
+// sets no defaults; it does not fail the run. By default, hosts are not probed.
+func (svc *HTTPService) Probe(fn ProbeFunc) *HTTPService {
+	svc.probe = fn
+
+	return svc
+}
+
+// ProbeResults will return the results of the probes of the last run of
+// "Store", keyed by host. A host whose probe failed has no result.
+func (svc *HTTPService) ProbeResults() map[string]ProbeResult {
+	results := make(map[string]ProbeResult, len(svc.probes))
+	for host, probed := range svc.probes {
+		results[host] = probed.result
+	}
+
+	return results
+}
+
+// probeHosts will probe every host of the requests, replacing the results of
+// the previous run.
+func (svc *HTTPService) probeHosts(ctx context.Context, reqs []*Request) error {
+	svc.probes = nil
+	if svc.probe == nil {
+		return nil
+	}
+
+	probes := make(map[string]*probedHost)
+
+	for _, req := range reqs {
+		host := req.http.URL.Host
+		if _, ok := probes[host]; ok {
+			continue
+		}
+
+		probeReq, err := svc.probe(host)
+		if err != nil {
+			return fmt.Errorf("%w: %q: %w", ErrProbe, host, err)
+		}
+
+		// Mark the host as probed, even if there is no result.
+		probes[host] = nil
+
+		if probeReq == nil {
+			continue
+		}
+
+		result, err := svc.doProbe(ctx, probeReq)
+		if err != nil {
+			if logger := svc.logger(); logger != nil {
+				logger.LogAttrs(ctx, slog.LevelWarn, "probe failed", slog.String("host", host),
+					slog.String("error", err.Error()))
+			}
+
+			continue
+		}
+
+		probed := &probedHost{result: result}
+		if result.RateLimit > 0 {
+			probed.rlimiter = rate.NewLimiter(result.RateLimit, result.Burst)
+		}
+
+		probes[host] = probed
+	}
+
+	svc.probes = make(map[string]*probedHost, len(probes))
+
+	for host, probed := range probes {
+		if probed != nil {
+			svc.probes[host] = probed
+		}
+	}
+
+	return nil
+}
+
+// doProbe will make the probe request and parse what its response advertises.
+func (svc *HTTPService) doProbe(ctx context.Context, req *http.Request) (ProbeResult, error) {
+	rsp, err := svc.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return ProbeResult{}, fmt.Errorf("failed to make probe request: %w", err)
+	}
+
+	_, _ = io.Copy(io.Discard, rsp.Body)
+	_ = rsp.Body.Close()
+
+	if rsp.StatusCode < http.StatusOK || rsp.StatusCode >= http.StatusMultipleChoices {
+		return ProbeResult{}, fmt.Errorf("%w: %d", ErrBadResponse, rsp.StatusCode)
+	}
+
+	result := ProbeResult{Response: rsp, Formats: advertisedFormats(rsp.Header)}
+	result.RateLimit, result.Burst = advertisedRateLimit(rsp.Header)
+
+	return result, nil
+}
+
+// advertisedFormats will return the types that can be decoded from the media
+// types of the "Accept" header, in order of preference.
+func advertisedFormats(header http.Header) []DecodeType {
+	var formats []DecodeType
+
+	seen := make(map[DecodeType]bool)
+
+	for _, acceptHeader := range accept.ParseAcceptHeader(header.Get("Accept")) {
+		decodeType := mediaTypeDecodeType(acceptHeader.Typ + "/" + acceptHeader.Subtype)
+		if decodeType == DecodeTypeUnknown || seen[decodeType] {
+			continue
+		}
+
+		seen[decodeType] = true
+		formats = append(formats, decodeType)
+	}
+
+	return formats
+}
+
+// advertisedRateLimit will return the rate limit and burst of the strictest
+// policy of the "RateLimit-Policy" or "X-RateLimit-Limit" header, where each
+// policy is in the form "<limit>;w=<seconds>". A policy without a window is
+// not a rate, and is ignored.
+func advertisedRateLimit(header http.Header) (rate.Limit, int) {
+	value := header.Get("RateLimit-Policy")
+	if value == "" {
+		value = header.Get("X-RateLimit-Limit")
+	}
+
+	var (
+		limit rate.Limit
+		burst int
+	)
+
+	for _, policy := range strings.Split(value, ",") {
+		params := strings.Split(policy, ";")
+
+		quota, err := strconv.Atoi(strings.TrimSpace(params[0]))
+		if err != nil || quota <= 0 {
+			continue
+		}
+
+		var window int
+
+		for _, param := range params[1:] {
+			if key, val, ok := strings.Cut(strings.TrimSpace(param), "="); ok && key == "w" {
+				window, _ = strconv.Atoi(val)
+			}
+		}
+
+		if window <= 0 {
+			continue
+		}
+
+		policyLimit := rate.Limit(float64(quota) / float64(window))
+		if limit == 0 || policyLimit < limit {
+			limit, burst = policyLimit, quota
+		}
+	}
+
+	return limit, burst
+}
+
+// decodeTypeMediaTypes are the media types used to ask for each type.
+var decodeTypeMediaTypes = map[DecodeType]string{
+	DecodeTypeJSON:     "application/json",
+	DecodeTypeCSV:      "text/csv",
+	DecodeTypeTSV:      "text/tab-separated-values",
+	DecodeTypeProtobuf: "application/x-protobuf",
+	DecodeTypeJSONP:    "application/javascript",
+}
+
+// apply will set the defaults advertised by the host of the job's request on
+// the job.
+func (probed *probedHost) apply(job *webWorkerJob) {
+	if probed == nil {
+		return
+	}
+
+	job.accept = probed.accept(job.req)
+
+	if job.rlimiter == nil {
+		job.rlimiter = probed.rlimiter
+	}
+}
+
+// rateLimit will return the rate limit advertised by the host, or zero if it
+// advertised none.
+func (probed *probedHost) rateLimit() rate.Limit {
+	if probed == nil {
+		return 0
+	}
+
+	return probed.result.RateLimit
+}
+
+// accept will return the media type of the first format advertised by the host
+// that the request can decode, or an empty string if there is none.
+func (probed *probedHost) accept(req *Request) string {
+	if req.decodeType != DecodeTypeUnknown {
+		return ""
+	}
+
+	for _, format := range probed.result.Formats {
+		if format == DecodeTypeProtobuf && req.protoMessage == nil {
+			continue
+		}
+
+		return decodeTypeMediaTypes[format]
+	}
+
+	return ""
+}
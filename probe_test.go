@@ -0,0 +1,173 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+func TestHTTPServiceProbe(t *testing.T) {
+	t.Parallel()
+
+	// The server advertises CSV, and only responds to requests that ask
+	// for it, with a "Content-Type" that does not identify the format.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Accept", "text/csv, application/json;q=0.5")
+			w.Header().Set("RateLimit-Policy", "100;w=10")
+
+			return
+		}
+
+		if r.Header.Get("Accept") != "text/csv" {
+			w.WriteHeader(http.StatusNotAcceptable)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "id,name\n1,a\n2,b\n")
+	}))
+	t.Cleanup(server.Close)
+
+	probe := func(host string) (*http.Request, error) {
+		return http.NewRequestWithContext(context.Background(), http.MethodOptions, "http://"+host, nil)
+	}
+
+	t.Run("advertised format", func(t *testing.T) {
+		t.Parallel()
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		writer := &mockListWriter{}
+
+		svc.HTTP.Probe(probe).Requests(
+			newTestServerRequest(t, server.URL, WithWriters(writer)),
+			newTestServerRequest(t, server.URL+"/other", WithWriters(writer)))
+
+		if err := svc.HTTP.Store(context.Background()); err != nil {
+			t.Fatalf("failed to store: %v", err)
+		}
+
+		if got := svc.HTTP.Result().Records; got != 4 {
+			t.Errorf("expected 4 records, got %d", got)
+		}
+
+		results := svc.HTTP.ProbeResults()
+
+		result, ok := results[server.Listener.Addr().String()]
+		if !ok || len(results) != 1 {
+			t.Fatalf("expected one probe result for the host, got %v", results)
+		}
+
+		if want := []DecodeType{DecodeTypeCSV, DecodeTypeJSON}; fmt.Sprint(result.Formats) != fmt.Sprint(want) {
+			t.Errorf("expected formats %v, got %v", want, result.Formats)
+		}
+
+		if result.RateLimit != 10 || result.Burst != 100 {
+			t.Errorf("expected a rate limit of 10 with a burst of 100, got %v and %d",
+				result.RateLimit, result.Burst)
+		}
+	})
+
+	t.Run("no probe", func(t *testing.T) {
+		t.Parallel()
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		svc.HTTP.Requests(newTestServerRequest(t, server.URL+"/unprobed"))
+
+		if err := svc.HTTP.Store(context.Background()); !errors.Is(err, ErrBadResponse) {
+			t.Errorf("expected %v, got %v", ErrBadResponse, err)
+		}
+
+		if len(svc.HTTP.ProbeResults()) != 0 {
+			t.Errorf("expected no probe results, got %v", svc.HTTP.ProbeResults())
+		}
+	})
+
+	t.Run("probe error", func(t *testing.T) {
+		t.Parallel()
+
+		errProbe := errors.New("no probe")
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		svc.HTTP.Probe(func(string) (*http.Request, error) { return nil, errProbe }).
+			Requests(newTestServerRequest(t, server.URL))
+
+		if err := svc.HTTP.Store(context.Background()); !errors.Is(err, ErrProbe) || !errors.Is(err, errProbe) {
+			t.Errorf("expected %v, got %v", errProbe, err)
+		}
+	})
+}
+
+func TestAdvertisedRateLimit(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name      string
+		header    http.Header
+		wantLimit rate.Limit
+		wantBurst int
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:      "policy",
+			header:    http.Header{"Ratelimit-Policy": {"60;w=60"}},
+			wantLimit: 1,
+			wantBurst: 60,
+		},
+		{
+			name:      "strictest policy",
+			header:    http.Header{"Ratelimit-Policy": {"10;w=1, 100;w=60"}},
+			wantLimit: rate.Limit(100.0 / 60),
+			wantBurst: 100,
+		},
+		{
+			name:      "x-ratelimit-limit",
+			header:    http.Header{"X-Ratelimit-Limit": {"20;w=2"}},
+			wantLimit: 10,
+			wantBurst: 20,
+		},
+		{
+			name:   "no window",
+			header: http.Header{"X-Ratelimit-Limit": {"5000"}},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			limit, burst := advertisedRateLimit(tcase.header)
+			if limit != tcase.wantLimit || burst != tcase.wantBurst {
+				t.Errorf("expected %v and %d, got %v and %d", tcase.wantLimit, tcase.wantBurst, limit, burst)
+			}
+		})
+	}
+}
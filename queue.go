@@ -0,0 +1,175 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// PersistQueue sets a file that the progress of every request of "Store" is
+// persisted to, so that a run that crashes part way through, even in the middle
+// of paginating a request, can be resumed by running the same requests again.
+// For each request, the file records the page that is to be stored next, which
+// moves on once the data of a page has been written to every list writer. A
+// request that was done when the run stopped is skipped, and a request that
+// was part way through its pages starts from the first page that was not
+// stored, rather than from its first page.
+//
+// A request is identified by its method and URL, in the same way as by
+// "Checkpoint", and a page is resumed from a clone of the request with the
+// method and URL of the page, so the file does not hold any headers or bodies.
+// Once every request has completed, the file is removed. Requests received from
+// "RequestsChan" are not persisted, and in a dry run the file is neither read
+// nor written.
+func (svc *HTTPService) PersistQueue(path string) *HTTPService {
+	svc.queuePath = path
+
+	return svc
+}
+
+// queueEntry is the progress of a request in a persisted queue. If the request
+// is not done, then the method and URL are those of its next page.
+type queueEntry struct {
+	Done   bool   `json:"done,omitempty"`
+	Method string `json:"method,omitempty"`
+	URL    string `json:"url,omitempty"`
+}
+
+// persistedQueue is the progress of the requests of a run, keyed by the
+// checkpoint key of each request, persisted to a JSON file.
+type persistedQueue struct {
+	path string
+
+	mtx     sync.Mutex
+	entries map[string]queueEntry
+
+	// failed are the keys of the requests with a page that could not be
+	// stored, whose progress must not move past that page.
+	failed map[string]bool
+}
+
+// loadQueue will load the queue persisted to the file at the path, if it
+// exists.
+func loadQueue(path string) (*persistedQueue, error) {
+	queue := &persistedQueue{
+		path:    path,
+		entries: make(map[string]queueEntry),
+		failed:  make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return queue, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &queue.entries); err != nil {
+		return nil, fmt.Errorf("failed to decode queue file: %w", err)
+	}
+
+	return queue, nil
+}
+
+// resume will return the requests to make to resume the queue: a request that
+// is done is left out, and a request that is part way through its pages is
+// replaced by its next page. Each request is tagged with its key, so that its
+// pages can be recorded as they are stored.
+func (queue *persistedQueue) resume(reqs []*Request) ([]*Request, error) {
+	queue.mtx.Lock()
+	defer queue.mtx.Unlock()
+
+	pending := make([]*Request, 0, len(reqs))
+
+	for _, req := range reqs {
+		key := checkpointKey(req.http)
+
+		entry, ok := queue.entries[key]
+		if ok && entry.Done {
+			continue
+		}
+
+		tagged := *req
+		tagged.queueKey = key
+
+		if ok && entry.URL != "" {
+			pageURL, err := url.Parse(entry.URL)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode queue file: %w", err)
+			}
+
+			tagged.http = req.http.Clone(req.http.Context())
+			tagged.http.Method = entry.Method
+			tagged.http.URL = pageURL
+			tagged.http.Host = ""
+		}
+
+		pending = append(pending, &tagged)
+	}
+
+	return pending, nil
+}
+
+// advance will record that a page of the request identified by the key has
+// been stored, and that the next page, if any, is to be stored next. Once a page
+// of the request has failed, its progress is not recorded.
+func (queue *persistedQueue) advance(key string, next *http.Request) error {
+	queue.mtx.Lock()
+	defer queue.mtx.Unlock()
+
+	if queue.failed[key] {
+		return nil
+	}
+
+	entry := queueEntry{Done: true}
+	if next != nil {
+		entry = queueEntry{Method: next.Method, URL: next.URL.String()}
+	}
+
+	queue.entries[key] = entry
+
+	data, err := json.Marshal(queue.entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode queue: %w", err)
+	}
+
+	return writeFileAtomic(queue.path, data, "queue")
+}
+
+// fail will record that a page of the request identified by the key could not
+// be stored, so that a resumed run starts from that page.
+func (queue *persistedQueue) fail(key string) {
+	queue.mtx.Lock()
+	defer queue.mtx.Unlock()
+
+	queue.failed[key] = true
+}
+
+// done will remove the file, once every request of the queue has completed.
+func (queue *persistedQueue) done() error {
+	queue.mtx.Lock()
+	defer queue.mtx.Unlock()
+
+	queue.entries = make(map[string]queueEntry)
+
+	if err := os.Remove(queue.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove queue file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// crashWriter is a ListWriter that fails to write the list with the record
+// that it crashes on, and every list after it, as if the process stopped
+// before the list was stored.
+type crashWriter struct {
+	mockListWriter
+
+	crashOn string
+	crashed bool
+}
+
+func (c *crashWriter) Write(ctx context.Context, list *structpb.ListValue) error {
+	data, err := list.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal list: %w", err)
+	}
+
+	if strings.Contains(strings.ReplaceAll(string(data), " ", ""), c.crashOn) {
+		c.crashed = true
+	}
+
+	if c.crashed {
+		return errors.New("crashed")
+	}
+
+	return c.mockListWriter.Write(ctx, list)
+}
+
+func TestHTTPServicePersistQueue(t *testing.T) {
+	t.Parallel()
+
+	const pages = 5
+
+	var (
+		mtx       sync.Mutex
+		requested []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var page int
+
+		fmt.Sscan(r.URL.Query().Get("cursor"), &page) //nolint:errcheck
+
+		mtx.Lock()
+		requested = append(requested, fmt.Sprintf("%s#%d", r.URL.Path, page))
+		mtx.Unlock()
+
+		if r.URL.Path == "/pages" && page < pages-1 {
+			w.Header().Set("X-Next-Cursor", fmt.Sprint(page+1))
+		}
+
+		fmt.Fprintf(w, `[{"page":%d}]`, page)
+	}))
+	t.Cleanup(server.Close)
+
+	path := filepath.Join(t.TempDir(), "queue.json")
+
+	run := func(writer ListWriter) error {
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		svc.HTTP.PersistQueue(path).Requests(
+			newTestServerRequest(t, server.URL+"/pages", WithWriters(writer),
+				WithPagination(CursorPaginate("X-Next-Cursor", "cursor", WithCursorHeader()))),
+			newTestServerRequest(t, server.URL+"/single", WithWriters(writer), WithPriority(-1)))
+
+		return svc.HTTP.Store(context.Background())
+	}
+
+	// The first run crashes while storing the third page. The single
+	// request is made first, so it and the first two pages have been
+	// stored.
+	crashed := &crashWriter{crashOn: `"page":2`}
+
+	if err := run(crashed); err == nil {
+		t.Fatalf("expected the first run to fail")
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected the queue to be persisted: %v", err)
+	}
+
+	mtx.Lock()
+	requested = nil
+	mtx.Unlock()
+
+	// The second run resumes from the third page.
+	resumed := &mockListWriter{}
+
+	if err := run(resumed); err != nil {
+		t.Fatalf("failed to resume: %v", err)
+	}
+
+	if want := []string{"/pages#2", "/pages#3", "/pages#4"}; fmt.Sprint(requested) != fmt.Sprint(want) {
+		t.Errorf("expected the resumed run to request %v, got %v", want, requested)
+	}
+
+	if crashed.count != 3 || resumed.count != 3 {
+		t.Errorf("expected 3 lists stored by each run, got %d and %d", crashed.count, resumed.count)
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the queue to be removed once the run completed, got %v", err)
+	}
+}
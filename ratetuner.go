@@ -0,0 +1,210 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// AIMD configures the rate limit of each host to be tuned with an additive
+// increase, multiplicative decrease algorithm, see
+// "HTTPService.AutoTuneRateLimit".
+type AIMD struct {
+	// Initial is the rate of a host before it is tuned, in requests per
+	// second. If the host advertised a rate limit to its probe, see
+	// "HTTPService.Probe", then that rate is used instead. The default is
+	// one request per second.
+	Initial rate.Limit
+
+	// Min and Max bound the tuned rate. The default minimum is one request
+	// per minute, and there is no maximum by default.
+	Min rate.Limit
+	Max rate.Limit
+
+	// Increase is added to the rate after each window in which the host
+	// did not respond with a 429 (Too Many Requests). The default is one
+	// request per second.
+	Increase rate.Limit
+
+	// Decrease is the factor that the rate is multiplied by when the host
+	// responds with a 429, at most once per window. The default is 0.5.
+	Decrease float64
+
+	// Window is the least time between changes to the rate, so that the
+	// effect of a change is seen before the next. The default is one
+	// second.
+	Window time.Duration
+}
+
+// AutoTuneRateLimit sets the rate limit of each host to be tuned from its 429
+// (Too Many Requests) responses, for APIs whose limit is not documented. Each
+// host starts at the initial rate, which is raised by the increase for each
+// window without a 429, and cut by the decrease factor on a 429, so that the
+// rate converges just below the limit of the host. Every change is logged at
+// the debug level, and the tuned rates are returned by "TunedRateLimits".
+//
+// The tuned limiter of a host allows one request at a time, and replaces the
+// rate limiter set with "RateLimiter" for the requests to that host. The tuned
+// rates are kept across runs. A nil configuration (the default) means the rate
+// limit is not tuned.
+func (svc *HTTPService) AutoTuneRateLimit(cfg *AIMD) *HTTPService {
+	svc.tuner = nil
+	if cfg != nil {
+		svc.tuner = newRateTuner(*cfg)
+	}
+
+	return svc
+}
+
+// TunedRateLimits will return the tuned rate of each host that a request has
+// been made to, see "AutoTuneRateLimit".
+func (svc *HTTPService) TunedRateLimits() map[string]rate.Limit {
+	if svc.tuner == nil {
+		return nil
+	}
+
+	return svc.tuner.limits()
+}
+
+// tunedHost is the tuned rate limiter of a single host.
+type tunedHost struct {
+	rlimiter     *rate.Limiter
+	lastChange   time.Time
+	lastDecrease time.Time
+}
+
+// rateTuner is a set of tuned rate limiters, keyed by host.
+type rateTuner struct {
+	cfg AIMD
+
+	mtx   sync.Mutex
+	hosts map[string]*tunedHost
+}
+
+func newRateTuner(cfg AIMD) *rateTuner {
+	if cfg.Initial <= 0 {
+		cfg.Initial = 1
+	}
+
+	if cfg.Min <= 0 {
+		cfg.Min = rate.Every(time.Minute)
+	}
+
+	if cfg.Max <= 0 {
+		cfg.Max = rate.Inf
+	}
+
+	if cfg.Increase <= 0 {
+		cfg.Increase = 1
+	}
+
+	if cfg.Decrease <= 0 || cfg.Decrease >= 1 {
+		cfg.Decrease = 0.5
+	}
+
+	if cfg.Window <= 0 {
+		cfg.Window = time.Second
+	}
+
+	return &rateTuner{cfg: cfg, hosts: make(map[string]*tunedHost)}
+}
+
+// limiter will return the rate limiter of the host, creating one at the
+// initial rate if there is none.
+func (rt *rateTuner) limiter(host string, initial rate.Limit) *rate.Limiter {
+	rt.mtx.Lock()
+	defer rt.mtx.Unlock()
+
+	tuned, ok := rt.hosts[host]
+	if !ok {
+		if initial <= 0 {
+			initial = rt.cfg.Initial
+		}
+
+		tuned = &tunedHost{rlimiter: rate.NewLimiter(rt.bound(initial), 1)}
+		rt.hosts[host] = tuned
+	}
+
+	return tuned.rlimiter
+}
+
+// bound will return the limit within the minimum and maximum of the tuner.
+func (rt *rateTuner) bound(limit rate.Limit) rate.Limit {
+	return min(max(limit, rt.cfg.Min), rt.cfg.Max)
+}
+
+// record will tune the rate of the host from the status of a response,
+// returning the rates before and after.
+func (rt *rateTuner) record(host string, now time.Time, rsp *http.Response) (rate.Limit, rate.Limit) {
+	rt.mtx.Lock()
+	defer rt.mtx.Unlock()
+
+	tuned, ok := rt.hosts[host]
+	if !ok || rsp == nil {
+		return 0, 0
+	}
+
+	from := tuned.rlimiter.Limit()
+	limit := from
+
+	switch {
+	case rsp.StatusCode == http.StatusTooManyRequests:
+		// The 429s of the requests made at the old rate are the same
+		// signal, so the rate is only cut once per window.
+		if tuned.lastDecrease.IsZero() || now.Sub(tuned.lastDecrease) >= rt.cfg.Window {
+			limit = rt.bound(limit * rate.Limit(rt.cfg.Decrease))
+			tuned.lastDecrease = now
+			tuned.lastChange = now
+		}
+	case rsp.StatusCode < http.StatusBadRequest:
+		if tuned.lastChange.IsZero() {
+			tuned.lastChange = now
+		} else if now.Sub(tuned.lastChange) >= rt.cfg.Window {
+			limit = rt.bound(limit + rt.cfg.Increase)
+			tuned.lastChange = now
+		}
+	}
+
+	if limit != from {
+		tuned.rlimiter.SetLimitAt(now, limit)
+	}
+
+	return from, limit
+}
+
+// limits will return the tuned rate of each host.
+func (rt *rateTuner) limits() map[string]rate.Limit {
+	rt.mtx.Lock()
+	defer rt.mtx.Unlock()
+
+	limits := make(map[string]rate.Limit, len(rt.hosts))
+	for host, tuned := range rt.hosts {
+		limits[host] = tuned.rlimiter.Limit()
+	}
+
+	return limits
+}
+
+// logTunedRate will log a change in the tuned rate of the host.
+func logTunedRate(ctx context.Context, logger *slog.Logger, host string, from, to rate.Limit) {
+	if logger == nil || from == to {
+		return
+	}
+
+	logger.LogAttrs(ctx, slog.LevelDebug, "rate limit tuned",
+		slog.String("host", host),
+		slog.Float64("from", float64(from)),
+		slog.Float64("to", float64(to)))
+}
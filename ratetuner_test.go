@@ -0,0 +1,151 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestHTTPServiceAutoTuneRateLimit(t *testing.T) {
+	t.Parallel()
+
+	const (
+		pages = 200
+
+		// threshold is the hidden limit of the server, in requests
+		// per second.
+		threshold = 10
+	)
+
+	clk := newFakeClock()
+
+	var (
+		mtx        sync.Mutex
+		last       time.Time
+		throttled  int
+		throttleAt []int
+	)
+
+	// The server responds with a 429 to any request made less than
+	// 1/threshold seconds after the last request it served, as measured
+	// by the fake clock.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		var page int
+
+		fmt.Sscan(r.URL.Query().Get("cursor"), &page) //nolint:errcheck
+
+		now := clk.Now()
+		if !last.IsZero() && now.Sub(last) < time.Second/threshold {
+			throttled++
+			throttleAt = append(throttleAt, page)
+
+			w.WriteHeader(http.StatusTooManyRequests)
+
+			return
+		}
+
+		last = now
+
+		if page < pages-1 {
+			w.Header().Set("X-Next-Cursor", fmt.Sprint(page+1))
+		}
+
+		fmt.Fprintf(w, `[{"id":%d}]`, page)
+	}))
+	t.Cleanup(server.Close)
+
+	svc, err := NewService(context.Background(), withClock(clk))
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	// The backoff is zero, so that a retry only waits for the tuned rate
+	// limiter.
+	svc.HTTP.
+		AutoTuneRateLimit(&AIMD{Initial: 2}).
+		MaxRetries(3).
+		Backoff(ConstantBackoff{}).
+		Requests(newTestServerRequest(t, server.URL,
+			WithPagination(CursorPaginate("X-Next-Cursor", "cursor", WithCursorHeader()))))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	limits := svc.HTTP.TunedRateLimits()
+
+	got, ok := limits[server.Listener.Addr().String()]
+	if !ok {
+		t.Fatalf("expected a tuned rate for the host, got %v", limits)
+	}
+
+	// The rate is raised until it passes the threshold, at which point
+	// the next request is throttled and the rate is cut, so it stays
+	// within one increase of the threshold.
+	if got <= 0 || got > threshold+1 {
+		t.Errorf("expected the tuned rate to converge below %d, got %v", threshold, got)
+	}
+
+	if throttled == 0 {
+		t.Fatalf("expected the rate to be raised until it was throttled")
+	}
+
+	// Once the rate has converged, it is only throttled on its way back
+	// up to the threshold, i.e. once every few seconds.
+	if throttled > pages/10 {
+		t.Errorf("expected few throttled requests, got %d at pages %v", throttled, throttleAt)
+	}
+}
+
+func TestRateTuner(t *testing.T) {
+	t.Parallel()
+
+	const host = "example.com"
+
+	tuner := newRateTuner(AIMD{Initial: 4, Max: 5, Window: time.Second})
+
+	rsp := func(status int) *http.Response { return &http.Response{StatusCode: status} }
+
+	start := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tuner.limiter(host, 0)
+
+	for _, step := range []struct {
+		after  time.Duration
+		status int
+		want   rate.Limit
+	}{
+		{after: 0, status: http.StatusOK, want: 4},
+		{after: time.Second, status: http.StatusOK, want: 5},
+		{after: 2 * time.Second, status: http.StatusOK, want: 5},
+		{after: 2 * time.Second, status: http.StatusTooManyRequests, want: 2.5},
+		{after: 2500 * time.Millisecond, status: http.StatusTooManyRequests, want: 2.5},
+		{after: 2500 * time.Millisecond, status: http.StatusOK, want: 2.5},
+		{after: 3 * time.Second, status: http.StatusOK, want: 3.5},
+		{after: 3 * time.Second, status: http.StatusServiceUnavailable, want: 3.5},
+	} {
+		if _, got := tuner.record(host, start.Add(step.after), rsp(step.status)); got != step.want {
+			t.Fatalf("expected a rate of %v after %d at %v, got %v", step.want, step.status, step.after, got)
+		}
+	}
+
+	if got := tuner.limits()[host]; got != 3.5 {
+		t.Errorf("expected a tuned rate of 3.5, got %v", got)
+	}
+}
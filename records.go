@@ -0,0 +1,131 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// RecordFunc is called by "ForEachRecord" with each record decoded from a
+// response, along with the request that produced the response. An error stops
+// the iteration.
+type RecordFunc func(record map[string]interface{}, req *http.Request) error
+
+// ForEachRecord will make the requests and call fn with each record decoded
+// from the responses, without any storage. The records are decoded, flattened,
+// and labeled as they would be for the list writers of the requests, and
+// values that are not records, e.g. the numbers of a JSON array, are skipped.
+// Records are passed to fn one response at a time, as they are returned by
+// the iterator, so fn is never called concurrently and the whole stream is
+// never buffered: while fn is running, the web workers can only get as far
+// ahead as the iterator allows.
+//
+// Iteration stops at the first error returned by fn, and that error is
+// returned as-is. Once iteration stops, for any reason, the context of the run
+// is canceled and the remaining responses are discarded. The result of the run
+// is available from the "Result" method.
+func (svc *HTTPService) ForEachRecord(ctx context.Context, fn RecordFunc) error {
+	// If there are no requests, do nothing.
+	if len(svc.requests) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if svc.svc != nil {
+		ctx = contextWithRunID(ctx, svc.svc.runID)
+	}
+
+	// Reset the iterator and the counters for the run.
+	svc.Iterator = NewHTTPIteratorService(svc)
+	clk := svc.clock()
+	start := clk.Now()
+
+	svc.stats.Store(newStoreStats(start, len(svc.requests)))
+
+	defer func() {
+		end := clk.Now()
+
+		stats := svc.stats.Load()
+		stats.finish(end)
+
+		svc.result = stats.result(end.Sub(start))
+	}()
+
+	// Close the iterator once iteration stops, so that the remaining
+	// responses are discarded.
+	defer svc.Iterator.Close() //nolint:errcheck
+
+	for svc.Iterator.Next(ctx) {
+		if err := svc.forEachRecord(svc.Iterator.Current, fn); err != nil {
+			return err
+		}
+	}
+
+	if err := svc.Iterator.Err(); err != nil {
+		return fmt.Errorf("error iterating over requests: %w", err)
+	}
+
+	return nil
+}
+
+// forEachRecord will call fn with each record decoded from the response.
+func (svc *HTTPService) forEachRecord(current *Current, fn RecordFunc) error {
+	rsp := current.Response
+
+	// If there is no response, then do nothing.
+	if rsp == nil {
+		return nil
+	}
+
+	// If the status code is not expected, then return with an error. An
+	// expected status may have no data to store.
+	hasData, err := current.req.checkStatus(rsp)
+	if err != nil || !hasData {
+		return err
+	}
+
+	decFunc, err := svc.decodeFunc(current)
+	if err != nil {
+		return err
+	}
+
+	list := &structpb.ListValue{}
+	if err := decFunc(list); err != nil {
+		return fmt.Errorf("failed to decode %q: %w", rsp.Request.URL.Redacted(), err)
+	}
+
+	if current.req.flatten {
+		flattenList(list, current.req.flattenSep)
+	}
+
+	if err := labelList(list, current.req.labels, current.req.labelConflict); err != nil {
+		return err
+	}
+
+	for _, val := range list.GetValues() {
+		record := val.GetStructValue()
+		if record == nil {
+			continue
+		}
+
+		if err := fn(record.AsMap(), current.req.http); err != nil {
+			return err
+		}
+
+		svc.stats.Load().records.Add(1)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestHTTPServiceForEachRecord(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `[{"path":%q,"n":1},{"path":%q,"n":2},3]`, r.URL.Path, r.URL.Path)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Run("every record", func(t *testing.T) {
+		t.Parallel()
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		svc.HTTP.Requests(
+			newTestServerRequest(t, server.URL+"/a", WithLabels(map[string]string{"source": "a"})),
+			newTestServerRequest(t, server.URL+"/b"),
+		)
+
+		var got []string
+
+		err = svc.HTTP.ForEachRecord(context.Background(), func(record map[string]interface{},
+			req *http.Request,
+		) error {
+			if record["path"] != req.URL.Path {
+				t.Errorf("expected record from %q, got %v", req.URL.Path, record)
+			}
+
+			got = append(got, fmt.Sprintf("%s %v %v", record["path"], record["n"], record["source"]))
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to iterate over records: %v", err)
+		}
+
+		sort.Strings(got)
+
+		want := []string{"/a 1 a", "/a 2 a", "/b 1 <nil>", "/b 2 <nil>"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected records %v, got %v", want, got)
+		}
+
+		if records := svc.HTTP.Result().Records; records != int64(len(want)) {
+			t.Errorf("expected %d records in the result, got %d", len(want), records)
+		}
+	})
+
+	t.Run("stops on the first error", func(t *testing.T) {
+		t.Parallel()
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		svc.HTTP.Requests(newTestServerRequest(t, server.URL+"/a"), newTestServerRequest(t, server.URL+"/b"))
+
+		errStop := errors.New("stop")
+		calls := 0
+
+		err = svc.HTTP.ForEachRecord(context.Background(), func(map[string]interface{}, *http.Request) error {
+			calls++
+
+			return errStop
+		})
+		if !errors.Is(err, errStop) {
+			t.Fatalf("expected error %v, got %v", errStop, err)
+		}
+
+		if calls != 1 {
+			t.Errorf("expected the callback to be called once, got %d", calls)
+		}
+
+		if !svc.HTTP.Iterator.closed {
+			t.Errorf("expected the iterator to be closed")
+		}
+	})
+
+	t.Run("bad response", func(t *testing.T) {
+		t.Parallel()
+
+		notFound := httptest.NewServer(http.NotFoundHandler())
+		t.Cleanup(notFound.Close)
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		svc.HTTP.Requests(newTestServerRequest(t, notFound.URL))
+
+		err = svc.HTTP.ForEachRecord(context.Background(), func(map[string]interface{}, *http.Request) error {
+			t.Errorf("unexpected record")
+
+			return nil
+		})
+		if !errors.Is(err, ErrBadResponse) {
+			t.Fatalf("expected error %v, got %v", ErrBadResponse, err)
+		}
+	})
+}
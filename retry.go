@@ -0,0 +1,360 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// defaultRetryBackoff is the delay before the first retry of a request, if the
+// HTTP Service does not set one.
+const defaultRetryBackoff = 100 * time.Millisecond
+
+// maxRetryBackoff is the upper bound of the delay between retries.
+const maxRetryBackoff = 30 * time.Second
+
+// MaxRetries sets the number of times a request will be retried after a
+// transport error or a 429 (Too Many Requests) or 5xx response. A value of zero
+// (the default) means requests are not retried. A request with a body is only
+// retried if the body can be read again, i.e. if "GetBody" is set.
+//
+// Every attempt, including a retry, takes a token from the rate limiter, so a
+// retry counts against the limit like any other request. The delay before a
+// retry is the larger of the backoff and the rate limiter's delay, not their
+// sum: a retry is made once the backoff has elapsed and a token is available.
+func (svc *HTTPService) MaxRetries(n int) *HTTPService {
+	svc.maxRetries = n
+
+	return svc
+}
+
+// RetryBackoff sets the delay before the first retry of a request. The delay
+// doubles with each subsequent retry, up to 30 seconds. The default is 100
+// milliseconds. It is shorthand for an ExponentialBackoff strategy with the
+// given base, and is ignored if a strategy is set with "Backoff".
+func (svc *HTTPService) RetryBackoff(backoff time.Duration) *HTTPService {
+	svc.retryBackoff = backoff
+
+	return svc
+}
+
+// Backoff sets the strategy that decides the delay before each retry of a
+// request, in place of the exponential backoff set by "RetryBackoff". To honor
+// the "Retry-After" header of a response, wrap the strategy with RetryAfter.
+func (svc *HTTPService) Backoff(strategy BackoffStrategy) *HTTPService {
+	svc.backoff = strategy
+
+	return svc
+}
+
+// backoffStrategy will return the strategy used to delay the retries of the
+// HTTP Service's requests.
+func (svc *HTTPService) backoffStrategy() BackoffStrategy {
+	if svc.backoff != nil {
+		return svc.backoff
+	}
+
+	return ExponentialBackoff{Base: svc.retryBackoff}
+}
+
+// BackoffStrategy decides how long to wait before retrying a request. The
+// attempt is the number of the retry, where the first retry is attempt 1, and
+// the response is that of the previous attempt, or nil if it failed with a
+// transport error. The body of the response has already been closed. A
+// strategy is shared by every request of the HTTP Service, so it must be safe
+// for concurrent use.
+type BackoffStrategy interface {
+	NextDelay(attempt int, rsp *http.Response) time.Duration
+}
+
+// ConstantBackoff is a BackoffStrategy that waits the same delay before every
+// retry.
+type ConstantBackoff struct {
+	Delay time.Duration
+}
+
+// NextDelay will return the constant delay.
+func (b ConstantBackoff) NextDelay(int, *http.Response) time.Duration {
+	return b.Delay
+}
+
+// ExponentialBackoff is a BackoffStrategy whose delay starts at the base and
+// doubles with each retry, up to the maximum. A base of zero is 100
+// milliseconds, and a maximum of zero is 30 seconds.
+type ExponentialBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// NextDelay will return the base delay doubled for each retry after the first.
+func (b ExponentialBackoff) NextDelay(attempt int, _ *http.Response) time.Duration {
+	ceiling := b.Max
+	if ceiling <= 0 {
+		ceiling = maxRetryBackoff
+	}
+
+	return exponentialDelay(b.Base, ceiling, attempt)
+}
+
+// DecorrelatedJitter is a BackoffStrategy whose delay is random, so that the
+// retries of many requests that failed together are spread out rather than
+// made in lockstep. The delay of each retry is drawn from between the base and
+// three times the largest delay of the previous retry, up to the maximum. A
+// base of zero is 100 milliseconds, and a maximum of zero is 30 seconds.
+type DecorrelatedJitter struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// NextDelay will return a random delay within the range of the retry.
+func (b DecorrelatedJitter) NextDelay(attempt int, _ *http.Response) time.Duration {
+	if attempt <= 0 {
+		return 0
+	}
+
+	base, ceiling := b.Base, b.Max
+	if base <= 0 {
+		base = defaultRetryBackoff
+	}
+
+	if ceiling <= 0 {
+		ceiling = maxRetryBackoff
+	}
+
+	if base >= ceiling {
+		return ceiling
+	}
+
+	// The strategy is shared by every request, so the previous delay of a
+	// request is not known: the upper bound is that of the previous retry,
+	// which grows by a factor of three with each retry.
+	upper := base
+	for i := 1; i < attempt && upper < ceiling; i++ {
+		upper *= 3
+	}
+
+	if upper > ceiling {
+		upper = ceiling
+	}
+
+	if upper == base {
+		return base
+	}
+
+	return base + time.Duration(rand.Int63n(int64(upper-base)+1)) //nolint:gosec
+}
+
+// RetryAfter will return a BackoffStrategy that waits for the delay in the
+// "Retry-After" header of the response, as either a number of seconds or an
+// HTTP date, in preference to the delay of the fallback strategy. The fallback
+// is used if the response has no such header, or if it cannot be parsed. Used
+// by an HTTP Service, an HTTP date is measured from the time of the service's
+// clock.
+func RetryAfter(fallback BackoffStrategy) BackoffStrategy {
+	return &retryAfterBackoff{fallback: fallback}
+}
+
+// clockedBackoff is a BackoffStrategy whose delay depends on the current time,
+// which an HTTP Service takes from its clock, see nextDelay.
+type clockedBackoff interface {
+	nextDelayAt(attempt int, rsp *http.Response, now time.Time) time.Duration
+}
+
+// nextDelay will return the delay of the strategy before the retry, measuring
+// it from now if the delay depends on the current time.
+func nextDelay(strategy BackoffStrategy, attempt int, rsp *http.Response, now time.Time) time.Duration {
+	if clocked, ok := strategy.(clockedBackoff); ok {
+		return clocked.nextDelayAt(attempt, rsp, now)
+	}
+
+	return strategy.NextDelay(attempt, rsp)
+}
+
+// retryAfterBackoff is the strategy returned by RetryAfter.
+type retryAfterBackoff struct {
+	fallback BackoffStrategy
+}
+
+// NextDelay will return the delay of the "Retry-After" header, or the delay of
+// the fallback strategy.
+func (b *retryAfterBackoff) NextDelay(attempt int, rsp *http.Response) time.Duration {
+	return b.nextDelayAt(attempt, rsp, time.Now())
+}
+
+// nextDelayAt will return the delay of the "Retry-After" header as of now, or
+// the delay of the fallback strategy.
+func (b *retryAfterBackoff) nextDelayAt(attempt int, rsp *http.Response, now time.Time) time.Duration {
+	if delay, ok := retryAfterDelay(rsp, now); ok {
+		return delay
+	}
+
+	if b.fallback == nil {
+		return 0
+	}
+
+	return nextDelay(b.fallback, attempt, rsp, now)
+}
+
+// retryAfterDelay will return the delay of the "Retry-After" header of the
+// response, returning false if there is none.
+func retryAfterDelay(rsp *http.Response, now time.Time) (time.Duration, bool) {
+	if rsp == nil {
+		return 0, false
+	}
+
+	value := strings.TrimSpace(rsp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	if delay := date.Sub(now); delay > 0 {
+		return delay, true
+	}
+
+	return 0, true
+}
+
+// exponentialDelay will return the base delay doubled for each retry after the
+// first, up to the ceiling.
+func exponentialDelay(base, ceiling time.Duration, attempt int) time.Duration {
+	if attempt <= 0 {
+		return 0
+	}
+
+	if base <= 0 {
+		base = defaultRetryBackoff
+	}
+
+	delay := base
+	for i := 1; i < attempt && delay < ceiling; i++ {
+		delay *= 2
+	}
+
+	if delay > ceiling {
+		delay = ceiling
+	}
+
+	return delay
+}
+
+// isRetryable will return true if the outcome of a request can be retried.
+func isRetryable(rsp *http.Response, err error) bool {
+	// A failed interceptor or body function aborts the request, rather
+	// than retrying it.
+	if errors.Is(err, ErrRequestInterceptor) || errors.Is(err, ErrBodyFunc) {
+		return false
+	}
+
+	// A request to a host whose circuit is open fails fast, rather than
+	// using up the retries of the request, and a request over the limit of
+	// the run cannot be retried.
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrMaxRequestsExceeded) {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	if rsp == nil {
+		return false
+	}
+
+	return rsp.StatusCode == http.StatusTooManyRequests || rsp.StatusCode >= http.StatusInternalServerError
+}
+
+// rewindBody will reset the body of the request so that it can be sent again,
+// returning false if the body cannot be read again.
+func rewindBody(req *http.Request) (bool, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return true, nil
+	}
+
+	if req.GetBody == nil {
+		return false, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return false, fmt.Errorf("failed to rewind request body: %w", err)
+	}
+
+	req.Body = body
+
+	return true, nil
+}
+
+// waitTurn will block until the backoff has elapsed and the rate limiter, if
+// any, allows a request that takes the given number of tokens. The two delays
+// overlap, so the wait is the larger of the two. The returned duration is the
+// part of the wait caused by the rate limiter, beyond the backoff.
+func waitTurn(ctx context.Context, clk clock, rlimiter *rate.Limiter, tokens int,
+	backoff time.Duration,
+) (time.Duration, error) {
+	var (
+		rsv     *rate.Reservation
+		limited time.Duration
+	)
+
+	if rlimiter != nil {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		now := clk.Now()
+
+		rsv = rlimiter.ReserveN(now, tokens)
+		if !rsv.OK() {
+			return 0, fmt.Errorf("rate limiter burst of %d does not allow a request of %d tokens",
+				rlimiter.Burst(), tokens)
+		}
+
+		if delay := rsv.DelayFrom(now); delay > backoff {
+			limited = delay - max(backoff, 0)
+			backoff = delay
+		}
+	}
+
+	if backoff <= 0 {
+		return 0, nil
+	}
+
+	if err := clk.Sleep(ctx, backoff); err != nil {
+		// Return the token, since the request will not be made.
+		if rsv != nil {
+			rsv.CancelAt(clk.Now())
+		}
+
+		return 0, err
+	}
+
+	return limited, nil
+}
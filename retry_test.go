@@ -0,0 +1,487 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// newFlakyServer will return a test server that responds with the status code
+// for the first "failures" requests and then with 200 (OK). The body of every
+// request must be "body", if it is set.
+func newFlakyServer(t *testing.T, failures int32, status int, body string) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var calls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ := io.ReadAll(r.Body)
+		if string(got) != body {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		if atomic.AddInt32(&calls, 1) <= failures {
+			w.WriteHeader(status)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server, &calls
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		base    time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{base: time.Second, attempt: 0, want: 0},
+		{base: time.Second, attempt: 1, want: time.Second},
+		{base: time.Second, attempt: 2, want: 2 * time.Second},
+		{base: time.Second, attempt: 3, want: 4 * time.Second},
+		{base: time.Second, attempt: 10, want: maxRetryBackoff},
+		{base: time.Second, attempt: 1000, want: maxRetryBackoff},
+		{attempt: 1, want: defaultRetryBackoff},
+	} {
+		if got := (ExponentialBackoff{Base: tcase.base}).NextDelay(tcase.attempt, nil); got != tcase.want {
+			t.Errorf("expected delay %v for attempt %d with base %v, got %v", tcase.want,
+				tcase.attempt, tcase.base, got)
+		}
+	}
+}
+
+func TestHTTPServiceRetry(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name        string
+		failures    int32
+		status      int
+		maxRetries  int
+		method      string
+		body        string
+		noGetBody   bool
+		wantErr     error
+		wantCalls   int32
+		wantRetries int64
+	}{
+		{
+			name:      "no retries",
+			failures:  1,
+			status:    http.StatusServiceUnavailable,
+			wantErr:   ErrBadResponse,
+			wantCalls: 1,
+		},
+		{
+			name:        "succeeds after retries",
+			failures:    2,
+			status:      http.StatusServiceUnavailable,
+			maxRetries:  3,
+			wantCalls:   3,
+			wantRetries: 2,
+		},
+		{
+			name:        "too many requests",
+			failures:    1,
+			status:      http.StatusTooManyRequests,
+			maxRetries:  1,
+			wantCalls:   2,
+			wantRetries: 1,
+		},
+		{
+			name:        "retries exhausted",
+			failures:    5,
+			status:      http.StatusInternalServerError,
+			maxRetries:  2,
+			wantErr:     ErrBadResponse,
+			wantCalls:   3,
+			wantRetries: 2,
+		},
+		{
+			name:       "client error is not retried",
+			failures:   1,
+			status:     http.StatusNotFound,
+			maxRetries: 3,
+			wantErr:    ErrBadResponse,
+			wantCalls:  1,
+		},
+		{
+			name:        "body is sent on each retry",
+			failures:    2,
+			status:      http.StatusServiceUnavailable,
+			maxRetries:  2,
+			method:      http.MethodPost,
+			body:        `{"id":1}`,
+			wantCalls:   3,
+			wantRetries: 2,
+		},
+		{
+			name:       "body that cannot be rewound is not retried",
+			failures:   1,
+			status:     http.StatusServiceUnavailable,
+			maxRetries: 2,
+			method:     http.MethodPost,
+			body:       `{"id":1}`,
+			noGetBody:  true,
+			wantErr:    ErrBadResponse,
+			wantCalls:  1,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			server, calls := newFlakyServer(t, tcase.failures, tcase.status, tcase.body)
+
+			method := tcase.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			req, err := http.NewRequestWithContext(context.Background(), method, server.URL,
+				strings.NewReader(tcase.body))
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+
+			if tcase.noGetBody {
+				req.GetBody = nil
+			}
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			svc.HTTP.
+				MaxRetries(tcase.maxRetries).
+				RetryBackoff(time.Millisecond).
+				Requests(NewHTTPRequest(req))
+
+			err = svc.HTTP.Store(context.Background())
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+
+			if got := atomic.LoadInt32(calls); got != tcase.wantCalls {
+				t.Errorf("expected %d calls, got %d", tcase.wantCalls, got)
+			}
+
+			if got := svc.HTTP.Result().Retries; got != tcase.wantRetries {
+				t.Errorf("expected %d retries, got %d", tcase.wantRetries, got)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceRetryRateLimit(t *testing.T) {
+	t.Parallel()
+
+	const (
+		period  = 100 * time.Millisecond
+		backoff = 100 * time.Millisecond
+	)
+
+	server, _ := newFlakyServer(t, 2, http.StatusServiceUnavailable, "")
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	svc.HTTP.
+		RateLimiter(rate.NewLimiter(rate.Every(period), 1)).
+		MaxRetries(2).
+		RetryBackoff(backoff).
+		Requests(newTestServerRequest(t, server.URL))
+
+	start := time.Now()
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	elapsed := time.Since(start)
+
+	// The first retry waits for the larger of the backoff and the limiter
+	// (100ms), the second for the larger of the doubled backoff and the
+	// limiter (200ms). If the delays were stacked, the run would take at
+	// least 500ms.
+	const (
+		want    = backoff + 2*backoff
+		stacked = (backoff + period) + (2*backoff + period)
+	)
+
+	if elapsed < want {
+		t.Errorf("expected the retries to take at least %v, got %v", want, elapsed)
+	}
+
+	if elapsed >= stacked {
+		t.Errorf("expected the backoff and rate limiter delays to overlap, took %v", elapsed)
+	}
+}
+
+func TestBackoffStrategy(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name     string
+		strategy BackoffStrategy
+		want     []time.Duration // delays of attempts 1, 2, ...
+	}{
+		{
+			name:     "constant",
+			strategy: ConstantBackoff{Delay: time.Second},
+			want:     []time.Duration{time.Second, time.Second, time.Second},
+		},
+		{
+			name:     "exponential",
+			strategy: ExponentialBackoff{Base: time.Second, Max: 5 * time.Second},
+			want:     []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second},
+		},
+		{
+			name:     "exponential beyond the default maximum",
+			strategy: ExponentialBackoff{Base: 20 * time.Second, Max: time.Minute},
+			want:     []time.Duration{20 * time.Second, 40 * time.Second, time.Minute},
+		},
+		{
+			name:     "exponential defaults",
+			strategy: ExponentialBackoff{},
+			want:     []time.Duration{defaultRetryBackoff, 2 * defaultRetryBackoff},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			for idx, want := range tcase.want {
+				if got := tcase.strategy.NextDelay(idx+1, nil); got != want {
+					t.Errorf("expected delay %v for attempt %d, got %v", want, idx+1, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDecorrelatedJitter(t *testing.T) {
+	t.Parallel()
+
+	strategy := DecorrelatedJitter{Base: time.Second, Max: 20 * time.Second}
+
+	for _, tcase := range []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{attempt: 0},
+		{attempt: 1, min: time.Second, max: time.Second},
+		{attempt: 2, min: time.Second, max: 3 * time.Second},
+		{attempt: 3, min: time.Second, max: 9 * time.Second},
+		{attempt: 4, min: time.Second, max: 20 * time.Second},
+		{attempt: 100, min: time.Second, max: 20 * time.Second},
+	} {
+		for i := 0; i < 100; i++ {
+			got := strategy.NextDelay(tcase.attempt, nil)
+			if got < tcase.min || got > tcase.max {
+				t.Fatalf("expected delay for attempt %d in [%v, %v], got %v", tcase.attempt,
+					tcase.min, tcase.max, got)
+			}
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tcase := range []struct {
+		name       string
+		retryAfter string
+		want       time.Duration
+	}{
+		{name: "no header", want: time.Second},
+		{name: "seconds", retryAfter: "7", want: 7 * time.Second},
+		{name: "zero seconds", retryAfter: "0", want: 0},
+		{name: "date", retryAfter: now.Add(time.Minute).Format(http.TimeFormat), want: time.Minute},
+		{name: "date in the past", retryAfter: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{name: "invalid", retryAfter: "soon", want: time.Second},
+		{name: "negative", retryAfter: "-1", want: time.Second},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			strategy := RetryAfter(ConstantBackoff{Delay: time.Second})
+
+			rsp := &http.Response{Header: http.Header{}}
+			if tcase.retryAfter != "" {
+				rsp.Header.Set("Retry-After", tcase.retryAfter)
+			}
+
+			if got := nextDelay(strategy, 1, rsp, now); got != tcase.want {
+				t.Errorf("expected delay %v, got %v", tcase.want, got)
+			}
+		})
+	}
+
+	// Without a response, e.g. after a transport error, the fallback is
+	// used.
+	if got := RetryAfter(ConstantBackoff{Delay: time.Second}).NextDelay(1, nil); got != time.Second {
+		t.Errorf("expected the fallback delay without a response, got %v", got)
+	}
+}
+
+func TestHTTPServiceBackoff(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	clk := newFakeClock()
+
+	svc, err := NewService(context.Background(), withClock(clk))
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	svc.HTTP.
+		MaxRetries(2).
+		RetryBackoff(time.Hour). // ignored, since a strategy is set
+		Backoff(RetryAfter(ConstantBackoff{Delay: time.Second})).
+		Requests(newTestServerRequest(t, server.URL))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	// The first retry waits for the "Retry-After" header, and the second,
+	// whose response has no such header, for the fallback.
+	want := []time.Duration{7 * time.Second, time.Second}
+	if got := clk.slept(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected sleeps %v, got %v", want, got)
+	}
+}
+
+func TestHTTPServiceRetryAfterClock(t *testing.T) {
+	t.Parallel()
+
+	clk := newFakeClock()
+
+	// The date is in the past of the real time, so the delay is only
+	// waited for if it is measured from the time of the service's clock.
+	retryAt := clk.Now().Add(90 * time.Second).Format(http.TimeFormat)
+
+	var calls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", retryAt)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	svc, err := NewService(context.Background(), withClock(clk))
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	svc.HTTP.
+		MaxRetries(1).
+		Backoff(RetryAfter(ConstantBackoff{Delay: time.Second})).
+		Requests(newTestServerRequest(t, server.URL))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	want := []time.Duration{90 * time.Second}
+	if got := clk.slept(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected sleeps %v, got %v", want, got)
+	}
+}
+
+// cancelClock is a clock that cancels the context of the request when it is
+// slept on, e.g. during the backoff of a retry.
+type cancelClock struct {
+	cancel context.CancelFunc
+}
+
+func (cancelClock) Now() time.Time { return time.Now() }
+
+func (clk cancelClock) Sleep(ctx context.Context, _ time.Duration) error {
+	clk.cancel()
+
+	return ctx.Err()
+}
+
+func TestFetchCanceledDuringBackoff(t *testing.T) {
+	t.Parallel()
+
+	server, calls := newFlakyServer(t, 1, http.StatusServiceUnavailable, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	job := &webWorkerJob{
+		req:        newTestServerRequest(t, server.URL),
+		client:     &http.Client{},
+		stats:      &storeStats{},
+		maxRetries: 1,
+		backoff:    ConstantBackoff{Delay: time.Second},
+		clock:      cancelClock{cancel: cancel},
+	}
+
+	rspCh, errCh := fetch(ctx, job)
+
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected error %v, got %v", context.Canceled, err)
+	}
+
+	if rsp := <-rspCh; rsp != nil {
+		t.Errorf("expected no response, got the discarded response with status %d", rsp.StatusCode)
+	}
+
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("expected one request to be made, got %d", got)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrRetryBudgetExhausted is returned when a request that failed could not be
+// retried because the retry budget of the run was used up, see "RetryBudget".
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// RetryBudget sets the number of retries that the requests of a run can make
+// between them, on top of the number of retries of each request set by
+// "MaxRetries", so that an endpoint that always fails cannot hold up the run
+// by retrying every one of its requests. The total budget is shared by every
+// request of the run, and the per-host budget by the requests to each host. A
+// budget of zero (the default) is unlimited.
+//
+// Once a budget is used up, a request that fails is not retried, and the run
+// fails fast with an ErrRetryBudgetExhausted error, which also wraps the error
+// or the status of the request's last attempt. The number of requests that
+// were not retried is counted in "StoreResult.RetriesDenied", and each is
+// logged as a warning.
+func (svc *HTTPService) RetryBudget(total, perHost int) *HTTPService {
+	svc.retryBudget = total
+	svc.hostRetryBudget = perHost
+
+	return svc
+}
+
+// retryBudget is the number of retries left to the requests of a run.
+type retryBudget struct {
+	total   int
+	perHost int
+
+	mtx   sync.Mutex
+	used  int
+	hosts map[string]int
+}
+
+// newRetryBudget will create the budget of a run, returning nil if it is
+// unlimited.
+func newRetryBudget(total, perHost int) *retryBudget {
+	if total <= 0 && perHost <= 0 {
+		return nil
+	}
+
+	return &retryBudget{total: total, perHost: perHost, hosts: make(map[string]int)}
+}
+
+// take will take a retry of a request to the host from the budget, returning
+// false if the budget is used up.
+func (budget *retryBudget) take(host string) bool {
+	if budget == nil {
+		return true
+	}
+
+	budget.mtx.Lock()
+	defer budget.mtx.Unlock()
+
+	if budget.total > 0 && budget.used >= budget.total {
+		return false
+	}
+
+	if budget.perHost > 0 && budget.hosts[host] >= budget.perHost {
+		return false
+	}
+
+	budget.used++
+	budget.hosts[host]++
+
+	return true
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPServiceRetryBudget(t *testing.T) {
+	t.Parallel()
+
+	const reqCount = 4
+
+	for _, tcase := range []struct {
+		name       string
+		total      int
+		perHost    int
+		maxRetries int
+		wantErr    error
+		maxRetried int64
+	}{
+		{
+			name:       "unlimited",
+			maxRetries: 2,
+			wantErr:    ErrBadResponse,
+			maxRetried: reqCount * 2,
+		},
+		{
+			name:       "total",
+			total:      5,
+			maxRetries: 100,
+			wantErr:    ErrRetryBudgetExhausted,
+			maxRetried: 5,
+		},
+		{
+			name:       "per host",
+			perHost:    3,
+			maxRetries: 100,
+			wantErr:    ErrRetryBudgetExhausted,
+			maxRetried: 3,
+		},
+		{
+			name:       "total and per host",
+			total:      2,
+			perHost:    3,
+			maxRetries: 100,
+			wantErr:    ErrRetryBudgetExhausted,
+			maxRetried: 2,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			// The endpoint always fails.
+			server, calls := newFlakyServer(t, 1<<20, http.StatusServiceUnavailable, "")
+
+			reqs := make([]*Request, reqCount)
+			for idx := range reqs {
+				reqs[idx] = newTestServerRequest(t, server.URL)
+			}
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			svc.HTTP.
+				MaxRetries(tcase.maxRetries).
+				RetryBackoff(time.Millisecond).
+				RetryBudget(tcase.total, tcase.perHost).
+				Requests(reqs...)
+
+			err = svc.HTTP.Store(context.Background())
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+
+			if !errors.Is(err, ErrBadResponse) {
+				t.Errorf("expected error %v, got %v", ErrBadResponse, err)
+			}
+
+			result := svc.HTTP.Result()
+			if result.Retries > tcase.maxRetried {
+				t.Errorf("expected at most %d retries, got %d", tcase.maxRetried, result.Retries)
+			}
+
+			if got := int64(atomic.LoadInt32(calls)); got > reqCount+tcase.maxRetried {
+				t.Errorf("expected at most %d calls, got %d", reqCount+tcase.maxRetried, got)
+			}
+
+			budgeted := errors.Is(tcase.wantErr, ErrRetryBudgetExhausted)
+			if denied := result.RetriesDenied > 0; denied != budgeted {
+				t.Errorf("expected retries to be denied: %t, got %d denied", budgeted, result.RetriesDenied)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// URLRewriter returns the URL to fetch in place of the URL of a request, e.g.
+// to point the production URLs of a configuration at a staging host. The URL
+// it is given is a copy, which it may modify and return. If it returns nil,
+// then the URL of the request is fetched as-is.
+type URLRewriter func(*url.URL) *url.URL
+
+// RewriteURL sets a function that rewrites the URL of every request, and of
+// every page of a request, right before it is made. Only the request that is
+// sent is rewritten: checkpoints, the persisted queue, pagination, the
+// per-host state of probes, circuits and tuned rate limits, and the request
+// logs still identify a request by its original URL, so a run against a
+// rewritten host resumes the same requests as one against the original. The
+// request of each response, and so the URL that the list writers are given,
+// see RequestURLFromContext, is the rewritten URL that was fetched. By
+// default, URLs are not rewritten.
+func (svc *HTTPService) RewriteURL(rewrite URLRewriter) *HTTPService {
+	svc.rewriteURL = rewrite
+
+	return svc
+}
+
+// rewriteRequest will return a shallow copy of the request with its URL
+// rewritten, or the request itself if there is no rewriter.
+func rewriteRequest(req *http.Request, rewrite URLRewriter) *http.Request {
+	if rewrite == nil {
+		return req
+	}
+
+	rawURL := *req.URL
+
+	rewritten := rewrite(&rawURL)
+	if rewritten == nil {
+		return req
+	}
+
+	sent := req.WithContext(req.Context())
+	sent.URL = rewritten
+	sent.Host = ""
+
+	return sent
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestHTTPServiceRewriteURL(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan string, 2)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.RequestURI()
+
+		fmt.Fprint(w, `[{"id":1}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("failed to parse server URL: %v", err)
+	}
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	writer := &mockContextWriter{}
+
+	svc.HTTP.
+		RewriteURL(func(u *url.URL) *url.URL {
+			if u.Host != "api.example.com" {
+				return nil
+			}
+
+			u.Scheme, u.Host = serverURL.Scheme, serverURL.Host
+
+			return u
+		}).
+		Requests(newTestServerRequest(t, "https://api.example.com/trades?limit=1", WithWriters(writer)))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	if got := <-received; got != "/trades?limit=1" {
+		t.Errorf("expected the server to receive %q, got %q", "/trades?limit=1", got)
+	}
+
+	// The request keeps its original URL, which identifies it.
+	if got := svc.HTTP.requests[0].http.URL.Host; got != "api.example.com" {
+		t.Errorf("expected the request to keep its original host, got %q", got)
+	}
+
+	// The writer is given the URL that was fetched.
+	if got, _ := RequestURLFromContext(writer.ctxs[0]); got != server.URL+"/trades?limit=1" {
+		t.Errorf("expected the rewritten URL, got %q", got)
+	}
+}
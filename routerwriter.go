@@ -0,0 +1,128 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrNoRoute is returned when a RouterWriter routes a record to a key that has
+// no writer.
+var ErrNoRoute = errors.New("no writer for route")
+
+// RouteFunc returns the key of the writer that a record is written to, e.g. the
+// value of a "type" field. A record that is not an object is given as a record
+// with a single "value" field.
+type RouteFunc func(record map[string]interface{}) string
+
+// RouterWriter is a ListWriter that partitions each list it is given by a route
+// function, and writes each partition to the writer of its key, e.g. to split
+// a feed of mixed orders and trades into the storage of each. The records of a
+// partition keep their order in the list, and the partitions are written in the
+// order that their keys first appear in it.
+type RouterWriter struct {
+	route   RouteFunc
+	writers map[string]ListWriter
+}
+
+// NewRouterWriter will create a new RouterWriter that writes the records that
+// the route function gives a key to the writer of that key.
+func NewRouterWriter(route RouteFunc, writers map[string]ListWriter) *RouterWriter {
+	return &RouterWriter{route: route, writers: writers}
+}
+
+// Write will route every record of the list, and then write each partition to
+// its writer, returning the errors of every writer that fails. If a record is
+// routed to a key without a writer, then an ErrNoRoute error is returned and
+// nothing is written.
+func (rw *RouterWriter) Write(ctx context.Context, list *structpb.ListValue) error {
+	keys, partitions, err := partitionList(list, func(record map[string]interface{}) (string, error) {
+		key := rw.route(record)
+		if _, ok := rw.writers[key]; !ok {
+			return "", fmt.Errorf("%w: %q", ErrNoRoute, key)
+		}
+
+		return key, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, key := range keys {
+		writer := rw.writers[key]
+		if err := writer.Write(ctx, partitions[key]); err != nil {
+			errs = append(errs, fmt.Errorf("failed to write route %q to %T: %w", key, writer, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Ping will ping every writer of the router that implements Pinger.
+func (rw *RouterWriter) Ping(ctx context.Context) error {
+	return pingWriters(ctx, rw.routedWriters())
+}
+
+// Flush will flush every writer of the router that implements Flusher.
+func (rw *RouterWriter) Flush(ctx context.Context) error {
+	return flushWriters(ctx, rw.routedWriters())
+}
+
+// routedWriters will return the writers of the router.
+func (rw *RouterWriter) routedWriters() []ListWriter {
+	writers := make([]ListWriter, 0, len(rw.writers))
+	for _, writer := range rw.writers {
+		writers = append(writers, writer)
+	}
+
+	return writers
+}
+
+// partitionList will partition the values of the list by the key of each
+// record, returning the keys in the order that they first appear. A value that
+// is not an object is given to the key function as a record with a single
+// "value" field.
+func partitionList[K comparable](list *structpb.ListValue,
+	key func(record map[string]interface{}) (K, error),
+) ([]K, map[K]*structpb.ListValue, error) {
+	var keys []K
+
+	partitions := make(map[K]*structpb.ListValue)
+
+	for _, value := range list.GetValues() {
+		var record map[string]interface{}
+		if fields := value.GetStructValue(); fields != nil {
+			record = fields.AsMap()
+		} else {
+			record = map[string]interface{}{tableValueColumn: value.AsInterface()}
+		}
+
+		recordKey, err := key(record)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		partition, ok := partitions[recordKey]
+		if !ok {
+			partition = &structpb.ListValue{}
+			partitions[recordKey] = partition
+			keys = append(keys, recordKey)
+		}
+
+		partition.Values = append(partition.Values, value)
+	}
+
+	return keys, partitions, nil
+}
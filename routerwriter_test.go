@@ -0,0 +1,94 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// routeByType will route a record by its "type" field.
+func routeByType(record map[string]interface{}) string {
+	typ, _ := record["type"].(string)
+
+	return typ
+}
+
+func TestHTTPServiceRouterWriter(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"type":"order","id":1},{"type":"trade","id":2},{"type":"order","id":3}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Run("split by route", func(t *testing.T) {
+		t.Parallel()
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		orders, trades := &mockListWriter{}, &mockListWriter{}
+
+		router := NewRouterWriter(routeByType, map[string]ListWriter{"order": orders, "trade": trades})
+
+		svc.HTTP.Requests(newTestServerRequest(t, server.URL, WithWriters(router)))
+
+		if err := svc.HTTP.Store(context.Background()); err != nil {
+			t.Fatalf("failed to store: %v", err)
+		}
+
+		// The JSON of the lists is not stable, so compare it without
+		// whitespace.
+		if want := `[{"id":1,"type":"order"},{"id":3,"type":"order"}]`; orders.count != 1 ||
+			strings.ReplaceAll(string(orders.data[0]), " ", "") != want {
+			t.Errorf("expected orders %s, got %q", want, orders.data)
+		}
+
+		if want := `[{"id":2,"type":"trade"}]`; trades.count != 1 ||
+			strings.ReplaceAll(string(trades.data[0]), " ", "") != want {
+			t.Errorf("expected trades %s, got %q", want, trades.data)
+		}
+
+		if got := svc.HTTP.Result().Records; got != 3 {
+			t.Errorf("expected 3 records, got %d", got)
+		}
+	})
+
+	t.Run("no route", func(t *testing.T) {
+		t.Parallel()
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		orders := &mockListWriter{}
+
+		router := NewRouterWriter(routeByType, map[string]ListWriter{"order": orders})
+
+		svc.HTTP.Requests(newTestServerRequest(t, server.URL, WithWriters(router)))
+
+		if err := svc.HTTP.Store(context.Background()); !errors.Is(err, ErrNoRoute) {
+			t.Errorf("expected %v, got %v", ErrNoRoute, err)
+		}
+
+		if orders.count != 0 {
+			t.Errorf("expected nothing written, got %q", orders.data)
+		}
+	})
+}
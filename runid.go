@@ -0,0 +1,94 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+)
+
+// crockford is the Crockford base32 alphabet used to encode ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidLen is the length of an encoded ULID.
+const ulidLen = 26
+
+type runIDKey struct{}
+
+// WithRunID will set the identifier used to correlate the logs and storage
+// writes of a single service run. The run ID is attached to every log entry
+// and is propagated to list writers through the context, see RunIDFromContext.
+// If no run ID is set, then a random ULID is generated when the service is
+// created.
+func WithRunID(id string) ServiceOption {
+	return func(svc *Service) {
+		svc.runID = id
+	}
+}
+
+// RunIDFromContext will return the run ID of the service that produced the
+// context, if any. List writers can use this to tie their own logs back to
+// the originating run.
+func RunIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(runIDKey{}).(string)
+
+	return id, ok
+}
+
+// contextWithRunID will return a copy of the context carrying the run ID. If
+// the run ID is empty, then the context is returned unchanged.
+func contextWithRunID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+
+	return context.WithValue(ctx, runIDKey{}, id)
+}
+
+// newULID will return a new Universally Unique Lexicographically Sortable
+// Identifier for the given time, using the entropy source for the random
+// component.
+func newULID(now time.Time, entropy io.Reader) (string, error) {
+	const (
+		timeBytes = 6
+		bitsPerCh = 5
+		mask      = 0x1f
+	)
+
+	var buf [16]byte
+
+	msec := uint64(now.UnixMilli())
+	for i := timeBytes - 1; i >= 0; i-- {
+		buf[i] = byte(msec)
+		msec >>= 8
+	}
+
+	if _, err := io.ReadFull(entropy, buf[timeBytes:]); err != nil {
+		return "", fmt.Errorf("failed to read entropy: %w", err)
+	}
+
+	num := new(big.Int).SetBytes(buf[:])
+	out := make([]byte, ulidLen)
+
+	for i := ulidLen - 1; i >= 0; i-- {
+		out[i] = crockford[new(big.Int).And(num, big.NewInt(mask)).Int64()]
+		num.Rsh(num, bitsPerCh)
+	}
+
+	return string(out), nil
+}
+
+// newRunID will return a new random run ID for the given time.
+func newRunID(now time.Time) (string, error) {
+	return newULID(now, rand.Reader)
+}
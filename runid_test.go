@@ -0,0 +1,98 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewULID(t *testing.T) {
+	t.Parallel()
+
+	entropy := bytes.Repeat([]byte{0}, 10)
+
+	got, err := newULID(time.UnixMilli(0), bytes.NewReader(entropy))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := strings.Repeat("0", ulidLen); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	earlier, err := newULID(time.UnixMilli(1), bytes.NewReader(bytes.Repeat([]byte{0xff}, 10)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	later, err := newULID(time.UnixMilli(2), bytes.NewReader(entropy))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if earlier >= later {
+		t.Errorf("expected %q to sort before %q", earlier, later)
+	}
+}
+
+func TestRunID(t *testing.T) {
+	t.Parallel()
+
+	t.Run("generated", func(t *testing.T) {
+		t.Parallel()
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		if len(svc.RunID()) != ulidLen {
+			t.Errorf("expected a generated ULID, got %q", svc.RunID())
+		}
+	})
+
+	t.Run("propagated to writers", func(t *testing.T) {
+		t.Parallel()
+
+		const runID = "test-run"
+
+		svc, err := NewService(context.Background(), WithRunID(runID))
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		writer := &mockContextWriter{}
+
+		reqs := newHTTPRequests(2)
+		for _, req := range reqs {
+			req.writers = []ListWriter{writer}
+		}
+
+		svc.HTTP.Requests(reqs...)
+		svc.HTTP.client = newMockHTTPClient(withMockHTTPClientRequests(reqs...))
+
+		if err := svc.HTTP.Store(context.Background()); err != nil {
+			t.Fatalf("failed to store: %v", err)
+		}
+
+		if len(writer.ctxs) != len(reqs) {
+			t.Fatalf("expected %d writes, got %d", len(reqs), len(writer.ctxs))
+		}
+
+		for _, ctx := range writer.ctxs {
+			if got, _ := RunIDFromContext(ctx); got != runID {
+				t.Errorf("expected run ID %q, got %q", runID, got)
+			}
+		}
+	})
+}
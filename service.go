@@ -10,7 +10,11 @@ package gidari
 
 import (
 	"context"
-	"sync"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
 
 	structpb "google.golang.org/protobuf/types/known/structpb"
 )
@@ -25,11 +29,30 @@ type Service struct {
 	// Socket is used for transporting and processing data over a socket
 	// connection.
 	Socket *SocketService
+
+	// GRPC is used for transporting and processing the responses of
+	// server-streaming gRPC calls.
+	GRPC *GRPCService
+
+	logger *slog.Logger
+	runID  string
+	clock  clock
 }
 
 // ServiceOption is a function for configuring a Service.
 type ServiceOption func(*Service)
 
+// WithLogger will set a structured logger on the service. The logger is used
+// to emit debugging events for the lifecycle of each request, such as rate
+// limit waits, request completion, decode failures, and writes. Sensitive
+// headers (e.g. "Authorization") are redacted. If no logger is set, then no
+// logging is done.
+func WithLogger(logger *slog.Logger) ServiceOption {
+	return func(svc *Service) {
+		svc.logger = logger
+	}
+}
+
 // NewService will create a new Service.
 func NewService(ctx context.Context, opts ...ServiceOption) (*Service, error) {
 	svc := &Service{}
@@ -37,21 +60,188 @@ func NewService(ctx context.Context, opts ...ServiceOption) (*Service, error) {
 		opt(svc)
 	}
 
+	if svc.clock == nil {
+		svc.clock = realClock{}
+	}
+
+	if svc.runID == "" {
+		runID, err := newRunID(svc.clock.Now())
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate run ID: %w", err)
+		}
+
+		svc.runID = runID
+	}
+
+	if svc.logger != nil {
+		svc.logger = svc.logger.With(slog.String("run_id", svc.runID))
+	}
+
 	svc.HTTP = NewHTTPService(svc)
 	svc.Socket = NewSocketService(svc)
+	svc.GRPC = NewGRPCService(svc)
 
 	return svc, nil
 }
 
+// RunID returns the identifier used to correlate the logs and storage writes
+// of the service.
+func (svc *Service) RunID() string {
+	return svc.runID
+}
+
 // ListWriter is use to write data to io, storage, whatever, from a list of
 // structpb.Values.
 type ListWriter interface {
 	Write(cxt context.Context, list *structpb.ListValue) error
 }
 
+// NopWriter is a ListWriter that discards every list, e.g. to decode the
+// responses of a request without storing them. Unlike a request with no
+// writers in a fetch-only run, see the HTTP Service's "FetchOnly" method, the
+// responses are still decoded, so one that cannot be decoded is an error.
+type NopWriter struct{}
+
+// Write will discard the list.
+func (NopWriter) Write(context.Context, *structpb.ListValue) error {
+	return nil
+}
+
+// Pinger is an optional interface that a ListWriter can implement to verify
+// connectivity with the underlying storage. Services will ping every writer
+// that implements Pinger before fetching any data, failing fast if the storage
+// is unreachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// uniqueWriters will return the set of distinct writers in the order they
+// first appear. Writers that are not comparable are always included.
+func uniqueWriters(writers []ListWriter) []ListWriter {
+	seen := make(map[ListWriter]struct{})
+	unique := make([]ListWriter, 0, len(writers))
+
+	for _, writer := range writers {
+		if writer == nil {
+			continue
+		}
+
+		if reflect.TypeOf(writer).Comparable() {
+			if _, ok := seen[writer]; ok {
+				continue
+			}
+
+			seen[writer] = struct{}{}
+		}
+
+		unique = append(unique, writer)
+	}
+
+	return unique
+}
+
+// pingWriters will ping every writer that implements the Pinger interface.
+func pingWriters(ctx context.Context, writers []ListWriter) error {
+	for _, writer := range uniqueWriters(writers) {
+		pinger, ok := writer.(Pinger)
+		if !ok {
+			continue
+		}
+
+		if err := pinger.Ping(ctx); err != nil {
+			return fmt.Errorf("failed to ping writer %T: %w", writer, err)
+		}
+	}
+
+	return nil
+}
+
+// Flusher is an optional interface that a ListWriter can implement to write
+// any lists it has buffered, e.g. to send a partial batch or to commit the
+// final transaction. Services flush every writer that implements Flusher once
+// every list of a run has been given to the writers, and before the run
+// returns, so that a run does not complete with data still buffered. A writer
+// whose Flush only returns once its data is durable makes a successful run
+// mean that every record is durable.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// flushWriters will flush every writer that implements the Flusher interface,
+// returning the errors of every writer that fails.
+func flushWriters(ctx context.Context, writers []ListWriter) error {
+	var errs []error
+
+	for _, writer := range uniqueWriters(writers) {
+		flusher, ok := writer.(Flusher)
+		if !ok {
+			continue
+		}
+
+		if err := flusher.Flush(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to flush writer %T: %w", writer, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 type listWriterJob struct {
 	decFunc DecodeFunc
 	writers []ListWriter
+	mode    WriteMode
+	logger  *slog.Logger
+	url     string
+	stats   *storeStats
+
+	// idFields are the fields that identify the records, passed to the
+	// writers through the context.
+	idFields []string
+
+	// contextFields describe the request to the writers, through the
+	// context along with its URL.
+	contextFields map[string]string
+
+	// flatten will flatten each record before it is written, joining the
+	// keys with flattenSep.
+	flatten    bool
+	flattenSep string
+
+	// labels are set on each record before it is written, after any
+	// flattening.
+	labels        map[string]string
+	labelConflict LabelConflict
+
+	// fingerprint is the field set to the hash of each record, after any
+	// labels.
+	fingerprint string
+
+	// validate checks each record as it is decoded, and the records that
+	// fail are written to invalidWriter rather than the writers.
+	validate      RecordValidator
+	invalidWriter ListWriter
+
+	// checkpoint marks the request identified by checkpointKey as done
+	// once checkpointLast, the last page of the request, is written. If
+	// markOnly is true, then there is no data to write, and the request
+	// is only marked.
+	checkpoint     CheckpointStore
+	checkpointKey  string
+	checkpointLast bool
+	markOnly       bool
+
+	// queue records that the page of the request identified by queueKey
+	// has been stored, and that queueNext is the page to store next.
+	queue     *persistedQueue
+	queueKey  string
+	queueNext *http.Request
+
+	// dryRun will count the records without writing them.
+	dryRun bool
+
+	// capture is the response to capture if the list cannot be decoded
+	// or written, if any.
+	capture *capturedResponse
 }
 
 func writeList(ctx context.Context, job *listWriterJob) <-chan error {
@@ -60,29 +250,114 @@ func writeList(ctx context.Context, job *listWriterJob) <-chan error {
 	go func() {
 		defer close(errs)
 
+		if job.markOnly {
+			if job.checkpointLast {
+				if err := job.checkpoint.Mark(ctx, job.checkpointKey); err != nil {
+					errs <- fmt.Errorf("failed to mark checkpoint: %w", err)
+				}
+			}
+
+			return
+		}
+
 		list := &structpb.ListValue{}
 		if err := job.decFunc(list); err != nil {
+			if job.logger != nil {
+				job.logger.LogAttrs(ctx, slog.LevelError, "failed to decode response",
+					slog.String("url", job.url),
+					slog.String("error", err.Error()))
+			}
+
+			job.capture.capture(ctx, err)
 			errs <- err
 
 			return
 		}
 
-		wg := &sync.WaitGroup{}
-		wg.Add(len(job.writers))
+		reqCtx := contextWithRequest(ctx, job.url, job.contextFields)
 
-		for _, writer := range job.writers {
-			writer := writer
+		invalid := validateList(ctx, job, list)
+		if err := writeInvalid(reqCtx, job, invalid); err != nil {
+			job.capture.capture(ctx, err)
+			errs <- err
 
-			go func(writer ListWriter) {
-				defer wg.Done()
+			return
+		}
 
-				if err := writer.Write(ctx, list); err != nil {
-					errs <- err
-				}
-			}(writer)
+		if job.flatten {
+			flattenList(list, job.flattenSep)
+		}
+
+		if err := labelList(list, job.labels, job.labelConflict); err != nil {
+			errs <- err
+
+			return
+		}
+
+		if err := fingerprintList(list, job.fingerprint); err != nil {
+			errs <- err
+
+			return
+		}
+
+		if job.dryRun {
+			if job.stats != nil {
+				job.stats.records.Add(int64(len(list.Values)))
+			}
+
+			if job.logger != nil {
+				job.logger.LogAttrs(ctx, slog.LevelDebug, "dry run, skipped writing list",
+					slog.String("url", job.url),
+					slog.Int("records", len(list.Values)))
+			}
+
+			return
+		}
+
+		writeCtx := contextWithIDFields(reqCtx, job.idFields)
+
+		if err := NewMultiWriter(job.mode, job.writers...).Write(writeCtx, list); err != nil {
+			job.capture.capture(ctx, err)
+
+			// Tie the error back to the request that produced
+			// the data.
+			if job.url != "" {
+				err = fmt.Errorf("failed to write data of %s: %w", job.url, err)
+			}
+
+			errs <- err
+
+			return
+		}
+
+		if job.stats != nil {
+			job.stats.records.Add(int64(len(list.Values)))
+		}
+
+		// Only mark the checkpoint once the data of the last page has
+		// been written to every writer.
+		if job.checkpoint != nil && job.checkpointLast {
+			if err := job.checkpoint.Mark(ctx, job.checkpointKey); err != nil {
+				errs <- fmt.Errorf("failed to mark checkpoint: %w", err)
+
+				return
+			}
 		}
 
-		wg.Wait()
+		if job.queue != nil {
+			if err := job.queue.advance(job.queueKey, job.queueNext); err != nil {
+				errs <- err
+
+				return
+			}
+		}
+
+		if job.logger != nil {
+			job.logger.LogAttrs(ctx, slog.LevelDebug, "wrote list",
+				slog.String("url", job.url),
+				slog.Int("records", len(list.Values)),
+				slog.Int("writers", len(job.writers)))
+		}
 	}()
 
 	return errs
@@ -96,54 +371,81 @@ func writeList(ctx context.Context, job *listWriterJob) <-chan error {
 // })
 
 type listWriterChan struct {
-	done <-chan struct{}
 	err  <-chan error
 	jobs chan<- listWriterJob
 }
 
-// startListWriter will start a worker to upsert data from HTTP responses into
-// a database.
-func startListWriter(ctx context.Context, numJobs int) listWriterChan {
-	if numJobs == 0 {
-		numJobs = 1
-	}
+// defaultWriteBuffer is the number of responses that can be queued for the
+// list writer, if no buffer is set.
+const defaultWriteBuffer = 16
 
-	var (
-		jobs  chan listWriterJob
-		done  chan struct{}
-		errCh chan error
-	)
-
-	if numJobs > 0 {
-		done = make(chan struct{}, numJobs)
-		jobs = make(chan listWriterJob, numJobs)
-	} else {
-		jobs = make(chan listWriterJob)
+// startListWriter will start a worker to upsert data from HTTP responses into
+// a database. The worker will process jobs until the jobs channel is closed,
+// and flush every writer it wrote to that implements Flusher, and then send the
+// first error encountered (if any) before closing the error channel. The
+// buffer size bounds the number of jobs queued at once, and is independent of
+// the number of jobs sent: a sender blocks once the buffer is full, until the
+// worker catches up. A buffer size of zero or less uses the default.
+func startListWriter(ctx context.Context, bufSize int) listWriterChan {
+	if bufSize <= 0 {
+		bufSize = defaultWriteBuffer
 	}
 
-	errCh = make(chan error, 1)
+	jobs := make(chan listWriterJob, bufSize)
+	errCh := make(chan error, 1)
 
 	go func() {
 		defer close(errCh)
 
-		if done != nil {
-			defer close(done)
-		}
+		var (
+			firstErr error
+			written  []ListWriter
+
+			// failedKeys are the checkpoint keys of the requests
+			// with a page that could not be written, which must
+			// not be marked as done.
+			failedKeys = make(map[string]bool)
+		)
 
 		for job := range jobs {
+			if failedKeys[job.checkpointKey] {
+				job.checkpointLast = false
+			}
+
 			errs := writeList(ctx, &job)
 			if err := <-errs; err != nil {
-				errCh <- err
+				// The later pages of the request must not
+				// move its progress past the failed page.
+				if job.queue != nil {
+					job.queue.fail(job.queueKey)
+				}
+
+				if job.checkpoint != nil {
+					failedKeys[job.checkpointKey] = true
+				}
+
+				if firstErr == nil {
+					firstErr = err
+				}
 			}
 
-			if done != nil {
-				done <- struct{}{}
+			if !job.dryRun {
+				written = uniqueWriters(append(written, job.writers...))
 			}
 		}
+
+		// Flush the writers that buffer lists, so that the data is
+		// written before the run returns.
+		if err := flushWriters(ctx, written); err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		if firstErr != nil {
+			errCh <- firstErr
+		}
 	}()
 
 	return listWriterChan{
-		done: done,
 		err:  errCh,
 		jobs: jobs,
 	}
@@ -0,0 +1,135 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+var errUnreachable = errors.New("unreachable")
+
+func TestPingWriters(t *testing.T) {
+	t.Parallel()
+
+	t.Run("healthy writers are pinged once", func(t *testing.T) {
+		t.Parallel()
+
+		writer := &mockPingWriter{}
+
+		err := pingWriters(context.Background(), []ListWriter{writer, writer, &mockUpsertWriter{}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if writer.pings != 1 {
+			t.Errorf("expected 1 ping, got %d", writer.pings)
+		}
+	})
+
+	t.Run("unreachable writer", func(t *testing.T) {
+		t.Parallel()
+
+		writer := &mockPingWriter{pingErr: errUnreachable}
+
+		err := pingWriters(context.Background(), []ListWriter{writer})
+		if !errors.Is(err, errUnreachable) {
+			t.Fatalf("expected error %v, got %v", errUnreachable, err)
+		}
+	})
+
+	t.Run("http store fails fast", func(t *testing.T) {
+		t.Parallel()
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		writer := &mockPingWriter{pingErr: errUnreachable}
+
+		reqs := newHTTPRequests(3)
+		for _, req := range reqs {
+			req.writers = []ListWriter{writer}
+		}
+
+		svc.HTTP.Requests(reqs...)
+		svc.HTTP.client = newMockHTTPClient(withMockHTTPClientRequests(reqs...))
+
+		err = svc.HTTP.Store(context.Background())
+		if !errors.Is(err, errUnreachable) {
+			t.Fatalf("expected error %v, got %v", errUnreachable, err)
+		}
+
+		if writer.count != 0 {
+			t.Errorf("expected no writes, got %d", writer.count)
+		}
+	})
+}
+
+func TestHTTPServiceStoreFlush(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name   string
+		writer func(tx *mockTxWriter) ListWriter
+	}{
+		{
+			name:   "transactional writer",
+			writer: func(tx *mockTxWriter) ListWriter { return tx },
+		},
+		{
+			name: "buffered transactional writer",
+			writer: func(tx *mockTxWriter) ListWriter {
+				return NewBufferedWriter(tx, 1)
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			tx := &mockTxWriter{}
+			writer := tcase.writer(tx)
+
+			reqs := newHTTPRequests(5)
+
+			opts := []mockHTTPClientOption{}
+			for _, req := range reqs {
+				req.writers = []ListWriter{writer}
+				opts = append(opts, withMockHTTPClientResponseBody(req, []byte(`[{"id":1}]`)))
+			}
+
+			svc.HTTP.Requests(reqs...)
+			svc.HTTP.client = newMockHTTPClient(opts...)
+
+			if err := svc.HTTP.Store(context.Background()); err != nil {
+				t.Fatalf("failed to store: %v", err)
+			}
+
+			// Every list is committed as soon as Store returns, and
+			// the writer is flushed once for the run.
+			if tx.committed != len(reqs) || tx.staged != 0 {
+				t.Errorf("expected %d committed lists, got %d (%d staged)", len(reqs),
+					tx.committed, tx.staged)
+			}
+
+			if tx.flushes != 1 {
+				t.Errorf("expected 1 flush, got %d", tx.flushes)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// ShardFunc returns the shard that a record is written to, e.g. from a hash of
+// its "symbol" field. The shard is taken modulo the number of shards, so any
+// integer, including a negative one, is a valid shard.
+type ShardFunc func(record map[string]interface{}) int
+
+// ShardWriter is a ListWriter that spreads the records of each list it is
+// given across many writers, e.g. one per database instance, so that writes
+// can be scaled out. Each list is partitioned by the shard function, and each
+// partition is written to the writer of its shard, in the same way as a
+// RouterWriter.
+type ShardWriter struct {
+	shard   ShardFunc
+	writers []ListWriter
+}
+
+// NewShardWriter will create a new ShardWriter that writes each record to the
+// writer at the index that the shard function returns for it.
+func NewShardWriter(shard ShardFunc, writers ...ListWriter) *ShardWriter {
+	return &ShardWriter{shard: shard, writers: writers}
+}
+
+// ShardByField will return a ShardFunc that shards records by the FNV-1a hash
+// of the string form of the field, so that every record with the same value of
+// the field is written to the same shard. A record without the field is
+// written to the first shard.
+func ShardByField(field string) ShardFunc {
+	return func(record map[string]interface{}) int {
+		value, ok := record[field]
+		if !ok {
+			return 0
+		}
+
+		hash := fnv.New32a()
+		_, _ = fmt.Fprint(hash, value)
+
+		return int(hash.Sum32() & (1<<31 - 1))
+	}
+}
+
+// Write will shard every record of the list, and then write each partition to
+// the writer of its shard, returning the errors of every writer that fails.
+func (sw *ShardWriter) Write(ctx context.Context, list *structpb.ListValue) error {
+	if len(sw.writers) == 0 {
+		return nil
+	}
+
+	shards, partitions, err := partitionList(list, func(record map[string]interface{}) (int, error) {
+		shard := sw.shard(record) % len(sw.writers)
+		if shard < 0 {
+			shard += len(sw.writers)
+		}
+
+		return shard, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, shard := range shards {
+		writer := sw.writers[shard]
+		if err := writer.Write(ctx, partitions[shard]); err != nil {
+			errs = append(errs, fmt.Errorf("failed to write shard %d to %T: %w", shard, writer, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Ping will ping every shard that implements Pinger.
+func (sw *ShardWriter) Ping(ctx context.Context) error {
+	return pingWriters(ctx, sw.writers)
+}
+
+// Flush will flush every shard that implements Flusher.
+func (sw *ShardWriter) Flush(ctx context.Context) error {
+	return flushWriters(ctx, sw.writers)
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPServiceShardWriter(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id":1,"symbol":"BTC"},{"id":2,"symbol":"SOL"},{"id":3,"symbol":"BTC"},{"id":4}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	for _, tcase := range []struct {
+		name  string
+		shard ShardFunc
+	}{
+		{
+			name: "shard func",
+			shard: func(record map[string]interface{}) int {
+				// Negative shards wrap around.
+				if record["symbol"] == "SOL" {
+					return -1
+				}
+
+				return 0
+			},
+		},
+		{
+			name:  "shard by field",
+			shard: ShardByField("symbol"),
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			shards := []*mockListWriter{{}, {}}
+
+			svc.HTTP.Requests(newTestServerRequest(t, server.URL,
+				WithWriters(NewShardWriter(tcase.shard, shards[0], shards[1]))))
+
+			if err := svc.HTTP.Store(context.Background()); err != nil {
+				t.Fatalf("failed to store: %v", err)
+			}
+
+			// Every record of a symbol is in the same shard, and
+			// the two symbols are in different shards.
+			got := map[string]int{}
+
+			for idx, shard := range shards {
+				for _, data := range shard.data {
+					list := strings.ReplaceAll(string(data), " ", "")
+					for _, symbol := range []string{"BTC", "SOL"} {
+						if strings.Contains(list, `"`+symbol+`"`) {
+							if prev, ok := got[symbol]; ok && prev != idx {
+								t.Errorf("expected every %s record in one shard", symbol)
+							}
+
+							got[symbol] = idx
+						}
+					}
+				}
+			}
+
+			if len(got) != 2 || got["BTC"] == got["SOL"] {
+				t.Errorf("expected BTC and SOL in different shards, got %v", got)
+			}
+
+			if records := svc.HTTP.Result().Records; records != 4 {
+				t.Errorf("expected 4 records, got %d", records)
+			}
+		})
+	}
+}
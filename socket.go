@@ -179,6 +179,20 @@ func (svc *SocketService) Connections(socs ...*Socket) *SocketService {
 // method will block until all sockets are closed, an error occurs, the context
 // is canceled, or the service is closed.
 func (svc *SocketService) Store(ctx context.Context) error {
+	if svc.svc != nil {
+		ctx = contextWithRunID(ctx, svc.svc.runID)
+	}
+
+	// Verify that the storage is reachable before reading any messages.
+	writers := []ListWriter{}
+	for _, socket := range svc.sockets {
+		writers = append(writers, socket.writers...)
+	}
+
+	if err := pingWriters(ctx, writers); err != nil {
+		return err
+	}
+
 	svc.done = make(chan struct{}, 1)
 	socketErrors := make(chan error, len(svc.sockets))
 
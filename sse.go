@@ -0,0 +1,172 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// WithServerSentEvents sets the request to be a stream of server-sent events,
+// i.e. a long-lived response with a "text/event-stream" body, e.g. for a
+// real-time feed. Rather than reading the whole body, each event is emitted as
+// it arrives, as a response whose data is a single record of the event:
+//
+//	{"event": "trade", "id": "42", "data": {"price": 1.5}}
+//
+// The "event" is the type of the event, which is "message" if it is not set.
+// The "id" is the last event ID of the stream, and is left out if there is
+// none. The "data" is the data of the event, with the lines of multi-line data
+// joined by newlines, decoded as JSON if it is valid JSON, or as a string
+// otherwise. An event without data is not emitted, and comments and retry
+// fields are ignored.
+//
+// The stream is read until the server closes it, or until the context is
+// canceled. Events are emitted no faster than they are written, so a slow
+// writer holds back the reading of the stream. A stream has no pages, and is
+// never checkpointed, since it has no end to resume from. The maximum number of
+// body bytes, if set, applies to the whole stream. A request without an
+// "Accept" header asks for "text/event-stream", and a response without an
+// expected status is not read as a stream, see WithExpectStatus.
+func WithServerSentEvents() RequestOption {
+	return func(req *Request) {
+		req.sse = true
+	}
+}
+
+// serverSentEvent is a single event of a "text/event-stream".
+type serverSentEvent struct {
+	event string
+	id    string
+	data  string
+}
+
+// record will return the JSON record of the event.
+func (event serverSentEvent) record() ([]byte, error) {
+	var data interface{} = event.data
+	if json.Valid([]byte(event.data)) {
+		data = json.RawMessage(event.data)
+	}
+
+	record := map[string]interface{}{"event": event.event, "data": data}
+	if event.id != "" {
+		record["id"] = event.id
+	}
+
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	return encoded, nil
+}
+
+// readEvents will parse the events of a "text/event-stream", calling fn with
+// each as it is dispatched by a blank line, until the stream ends or fn returns
+// an error. Lines end with a line feed, optionally preceded by a carriage
+// return. An event that is not terminated before the end of the stream is
+// discarded.
+func readEvents(r io.Reader, fn func(event serverSentEvent) error) error {
+	reader := bufio.NewReader(r)
+
+	var (
+		lastID string
+		event  string
+		data   []string
+	)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read event stream: %w", err)
+		}
+
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		// A blank line dispatches the event.
+		if line == "" {
+			if len(data) > 0 {
+				if event == "" {
+					event = "message"
+				}
+
+				err := fn(serverSentEvent{event: event, id: lastID, data: strings.Join(data, "\n")})
+				if err != nil {
+					return err
+				}
+			}
+
+			event, data = "", nil
+
+			continue
+		}
+
+		// A line starting with a colon is a comment.
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				lastID = value
+			}
+		}
+	}
+}
+
+// sendEvents will read the events of the response, sending each to the
+// iterator as a response of its own, until the stream ends or the context is
+// canceled. The body is closed once the stream has been read.
+func (cfg *webWorkerConfig) sendEvents(ctx context.Context, job *webWorkerJob, rsp *http.Response) {
+	// The request is not bound to the context, so close the body to stop
+	// a read that is waiting for the next event.
+	stop := context.AfterFunc(ctx, func() { _ = rsp.Body.Close() })
+	defer stop()
+
+	defer rsp.Body.Close()
+
+	err := readEvents(rsp.Body, func(event serverSentEvent) error {
+		data, err := event.record()
+		if err != nil {
+			return err
+		}
+
+		eventRsp := *rsp
+		eventRsp.Body = io.NopCloser(bytes.NewReader(data))
+		eventRsp.ContentLength = int64(len(data))
+
+		if !cfg.sendCurrent(ctx, job, &Current{Response: &eventRsp, Data: data, req: job.req}) {
+			return ctx.Err()
+		}
+
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		cfg.sendErr(err)
+	}
+}
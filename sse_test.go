@@ -0,0 +1,210 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestReadEvents(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name   string
+		stream string
+		want   []serverSentEvent
+	}{
+		{
+			name:   "single event",
+			stream: "data: {\"id\":1}\n\n",
+			want:   []serverSentEvent{{event: "message", data: `{"id":1}`}},
+		},
+		{
+			name:   "multi-line data",
+			stream: "data: first\ndata: second\n\n",
+			want:   []serverSentEvent{{event: "message", data: "first\nsecond"}},
+		},
+		{
+			name:   "event type and id",
+			stream: "event: trade\nid: 1\ndata: a\n\ndata: b\n\n",
+			want: []serverSentEvent{
+				{event: "trade", id: "1", data: "a"},
+				{event: "message", id: "1", data: "b"},
+			},
+		},
+		{
+			name:   "carriage returns and comments",
+			stream: ": keep-alive\r\ndata:no space\r\nretry: 1000\r\n\r\n",
+			want:   []serverSentEvent{{event: "message", data: "no space"}},
+		},
+		{
+			name:   "event without data",
+			stream: "event: ping\n\ndata: a\n\n",
+			want:   []serverSentEvent{{event: "message", data: "a"}},
+		},
+		{
+			name:   "unterminated event",
+			stream: "data: a\n\ndata: b\n",
+			want:   []serverSentEvent{{event: "message", data: "a"}},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []serverSentEvent
+
+			err := readEvents(strings.NewReader(tcase.stream), func(event serverSentEvent) error {
+				got = append(got, event)
+
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("failed to read events: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tcase.want) {
+				t.Errorf("expected events %+v, got %+v", tcase.want, got)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreServerSentEvents(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "text/event-stream" {
+			w.WriteHeader(http.StatusNotAcceptable)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(w, "event: trade\nid: %d\ndata: {\"price\":%d}\n\n", i, i)
+			w.(http.Flusher).Flush()
+		}
+
+		fmt.Fprint(w, "data: not json\n\n")
+	}))
+	t.Cleanup(server.Close)
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	writer := &mockListWriter{}
+
+	svc.HTTP.Requests(newTestServerRequest(t, server.URL, WithWriters(writer), WithServerSentEvents()))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	var got []interface{}
+
+	for _, data := range writer.data {
+		list := &structpb.ListValue{}
+		if err := list.UnmarshalJSON(data); err != nil {
+			t.Fatalf("failed to unmarshal written data: %v", err)
+		}
+
+		got = append(got, list.AsSlice()...)
+	}
+
+	want := []interface{}{
+		map[string]interface{}{"event": "trade", "id": "1", "data": map[string]interface{}{"price": 1.0}},
+		map[string]interface{}{"event": "trade", "id": "2", "data": map[string]interface{}{"price": 2.0}},
+		map[string]interface{}{"event": "trade", "id": "3", "data": map[string]interface{}{"price": 3.0}},
+		map[string]interface{}{"event": "message", "id": "3", "data": "not json"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected records %v, got %v", want, got)
+	}
+}
+
+// cancelWriter is a ListWriter that cancels the run once it has been given a
+// number of lists.
+type cancelWriter struct {
+	mockListWriter
+
+	after  int
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(ctx context.Context, list *structpb.ListValue) error {
+	if err := w.mockListWriter.Write(ctx, list); err != nil {
+		return err
+	}
+
+	if w.count == w.after {
+		w.cancel()
+	}
+
+	return nil
+}
+
+func TestHTTPServiceStoreServerSentEventsCancel(t *testing.T) {
+	t.Parallel()
+
+	// The server sends two events, and then holds the stream open.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		fmt.Fprint(w, "data: 1\n\ndata: 2\n\n")
+		w.(http.Flusher).Flush()
+
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	writer := &cancelWriter{after: 2, cancel: cancel}
+
+	svc.HTTP.Requests(newTestServerRequest(t, server.URL, WithWriters(writer), WithServerSentEvents()))
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_ = svc.HTTP.Store(ctx)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the run to stop once the context was canceled")
+	}
+
+	if writer.count != 2 {
+		t.Errorf("expected 2 writes, got %d", writer.count)
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// StoreResult is a summary of a call to the HTTP Service's "Store" method.
+type StoreResult struct {
+	// Requests is the number of HTTP requests made.
+	Requests int64
+
+	// Retries is the number of requests that were retried. Each retry is
+	// also counted as a request.
+	Retries int64
+
+	// RetriesDenied is the number of failed requests that were not
+	// retried because the retry budget of the run was used up, see the
+	// HTTP Service's "RetryBudget" method.
+	RetriesDenied int64
+
+	// Records is the number of records written to the list writers. A
+	// record written to many writers is only counted once. In a dry run, it
+	// is the number of records that would have been written.
+	Records int64
+
+	// InvalidRecords is the number of records that were not written
+	// because they failed validation, see WithValidator.
+	InvalidRecords int64
+
+	// Bytes is the number of response body bytes read.
+	Bytes int64
+
+	// AvgLatency is the average time from making a request to receiving
+	// the headers of its response, over the requests with a response.
+	AvgLatency time.Duration
+
+	// RequestsPerSecond and RecordsPerSecond are the throughput of the
+	// run, over its duration.
+	RequestsPerSecond float64
+	RecordsPerSecond  float64
+
+	// RateLimitWait is the total time that requests were held back by the
+	// rate limiter, beyond any retry backoff. Requests wait concurrently,
+	// so it can exceed the duration of the run. A wait that is a large
+	// share of the run means the rate limiter, not the upstream, is the
+	// bottleneck.
+	RateLimitWait time.Duration
+
+	// MaxRequestQueue is the largest number of requests queued for the web
+	// workers at once.
+	MaxRequestQueue int64
+
+	// MaxWriteQueue is the largest number of responses queued for the list
+	// writers at once. A queue that is often full, see the HTTP Service's
+	// "WriteBuffer" method, means the writers are the bottleneck.
+	MaxWriteQueue int64
+
+	// Duration is the wall time of the run.
+	Duration time.Duration
+
+	// DryRun is true if the run did not write any records, see the HTTP
+	// Service's "DryRun" method.
+	DryRun bool
+}
+
+// StatsSnapshot is the progress of a run of the HTTP Service's "Store" method
+// at a point in time, see "Stats".
+type StatsSnapshot struct {
+	// Requests is the number of HTTP requests made so far, counting each
+	// retry.
+	Requests int64
+
+	// InFlight is the number of requests waiting for a response.
+	InFlight int64
+
+	// Retries is the number of requests that were retried so far.
+	Retries int64
+
+	// RetriesDenied is the number of failed requests that were not
+	// retried so far because the retry budget was used up.
+	RetriesDenied int64
+
+	// Records is the number of records written to the list writers so
+	// far, counted in the same way as "StoreResult.Records".
+	Records int64
+
+	// Bytes is the number of response body bytes read so far.
+	Bytes int64
+
+	// Errors is the number of requests that failed without a response
+	// after any retries, e.g. with a transport error, or that were denied
+	// a retry by the retry budget.
+	Errors int64
+
+	// Completed is the number of requests whose every page has been
+	// made, and Total is the number of requests of the run, or zero if it
+	// is not known, i.e. if the requests are received from a channel, see
+	// "RequestsChan". Pages are not counted in either.
+	Completed int64
+	Total     int64
+
+	// Elapsed is the time since the run started.
+	Elapsed time.Duration
+
+	// AvgLatency, RequestsPerSecond and RecordsPerSecond are those of
+	// the run so far, see "StoreResult".
+	AvgLatency        time.Duration
+	RequestsPerSecond float64
+	RecordsPerSecond  float64
+
+	// ETA is the estimated time until every request has completed, from
+	// the average time taken per completed request so far. For paginated
+	// requests, this assumes that the remaining requests have as many
+	// pages as the completed ones. It is zero if the total is not known,
+	// or if no request has completed yet.
+	ETA time.Duration
+}
+
+// storeStats are the counters updated by the workers during a run.
+type storeStats struct {
+	start time.Time
+	total int64
+	end   atomic.Int64 // unix nanoseconds, once the run has ended
+
+	requests      atomic.Int64
+	completed     atomic.Int64
+	latency       atomic.Int64 // nanoseconds
+	inFlight      atomic.Int64
+	retries       atomic.Int64
+	retriesDenied atomic.Int64
+	records       atomic.Int64
+	bytes         atomic.Int64
+	errors        atomic.Int64
+
+	invalidRecords atomic.Int64
+
+	rateLimitWait   atomic.Int64 // nanoseconds
+	maxRequestQueue atomic.Int64
+	maxWriteQueue   atomic.Int64
+}
+
+// newStoreStats will create the counters of a run that starts at the given
+// time, of a total number of requests, or zero if it is not known.
+func newStoreStats(start time.Time, total int) *storeStats {
+	return &storeStats{start: start, total: int64(total)}
+}
+
+// observeQueue will record the depth of a queue, keeping the largest depth
+// observed in peak.
+func observeQueue(peak *atomic.Int64, depth int) {
+	for {
+		cur := peak.Load()
+		if int64(depth) <= cur || peak.CompareAndSwap(cur, int64(depth)) {
+			return
+		}
+	}
+}
+
+// result will return the summary of the counters for a run of the given
+// duration.
+func (stats *storeStats) result(duration time.Duration) StoreResult {
+	return StoreResult{
+		Requests: stats.requests.Load(),
+		Retries:  stats.retries.Load(),
+		Records:  stats.records.Load(),
+		Bytes:    stats.bytes.Load(),
+		Duration: duration,
+
+		RetriesDenied:  stats.retriesDenied.Load(),
+		InvalidRecords: stats.invalidRecords.Load(),
+
+		AvgLatency:        stats.avgLatency(),
+		RequestsPerSecond: perSecond(stats.requests.Load(), duration),
+		RecordsPerSecond:  perSecond(stats.records.Load(), duration),
+
+		RateLimitWait:   time.Duration(stats.rateLimitWait.Load()),
+		MaxRequestQueue: stats.maxRequestQueue.Load(),
+		MaxWriteQueue:   stats.maxWriteQueue.Load(),
+	}
+}
+
+// snapshot will return the current value of the counters, and the rates
+// derived from them, at the given time.
+func (stats *storeStats) snapshot(now time.Time) StatsSnapshot {
+	snapshot := StatsSnapshot{
+		Requests:      stats.requests.Load(),
+		InFlight:      stats.inFlight.Load(),
+		Retries:       stats.retries.Load(),
+		RetriesDenied: stats.retriesDenied.Load(),
+		Records:       stats.records.Load(),
+		Bytes:         stats.bytes.Load(),
+		Errors:        stats.errors.Load(),
+		Completed:     stats.completed.Load(),
+		Total:         stats.total,
+	}
+
+	// The counters of a service that has not run yet have no start.
+	if stats.start.IsZero() {
+		return snapshot
+	}
+
+	if end := stats.end.Load(); end != 0 {
+		now = time.Unix(0, end)
+	}
+
+	snapshot.Elapsed = now.Sub(stats.start)
+	snapshot.AvgLatency = stats.avgLatency()
+	snapshot.RequestsPerSecond = perSecond(snapshot.Requests, snapshot.Elapsed)
+	snapshot.RecordsPerSecond = perSecond(snapshot.Records, snapshot.Elapsed)
+
+	if remaining := snapshot.Total - snapshot.Completed; snapshot.Completed > 0 && remaining > 0 {
+		snapshot.ETA = snapshot.Elapsed / time.Duration(snapshot.Completed) * time.Duration(remaining)
+	}
+
+	return snapshot
+}
+
+// finish will record the end of the run, after which the rates of a snapshot
+// no longer change.
+func (stats *storeStats) finish(now time.Time) {
+	stats.end.Store(now.UnixNano())
+}
+
+// avgLatency will return the average latency of the requests with a response.
+func (stats *storeStats) avgLatency() time.Duration {
+	requests := stats.requests.Load()
+	if requests == 0 {
+		return 0
+	}
+
+	return time.Duration(stats.latency.Load() / requests)
+}
+
+// perSecond will return the rate of the count over the duration, or zero if
+// no time has passed.
+func perSecond(count int64, duration time.Duration) float64 {
+	if duration <= 0 {
+		return 0
+	}
+
+	return float64(count) / duration.Seconds()
+}
+
+// countingBody is a response body that counts the bytes read from it.
+type countingBody struct {
+	body  io.ReadCloser
+	stats *storeStats
+}
+
+// Read will read from the underlying body, counting the bytes read.
+func (cb *countingBody) Read(buf []byte) (int, error) {
+	n, err := cb.body.Read(buf)
+	cb.stats.bytes.Add(int64(n))
+
+	return n, err //nolint:wrapcheck
+}
+
+// Close will close the underlying body.
+func (cb *countingBody) Close() error {
+	return cb.body.Close() //nolint:wrapcheck
+}
+
+// Result will return the summary of the most recent call to "Store". The
+// result is populated even if "Store" returns an error, reflecting the work
+// done up to the failure.
+func (svc *HTTPService) Result() StoreResult {
+	return svc.result
+}
+
+// Stats will return a snapshot of the progress of the current run of "Store",
+// e.g. to show a progress bar with the throughput and estimated time left.
+// Unlike "Result", it is safe to call from another goroutine while "Store" is
+// running. The counters are updated by the workers as they go, and are reset
+// when a run starts; between runs, they are those of the most recent run.
+func (svc *HTTPService) Stats() StatsSnapshot {
+	return svc.stats.Load().snapshot(svc.clock().Now())
+}
@@ -0,0 +1,324 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestHTTPServiceResult(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`[{"id":1},{"id":2}]`)
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	reqs := newHTTPRequests(3)
+
+	opts := []mockHTTPClientOption{}
+	for _, req := range reqs {
+		opts = append(opts, withMockHTTPClientResponseBody(req, body))
+	}
+
+	svc.HTTP.Requests(reqs...)
+	svc.HTTP.client = newMockHTTPClient(opts...)
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	got := svc.HTTP.Result()
+
+	if got.Requests != int64(len(reqs)) {
+		t.Errorf("expected %d requests, got %d", len(reqs), got.Requests)
+	}
+
+	if want := int64(2 * len(reqs)); got.Records != want {
+		t.Errorf("expected %d records, got %d", want, got.Records)
+	}
+
+	if want := int64(len(body) * len(reqs)); got.Bytes != want {
+		t.Errorf("expected %d bytes, got %d", want, got.Bytes)
+	}
+
+	if got.Duration <= 0 {
+		t.Errorf("expected a positive duration, got %v", got.Duration)
+	}
+}
+
+func TestHTTPServiceResultRateLimitWait(t *testing.T) {
+	t.Parallel()
+
+	const (
+		pages  = 3
+		period = 100 * time.Millisecond
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var page int
+
+		fmt.Sscan(r.URL.Query().Get("cursor"), &page) //nolint:errcheck
+
+		if page < pages-1 {
+			w.Header().Set("X-Next-Cursor", fmt.Sprint(page+1))
+		}
+
+		fmt.Fprintf(w, `[{"id":%d}]`, page)
+	}))
+	t.Cleanup(server.Close)
+
+	for _, tcase := range []struct {
+		name     string
+		rlimiter *rate.Limiter
+		want     time.Duration
+	}{
+		{
+			name: "no rate limiter",
+		},
+		{
+			// The first page is made at once, and each page after
+			// it waits for a token.
+			name:     "tight rate limiter",
+			rlimiter: rate.NewLimiter(rate.Every(period), 1),
+			want:     (pages - 1) * period,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background(), withClock(newFakeClock()))
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			svc.HTTP.Requests(newTestServerRequest(t, server.URL,
+				WithPagination(CursorPaginate("X-Next-Cursor", "cursor", WithCursorHeader()))))
+
+			if tcase.rlimiter != nil {
+				svc.HTTP.RateLimiter(tcase.rlimiter)
+			}
+
+			if err := svc.HTTP.Store(context.Background()); err != nil {
+				t.Fatalf("failed to store: %v", err)
+			}
+
+			if got := svc.HTTP.Result().RateLimitWait; got != tcase.want {
+				t.Errorf("expected a rate limit wait of %v, got %v", tcase.want, got)
+			}
+		})
+	}
+}
+
+func TestObserveQueue(t *testing.T) {
+	t.Parallel()
+
+	var peak atomic.Int64
+
+	for _, depth := range []int{2, 5, 3, 0} {
+		observeQueue(&peak, depth)
+	}
+
+	if got := peak.Load(); got != 5 {
+		t.Errorf("expected a peak of 5, got %d", got)
+	}
+}
+
+func TestHTTPServiceStats(t *testing.T) {
+	t.Parallel()
+
+	const requests = 8
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprint(w, `[{"id":1}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	writer := &mockListWriter{}
+
+	for i := 0; i < requests; i++ {
+		svc.HTTP.Requests(newTestServerRequest(t, fmt.Sprintf("%s/%d", server.URL, i), WithWriters(writer)))
+	}
+
+	svc.HTTP.MaxInFlight(2)
+
+	// Poll the stats while the run is in progress.
+	done := make(chan struct{})
+	polled := make(chan []StatsSnapshot)
+
+	go func() {
+		var snapshots []StatsSnapshot
+
+		for {
+			select {
+			case <-done:
+				polled <- snapshots
+
+				return
+			case <-time.After(time.Millisecond):
+				snapshots = append(snapshots, svc.HTTP.Stats())
+			}
+		}
+	}()
+
+	err = svc.HTTP.Store(context.Background())
+
+	close(done)
+
+	snapshots := <-polled
+
+	if err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	var prev, peak StatsSnapshot
+
+	for _, snapshot := range snapshots {
+		if snapshot.Requests < prev.Requests || snapshot.Records < prev.Records || snapshot.Bytes < prev.Bytes {
+			t.Fatalf("expected increasing counts, got %+v after %+v", snapshot, prev)
+		}
+
+		peak.InFlight = max(peak.InFlight, snapshot.InFlight)
+		prev = snapshot
+	}
+
+	if peak.InFlight == 0 || peak.InFlight > 2 {
+		t.Errorf("expected at most 2 requests in flight, and some, got %d", peak.InFlight)
+	}
+
+	got := svc.HTTP.Stats()
+	got.Elapsed, got.AvgLatency, got.RequestsPerSecond, got.RecordsPerSecond = 0, 0, 0, 0
+
+	want := StatsSnapshot{
+		Requests:  requests,
+		Records:   requests,
+		Bytes:     requests * 10,
+		Completed: requests,
+		Total:     requests,
+	}
+
+	if got != want {
+		t.Errorf("expected final stats %+v, got %+v", want, got)
+	}
+}
+
+// latencyClient is a client whose every request takes a fixed time on the
+// clock.
+type latencyClient struct {
+	clk     *fakeClock
+	latency time.Duration
+}
+
+func (c latencyClient) Do(req *http.Request) (*http.Response, error) {
+	c.clk.advance(c.latency)
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(`[{"id":1},{"id":2}]`)),
+		Request:    req,
+	}, nil
+}
+
+func TestHTTPServiceResultRates(t *testing.T) {
+	t.Parallel()
+
+	const requests = 4
+
+	clk := newFakeClock()
+
+	svc, err := NewService(context.Background(), withClock(clk))
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	// Make one request at a time, so that the run takes the latency of
+	// every request.
+	svc.HTTP.
+		Client(latencyClient{clk: clk, latency: 100 * time.Millisecond}).
+		MaxInFlight(1).
+		Requests(newHTTPRequests(requests)...)
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	result := svc.HTTP.Result()
+
+	if result.Duration != 400*time.Millisecond {
+		t.Fatalf("expected a duration of 400ms, got %v", result.Duration)
+	}
+
+	if result.AvgLatency != 100*time.Millisecond {
+		t.Errorf("expected an average latency of 100ms, got %v", result.AvgLatency)
+	}
+
+	if result.RequestsPerSecond != 10 || result.RecordsPerSecond != 20 {
+		t.Errorf("expected 10 requests and 20 records per second, got %v and %v",
+			result.RequestsPerSecond, result.RecordsPerSecond)
+	}
+
+	// The rates of the snapshot stop changing once the run has ended.
+	clk.advance(time.Hour)
+
+	if got := svc.HTTP.Stats(); got.Elapsed != result.Duration || got.RequestsPerSecond != 10 {
+		t.Errorf("expected the snapshot of the run to match its result, got %+v", got)
+	}
+}
+
+func TestStatsSnapshotETA(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tcase := range []struct {
+		name      string
+		total     int
+		completed int64
+		want      time.Duration
+	}{
+		{name: "known total", total: 10, completed: 4, want: 15 * time.Second},
+		{name: "unknown total", total: 0, completed: 4, want: 0},
+		{name: "nothing completed", total: 10, completed: 0, want: 0},
+		{name: "everything completed", total: 10, completed: 10, want: 0},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			stats := newStoreStats(start, tcase.total)
+			stats.completed.Store(tcase.completed)
+
+			got := stats.snapshot(start.Add(10 * time.Second))
+			if got.ETA != tcase.want {
+				t.Errorf("expected an ETA of %v, got %v", tcase.want, got.ETA)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// WithExpectStatus sets the status codes that the responses of the request are
+// expected to have, for endpoints whose success is not only a 200 (OK), e.g. a
+// lookup that responds with a 404 (Not Found) when there is nothing to find.
+// A response with an expected 2xx status is decoded and written like a 200. A
+// response with any other expected status has no data, so it is not written.
+// A response with an unexpected status fails with an ErrBadResponse error, and
+// is captured if the HTTP Service captures failures. By default, only a 200 is
+// expected.
+//
+// Retries are decided before the status is checked, so a request that expects
+// a 503 (Service Unavailable) must not also be retried.
+func WithExpectStatus(codes ...int) RequestOption {
+	return func(req *Request) {
+		req.expectStatus = append(req.expectStatus, codes...)
+	}
+}
+
+// checkStatus will check the status of the response against the statuses that
+// the request expects, returning false if the response has no data to store.
+func (req *Request) checkStatus(rsp *http.Response) (bool, error) {
+	expected := len(req.expectStatus) == 0 && rsp.StatusCode == http.StatusOK
+
+	for _, code := range req.expectStatus {
+		if code == rsp.StatusCode {
+			expected = true
+
+			break
+		}
+	}
+
+	if !expected {
+		return false, fmt.Errorf("%w: %d", ErrBadResponse, rsp.StatusCode)
+	}
+
+	return rsp.StatusCode >= http.StatusOK && rsp.StatusCode < http.StatusMultipleChoices, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestCheckStatus(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name        string
+		expect      []int
+		status      int
+		wantHasData bool
+		wantErr     error
+	}{
+		{name: "default ok", status: http.StatusOK, wantHasData: true},
+		{name: "default not found", status: http.StatusNotFound, wantErr: ErrBadResponse},
+		{name: "default created", status: http.StatusCreated, wantErr: ErrBadResponse},
+		{name: "expected not found", expect: []int{http.StatusOK, http.StatusNotFound}, status: http.StatusNotFound},
+		{name: "expected ok", expect: []int{http.StatusOK, http.StatusNotFound}, status: http.StatusOK, wantHasData: true},
+		{name: "expected created", expect: []int{http.StatusCreated}, status: http.StatusCreated, wantHasData: true},
+		{name: "ok not expected", expect: []int{http.StatusNotFound}, status: http.StatusOK, wantErr: ErrBadResponse},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := NewHTTPRequest(nil, WithExpectStatus(tcase.expect...))
+
+			hasData, err := req.checkStatus(&http.Response{StatusCode: tcase.status})
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+
+			if hasData != tcase.wantHasData {
+				t.Errorf("expected data %v, got %v", tcase.wantHasData, hasData)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceExpectStatus(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"not found"}`)
+
+			return
+		}
+
+		fmt.Fprint(w, `[{"id":1}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	for _, tcase := range []struct {
+		name       string
+		path       string
+		opts       []RequestOption
+		wantErr    error
+		wantWrites int
+	}{
+		{
+			name:       "expecting 404",
+			path:       "/missing",
+			opts:       []RequestOption{WithExpectStatus(http.StatusOK, http.StatusNotFound)},
+			wantWrites: 0,
+		},
+		{
+			name:    "expecting 200",
+			path:    "/missing",
+			wantErr: ErrBadResponse,
+		},
+		{
+			name:       "expecting 404 with data",
+			path:       "/found",
+			opts:       []RequestOption{WithExpectStatus(http.StatusOK, http.StatusNotFound)},
+			wantWrites: 1,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			writer := &mockListWriter{}
+
+			svc.HTTP.Requests(newTestServerRequest(t, server.URL+tcase.path,
+				append(tcase.opts, WithWriters(writer))...))
+
+			if err := svc.HTTP.Store(context.Background()); !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+
+			if writer.count != tcase.wantWrites {
+				t.Errorf("expected %d writes, got %d", tcase.wantWrites, writer.count)
+			}
+		})
+	}
+}
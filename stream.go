@@ -0,0 +1,76 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// NextStream will advance the iterator like "Next", but without reading the
+// response body into memory, returning the body as it is received from the
+// server, e.g. to copy a large CSV export straight to a file. If there are no
+// more responses, the returned boolean will be false.
+//
+// The caller owns the returned body and must close it, whether or not it is
+// read to the end. The iterator never closes the body out from under the
+// caller, but the next page of the request is only requested once the body of
+// the previous page is closed, so a body that is never closed stalls the
+// pages of its request. The body is also set on "Current.Response", and
+// "Current.Data" is nil.
+//
+// A run is either streamed or read into memory: the first call to "Next" or
+// "NextStream" once the iterator is created or reset decides which, and the
+// run must be advanced with the same method. Since the body is not read by the
+// iterator, pagination functions are given a nil body, so only pagination that
+// reads the response headers, e.g. WithCursorHeader, follows the pages of a
+// streamed response. Response interceptors are not run on streamed responses,
+// and the maximum number of body bytes is enforced as the body is read.
+func (iter *HTTPIteratorService) NextStream(ctx context.Context) (io.ReadCloser, bool) {
+	if !iter.advance(ctx, true) {
+		return nil, false
+	}
+
+	return iter.Current.Response.Body, true
+}
+
+// streamBody is the body of a streamed response, which lets the web worker
+// wait for the caller to close it.
+type streamBody struct {
+	io.ReadCloser
+
+	once   sync.Once
+	closed chan struct{}
+	err    error
+}
+
+func newStreamBody(body io.ReadCloser) *streamBody {
+	return &streamBody{ReadCloser: body, closed: make(chan struct{})}
+}
+
+// Close will close the underlying body. It is safe to call more than once.
+func (sb *streamBody) Close() error {
+	sb.once.Do(func() {
+		sb.err = sb.ReadCloser.Close()
+		close(sb.closed)
+	})
+
+	return sb.err
+}
+
+// wait will block until the body is closed. If the context is canceled first,
+// then the body is closed.
+func (sb *streamBody) wait(ctx context.Context) {
+	select {
+	case <-sb.closed:
+	case <-ctx.Done():
+		_ = sb.Close()
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// countWriter is an io.Writer that counts the bytes written to it.
+type countWriter struct {
+	n int64
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	c.n += int64(len(b))
+
+	return len(b), nil
+}
+
+//nolint:paralleltest // measures allocations, so nothing else may run.
+func TestHTTPIteratorServiceNextStreamLargeBody(t *testing.T) {
+	const size = 64 << 20 // 64 MiB
+
+	chunk := bytes.Repeat([]byte("a,b,c\n"), 1<<10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+
+		for written := 0; written < size; written += len(chunk) {
+			if _, err := w.Write(chunk[:min(len(chunk), size-written)]); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	svc, err := NewService(ctx)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	svc.HTTP.Requests(newTestServerRequest(t, server.URL))
+
+	var before, after runtime.MemStats
+
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	counter := &countWriter{}
+
+	for {
+		body, ok := svc.HTTP.Iterator.NextStream(ctx)
+		if !ok {
+			break
+		}
+
+		if svc.HTTP.Iterator.Current.Data != nil {
+			t.Errorf("expected no data for a streamed response")
+		}
+
+		if _, err := io.Copy(counter, body); err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+
+		if err := body.Close(); err != nil {
+			t.Fatalf("failed to close body: %v", err)
+		}
+	}
+
+	if err := svc.HTTP.Iterator.Err(); err != nil {
+		t.Fatalf("failed to iterate: %v", err)
+	}
+
+	runtime.ReadMemStats(&after)
+
+	if counter.n != size {
+		t.Errorf("expected %d bytes, got %d", size, counter.n)
+	}
+
+	// The body is copied through a small buffer, so far less than the
+	// size of the body is allocated.
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > size/4 {
+		t.Errorf("expected the body not to be buffered, allocated %d bytes", alloc)
+	}
+}
+
+func TestHTTPIteratorServiceNextStreamPages(t *testing.T) {
+	t.Parallel()
+
+	const pages = 3
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var page int
+
+		fmt.Sscan(r.URL.Query().Get("cursor"), &page) //nolint:errcheck
+
+		if page < pages-1 {
+			w.Header().Set("X-Next-Cursor", fmt.Sprint(page+1))
+		}
+
+		fmt.Fprintf(w, "page %d", page)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(ctx)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	svc.HTTP.Requests(newTestServerRequest(t, server.URL,
+		WithPagination(CursorPaginate("X-Next-Cursor", "cursor", WithCursorHeader()))))
+
+	var got []string
+
+	for {
+		body, ok := svc.HTTP.Iterator.NextStream(ctx)
+		if !ok {
+			break
+		}
+
+		data, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+
+		// The next page is only requested once the body is closed.
+		if err := body.Close(); err != nil {
+			t.Fatalf("failed to close body: %v", err)
+		}
+
+		got = append(got, string(data))
+	}
+
+	if err := svc.HTTP.Iterator.Err(); err != nil {
+		t.Fatalf("failed to iterate: %v", err)
+	}
+
+	want := []string{"page 0", "page 1", "page 2"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// Once reset, the responses are read into memory again.
+	svc.HTTP.Iterator.Reset()
+
+	if !svc.HTTP.Iterator.Next(ctx) {
+		t.Fatalf("failed to iterate: %v", svc.HTTP.Iterator.Err())
+	}
+
+	if data := string(svc.HTTP.Iterator.Current.Data); data != "page 0" {
+		t.Errorf("expected %q, got %q", "page 0", data)
+	}
+
+	svc.HTTP.Iterator.Close()
+}
@@ -0,0 +1,275 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// defaultTableMaxColumnWidth is the maximum width of a column of a TableWriter,
+// if none is set.
+const defaultTableMaxColumnWidth = 40
+
+// tableValueColumn is the column of a value that is not a record, e.g. a number
+// in a JSON array.
+const tableValueColumn = "value"
+
+// TableWriter is a ListWriter that renders each list it is given as an aligned
+// ASCII table, e.g. to see what an API returns from a CLI or a test:
+//
+//	+----+------+
+//	| id | name |
+//	+----+------+
+//	| 1  | a    |
+//	| 2  |      |
+//	+----+------+
+//
+// A list is the records of a single response, so the records of each response
+// are grouped into their own table. The columns are the union of the fields of
+// the records, in alphabetical order, and a record without a field has an empty
+// cell. A value that is not a record is shown in a "value" column. Nested
+// objects and arrays are shown as JSON. Lists may be written concurrently, but
+// each table is written to the underlying writer in a single call, so tables
+// are never interleaved.
+type TableWriter struct {
+	w              io.Writer
+	maxColumnWidth int
+	rowLimit       int
+
+	mtx sync.Mutex
+}
+
+// TableWriterOption is a function that will configure the table writer.
+type TableWriterOption func(*TableWriter)
+
+// NewTableWriter will create a new TableWriter that writes tables to w.
+func NewTableWriter(w io.Writer, opts ...TableWriterOption) *TableWriter {
+	tw := &TableWriter{w: w, maxColumnWidth: defaultTableMaxColumnWidth}
+
+	for _, opt := range opts {
+		opt(tw)
+	}
+
+	return tw
+}
+
+// WithTableMaxColumnWidth will set the maximum width of a column, in
+// characters. Longer cells are truncated, ending in "...". The default is 40,
+// and a width of zero or less means there is no maximum.
+func WithTableMaxColumnWidth(width int) TableWriterOption {
+	return func(tw *TableWriter) {
+		tw.maxColumnWidth = width
+	}
+}
+
+// WithTableRowLimit will set the maximum number of rows of each table. The
+// number of rows that are not shown is written below the table. A limit of
+// zero (the default) means there is no limit.
+func WithTableRowLimit(limit int) TableWriterOption {
+	return func(tw *TableWriter) {
+		tw.rowLimit = limit
+	}
+}
+
+// Write will write the list as a table. An empty list is not written.
+func (tw *TableWriter) Write(_ context.Context, list *structpb.ListValue) error {
+	if len(list.GetValues()) == 0 {
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	tw.render(buf, list.GetValues())
+
+	tw.mtx.Lock()
+	defer tw.mtx.Unlock()
+
+	if _, err := tw.w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write table: %w", err)
+	}
+
+	return nil
+}
+
+// render will render the values as a table.
+func (tw *TableWriter) render(buf *bytes.Buffer, values []*structpb.Value) {
+	shown := values
+	if tw.rowLimit > 0 && len(shown) > tw.rowLimit {
+		shown = shown[:tw.rowLimit]
+	}
+
+	columns := tableColumns(shown)
+
+	header := make([]string, len(columns))
+	widths := make([]int, len(columns))
+
+	for idx, col := range columns {
+		header[idx] = tw.truncate(col)
+		widths[idx] = utf8.RuneCountInString(header[idx])
+	}
+
+	rows := make([][]string, len(shown))
+
+	for idx, val := range shown {
+		rows[idx] = make([]string, len(columns))
+
+		for cdx, col := range columns {
+			cell := tw.truncate(tableCell(val, col))
+			rows[idx][cdx] = cell
+
+			if width := utf8.RuneCountInString(cell); width > widths[cdx] {
+				widths[cdx] = width
+			}
+		}
+	}
+
+	writeTableBorder(buf, widths)
+	writeTableRow(buf, widths, header)
+	writeTableBorder(buf, widths)
+
+	for _, row := range rows {
+		writeTableRow(buf, widths, row)
+	}
+
+	writeTableBorder(buf, widths)
+
+	if hidden := len(values) - len(shown); hidden > 0 {
+		fmt.Fprintf(buf, "(%d more rows)\n", hidden)
+	}
+}
+
+// truncate will shorten the cell to the maximum column width.
+func (tw *TableWriter) truncate(cell string) string {
+	const ellipsis = "..."
+
+	if tw.maxColumnWidth <= 0 || utf8.RuneCountInString(cell) <= tw.maxColumnWidth {
+		return cell
+	}
+
+	runes := []rune(cell)
+	if tw.maxColumnWidth <= len(ellipsis) {
+		return string(runes[:tw.maxColumnWidth])
+	}
+
+	return string(runes[:tw.maxColumnWidth-len(ellipsis)]) + ellipsis
+}
+
+// tableColumns will return the union of the fields of the records, in
+// alphabetical order, followed by the "value" column if any value is not a
+// record.
+func tableColumns(values []*structpb.Value) []string {
+	fields := map[string]bool{}
+	hasValue := false
+
+	for _, val := range values {
+		record := val.GetStructValue()
+		if record == nil {
+			hasValue = true
+
+			continue
+		}
+
+		for field := range record.GetFields() {
+			fields[field] = true
+		}
+	}
+
+	columns := make([]string, 0, len(fields)+1)
+	for field := range fields {
+		columns = append(columns, field)
+	}
+
+	sort.Strings(columns)
+
+	if hasValue {
+		columns = append(columns, tableValueColumn)
+	}
+
+	return columns
+}
+
+// tableCell will return the text of the column of the value.
+func tableCell(val *structpb.Value, column string) string {
+	if record := val.GetStructValue(); record != nil {
+		field, ok := record.GetFields()[column]
+		if !ok {
+			return ""
+		}
+
+		return tableText(field)
+	}
+
+	if column == tableValueColumn {
+		return tableText(val)
+	}
+
+	return ""
+}
+
+// tableText will return the text of a value on a single line.
+func tableText(val *structpb.Value) string {
+	var text string
+
+	switch kind := val.GetKind().(type) {
+	case *structpb.Value_NullValue:
+		return ""
+	case *structpb.Value_StringValue:
+		text = kind.StringValue
+	case *structpb.Value_NumberValue:
+		text = strconv.FormatFloat(kind.NumberValue, 'f', -1, 64)
+	case *structpb.Value_BoolValue:
+		text = strconv.FormatBool(kind.BoolValue)
+	default:
+		data, err := json.Marshal(val.AsInterface())
+		if err != nil {
+			return ""
+		}
+
+		text = string(data)
+	}
+
+	return strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ").Replace(text)
+}
+
+// writeTableBorder will write a horizontal border of a table.
+func writeTableBorder(buf *bytes.Buffer, widths []int) {
+	buf.WriteByte('+')
+
+	for _, width := range widths {
+		buf.WriteString(strings.Repeat("-", width+2))
+		buf.WriteByte('+')
+	}
+
+	buf.WriteByte('\n')
+}
+
+// writeTableRow will write a row of a table, padding each cell to the width of
+// its column.
+func writeTableRow(buf *bytes.Buffer, widths []int, cells []string) {
+	buf.WriteByte('|')
+
+	for idx, cell := range cells {
+		buf.WriteByte(' ')
+		buf.WriteString(cell)
+		buf.WriteString(strings.Repeat(" ", widths[idx]-utf8.RuneCountInString(cell)+1))
+		buf.WriteByte('|')
+	}
+
+	buf.WriteByte('\n')
+}
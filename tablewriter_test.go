@@ -0,0 +1,152 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestTableWriter(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name   string
+		values []interface{}
+		opts   []TableWriterOption
+		want   string
+	}{
+		{
+			name: "union of columns",
+			values: []interface{}{
+				map[string]interface{}{"id": 1, "name": "a"},
+				map[string]interface{}{"id": 2, "price": 1.5},
+			},
+			want: `
++----+------+-------+
+| id | name | price |
++----+------+-------+
+| 1  | a    |       |
+| 2  |      | 1.5   |
++----+------+-------+
+`,
+		},
+		{
+			name: "nested values and values that are not records",
+			values: []interface{}{
+				map[string]interface{}{"tags": []interface{}{"x", "y"}, "ok": true, "note": nil},
+				"line one\nline two",
+			},
+			want: `
++------+------+-----------+-------------------+
+| note | ok   | tags      | value             |
++------+------+-----------+-------------------+
+|      | true | ["x","y"] |                   |
+|      |      |           | line one line two |
++------+------+-----------+-------------------+
+`,
+		},
+		{
+			name: "max column width",
+			values: []interface{}{
+				map[string]interface{}{"description": "a very long description"},
+			},
+			opts: []TableWriterOption{WithTableMaxColumnWidth(10)},
+			want: `
++------------+
+| descrip... |
++------------+
+| a very ... |
++------------+
+`,
+		},
+		{
+			name: "row limit",
+			values: []interface{}{
+				map[string]interface{}{"id": 1},
+				map[string]interface{}{"id": 2},
+				map[string]interface{}{"id": 3},
+			},
+			opts: []TableWriterOption{WithTableRowLimit(1)},
+			want: `
++----+
+| id |
++----+
+| 1  |
++----+
+(2 more rows)
+`,
+		},
+		{
+			name: "empty list",
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := structpb.NewList(tcase.values)
+			if err != nil {
+				t.Fatalf("failed to create list: %v", err)
+			}
+
+			buf := &bytes.Buffer{}
+
+			if err := NewTableWriter(buf, tcase.opts...).Write(context.Background(), list); err != nil {
+				t.Fatalf("failed to write table: %v", err)
+			}
+
+			if want := strings.TrimPrefix(tcase.want, "\n"); buf.String() != want {
+				t.Errorf("expected table:\n%s\ngot:\n%s", want, buf.String())
+			}
+		})
+	}
+}
+
+func TestTableWriterConcurrent(t *testing.T) {
+	t.Parallel()
+
+	const writes = 10
+
+	buf := &bytes.Buffer{}
+	writer := NewTableWriter(buf)
+
+	list, err := structpb.NewList([]interface{}{map[string]interface{}{"id": 1}, map[string]interface{}{"id": 2}})
+	if err != nil {
+		t.Fatalf("failed to create list: %v", err)
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(writes)
+
+	for i := 0; i < writes; i++ {
+		go func() {
+			defer wg.Done()
+
+			if err := writer.Write(context.Background(), list); err != nil {
+				t.Errorf("failed to write table: %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// Every table is written whole, so the output is the same table
+	// repeated.
+	table := "+----+\n| id |\n+----+\n| 1  |\n| 2  |\n+----+\n"
+	if want := strings.Repeat(table, writes); buf.String() != want {
+		t.Errorf("expected %d whole tables, got:\n%s", writes, buf.String())
+	}
+}
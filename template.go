@@ -0,0 +1,103 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrMissingTemplateVar is returned when a URL template has a placeholder with
+// no value.
+var ErrMissingTemplateVar = errors.New("missing template variable")
+
+// templateVar matches a "{name}" placeholder in a URL template.
+var templateVar = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandRequests will create a GET request for each set of variables by
+// substituting them into the "{name}" placeholders of the URL template, e.g.
+// one request per product for "https://example.com/products/{id}/candles".
+// Values are escaped for the part of the URL they are substituted into: a path
+// value is escaped as a single path segment, and a query value as a query
+// component. Every placeholder must have a value, or an ErrMissingTemplateVar
+// error is returned; variables without a placeholder are ignored. The options
+// are applied to every request.
+func ExpandRequests(ctx context.Context, template string, vars []map[string]string,
+	opts ...RequestOption,
+) ([]*Request, error) {
+	reqs := make([]*Request, 0, len(vars))
+
+	for idx, set := range vars {
+		rawURL, err := expandTemplate(template, set)
+		if err != nil {
+			return nil, fmt.Errorf("variables %d: %w", idx, err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("variables %d: %w: %w", idx, ErrInvalidRequest, err)
+		}
+
+		reqs = append(reqs, NewHTTPRequest(req, opts...))
+	}
+
+	return reqs, nil
+}
+
+// expandTemplate will substitute the variables into the URL template, escaping
+// them for the path or the query.
+func expandTemplate(template string, vars map[string]string) (string, error) {
+	path, query, hasQuery := strings.Cut(template, "?")
+
+	path, err := expandTemplatePart(path, vars, url.PathEscape)
+	if err != nil {
+		return "", err
+	}
+
+	if !hasQuery {
+		return path, nil
+	}
+
+	query, err = expandTemplatePart(query, vars, url.QueryEscape)
+	if err != nil {
+		return "", err
+	}
+
+	return path + "?" + query, nil
+}
+
+// expandTemplatePart will substitute the variables into a part of a URL
+// template, escaping each value.
+func expandTemplatePart(part string, vars map[string]string, escape func(string) string) (string, error) {
+	var missing []string
+
+	expanded := templateVar.ReplaceAllStringFunc(part, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+
+		val, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+
+			return placeholder
+		}
+
+		return escape(val)
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%w: %s", ErrMissingTemplateVar, strings.Join(missing, ", "))
+	}
+
+	return expanded, nil
+}
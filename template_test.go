@@ -0,0 +1,110 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestExpandRequests(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name     string
+		template string
+		vars     []map[string]string
+		want     []string
+		wantErr  error
+	}{
+		{
+			name:     "path",
+			template: "https://example.com/products/{id}/candles",
+			vars:     []map[string]string{{"id": "BTC-USD"}, {"id": "ETH-USD"}},
+			want: []string{
+				"https://example.com/products/BTC-USD/candles",
+				"https://example.com/products/ETH-USD/candles",
+			},
+		},
+		{
+			name:     "path and query",
+			template: "https://example.com/{version}/candles?product={id}&granularity=60",
+			vars:     []map[string]string{{"version": "v1", "id": "BTC-USD"}},
+			want:     []string{"https://example.com/v1/candles?product=BTC-USD&granularity=60"},
+		},
+		{
+			name:     "escaped path value",
+			template: "https://example.com/files/{name}",
+			vars:     []map[string]string{{"name": "a/b c?"}},
+			want:     []string{"https://example.com/files/a%2Fb%20c%3F"},
+		},
+		{
+			name:     "escaped query value",
+			template: "https://example.com/search?q={q}",
+			vars:     []map[string]string{{"q": "a&b=c d"}},
+			want:     []string{"https://example.com/search?q=a%26b%3Dc+d"},
+		},
+		{
+			name:     "repeated placeholder",
+			template: "https://example.com/{id}?id={id}",
+			vars:     []map[string]string{{"id": "1"}},
+			want:     []string{"https://example.com/1?id=1"},
+		},
+		{
+			name:     "unused variable",
+			template: "https://example.com/{id}",
+			vars:     []map[string]string{{"id": "1", "other": "x"}},
+			want:     []string{"https://example.com/1"},
+		},
+		{
+			name:     "no variables",
+			template: "https://example.com/{id}",
+			want:     []string{},
+		},
+		{
+			name:     "missing variable",
+			template: "https://example.com/{id}/{interval}",
+			vars:     []map[string]string{{"id": "1", "interval": "60"}, {"id": "2"}},
+			wantErr:  ErrMissingTemplateVar,
+		},
+		{
+			name:     "missing query variable",
+			template: "https://example.com/candles?product={id}",
+			vars:     []map[string]string{{}},
+			wantErr:  ErrMissingTemplateVar,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			reqs, err := ExpandRequests(context.Background(), tcase.template, tcase.vars,
+				WithWriters(&mockListWriter{}))
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+
+			if len(reqs) != len(tcase.want) {
+				t.Fatalf("expected %d requests, got %d", len(tcase.want), len(reqs))
+			}
+
+			for idx, req := range reqs {
+				if got := req.http.URL.String(); got != tcase.want[idx] {
+					t.Errorf("expected request %d URL %q, got %q", idx, tcase.want[idx], got)
+				}
+
+				if len(req.writers) != 1 {
+					t.Errorf("expected the options to be applied to request %d", idx)
+				}
+			}
+		})
+	}
+}
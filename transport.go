@@ -0,0 +1,171 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"runtime"
+)
+
+// workerCount is the number of web workers used to make requests
+// concurrently.
+func workerCount() int {
+	return runtime.NumCPU()
+}
+
+// transportOptions are the options used to build the client owned by an
+// HTTPService.
+type transportOptions struct {
+	tlsConfig          *tls.Config
+	proxy              func(*http.Request) (*url.URL, error)
+	forceHTTP1         bool
+	insecureSkipVerify bool
+}
+
+// newTransport will create a transport tuned for the web worker pool. The
+// transport is cloned from "http.DefaultTransport", whose limit of two idle
+// connections per host would otherwise cause the workers to constantly tear
+// down and re-establish connections to the same host. Instead, every worker
+// may keep an idle connection to a host. The number of connections to a host is
+// not capped, since a streamed body, e.g. of server-sent events or of
+// "NextStream", holds its connection for as long as it is read, and a cap would
+// leave the other requests to the host waiting for it; the number of requests
+// in flight is bounded by the HTTP Service's "MaxInFlight" method instead.
+//
+// HTTP/2 is negotiated with servers that support it over TLS, unless HTTP/1.1
+// is forced. Over HTTP/2, the requests to a host are multiplexed over a single
+// connection, and the number of requests in flight to a host is bounded by the
+// server's limit on concurrent streams.
+func newTransport(opts transportOptions) *http.Transport {
+	//nolint:forcetypeassert
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = workerCount()
+
+	if transport.MaxIdleConns < transport.MaxIdleConnsPerHost {
+		transport.MaxIdleConns = transport.MaxIdleConnsPerHost
+	}
+
+	if opts.tlsConfig != nil {
+		transport.TLSClientConfig = opts.tlsConfig
+	}
+
+	if opts.insecureSkipVerify {
+		if transport.TLSClientConfig != nil {
+			transport.TLSClientConfig = transport.TLSClientConfig.Clone()
+		} else {
+			transport.TLSClientConfig = &tls.Config{} //nolint:gosec
+		}
+
+		transport.TLSClientConfig.InsecureSkipVerify = true
+	}
+
+	if opts.proxy != nil {
+		transport.Proxy = opts.proxy
+	}
+
+	if opts.forceHTTP1 {
+		// A non-nil, empty map of upgrades disables HTTP/2, see the
+		// documentation of "net/http".
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+
+		if transport.TLSClientConfig != nil {
+			transport.TLSClientConfig = transport.TLSClientConfig.Clone()
+			transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
+		}
+	}
+
+	return transport
+}
+
+// newHTTPClient will create a new client using a transport tuned for the web
+// worker pool.
+func newHTTPClient(opts transportOptions) *http.Client {
+	return &http.Client{Transport: newTransport(opts)}
+}
+
+// ownClient will replace the client of the service with a new client that it
+// owns, whose idle connections are closed by "Close".
+func (svc *HTTPService) ownClient() {
+	svc.ownedClient = newHTTPClient(svc.transportOpts)
+	svc.client = svc.ownedClient
+}
+
+// rebuildClient will replace the client owned by the service with a client
+// built from the current transport options, so that they take effect. A client
+// set with the "Client" method is left as it is.
+func (svc *HTTPService) rebuildClient() {
+	if svc.client == svc.ownedClient {
+		svc.ownClient()
+	}
+}
+
+// TLSConfig will set the TLS configuration used to make requests, e.g. for
+// mutual TLS or private certificate authorities. It applies to authenticated
+// requests as well, see WithAuth.
+//
+// It only applies to the client owned by the service, and is ignored if a
+// client has been set with the "Client" method, whose transport must be
+// configured instead.
+func (svc *HTTPService) TLSConfig(cfg *tls.Config) *HTTPService {
+	svc.transportOpts.tlsConfig = cfg
+	svc.rebuildClient()
+
+	return svc
+}
+
+// InsecureSkipTLSVerify will make requests without verifying the certificate
+// chain and host name of the server, e.g. for an internal or test endpoint with
+// a self-signed certificate.
+//
+// WARNING: this makes every request of the service open to
+// man-in-the-middle attacks, and must never be used in production. To trust a
+// private certificate authority, use "TLSConfig" with its "RootCAs" instead.
+//
+// It only applies to the client owned by the service, including authenticated
+// requests, see WithAuth, and is ignored if a client has been set with the
+// "Client" method. By default, certificates are verified.
+func (svc *HTTPService) InsecureSkipTLSVerify() *HTTPService {
+	svc.transportOpts.insecureSkipVerify = true
+	svc.rebuildClient()
+
+	return svc
+}
+
+// ForceHTTP1 will make requests over HTTP/1.1 only, for servers whose HTTP/2
+// support is broken. By default, HTTP/2 is used with servers that support it
+// over TLS, which can outperform many HTTP/1.1 connections under the worker
+// pool. Over HTTP/1.1, each request in flight takes a connection of its own.
+// It applies to authenticated requests as well, see WithAuth.
+//
+// It only applies to the client owned by the service, and is ignored if a
+// client has been set with the "Client" method, whose transport decides the
+// protocol instead.
+func (svc *HTTPService) ForceHTTP1(force bool) *HTTPService {
+	svc.transportOpts.forceHTTP1 = force
+	svc.rebuildClient()
+
+	return svc
+}
+
+// Proxy will set the function used to determine the proxy for each request,
+// see "http.ProxyURL" and "http.ProxyFromEnvironment". It applies to
+// authenticated requests as well, see WithAuth.
+//
+// It only applies to the client owned by the service, and is ignored if a
+// client has been set with the "Client" method, whose transport must be
+// configured instead.
+func (svc *HTTPService) Proxy(proxy func(*http.Request) (*url.URL, error)) *HTTPService {
+	svc.transportOpts.proxy = proxy
+	svc.rebuildClient()
+
+	return svc
+}
@@ -0,0 +1,474 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alpstable/gidari/auth"
+)
+
+// newTestServerRequest will create a request for the test server's URL.
+func newTestServerRequest(t *testing.T, url string, opts ...RequestOption) *Request {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	return NewHTTPRequest(req, opts...)
+}
+
+// iterateAll will iterate over every response in the HTTP service, returning
+// the responses and the iterator error.
+func iterateAll(t *testing.T, svc *HTTPService) ([]*http.Response, error) {
+	t.Helper()
+
+	var rsps []*http.Response
+
+	for svc.Iterator.Next(context.Background()) {
+		rsps = append(rsps, svc.Iterator.Current.Response)
+	}
+
+	return rsps, svc.Iterator.Err()
+}
+
+func TestNewTransport(t *testing.T) {
+	t.Parallel()
+
+	transport := newTransport(transportOptions{})
+
+	if transport.MaxIdleConnsPerHost != workerCount() {
+		t.Errorf("expected %d idle connections per host, got %d",
+			workerCount(), transport.MaxIdleConnsPerHost)
+	}
+
+	// Streamed bodies hold their connections, so the connections to a
+	// host must not be capped.
+	if transport.MaxConnsPerHost != 0 {
+		t.Errorf("expected no limit on connections per host, got %d", transport.MaxConnsPerHost)
+	}
+}
+
+func TestHTTPServiceDefaultClient(t *testing.T) {
+	t.Parallel()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	client, ok := svc.HTTP.client.(*http.Client)
+	if !ok {
+		t.Fatalf("expected an *http.Client, got %T", svc.HTTP.client)
+	}
+
+	if client == http.DefaultClient {
+		t.Fatal("expected the service to own its client")
+	}
+
+	custom := &http.Client{}
+	if svc.HTTP.Client(custom).client != custom {
+		t.Error("expected a user-supplied client to be used as-is")
+	}
+}
+
+func TestHTTPServiceTransportOptionsKeepClient(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name string
+		opt  func(*HTTPService) *HTTPService
+	}{
+		{
+			name: "force http1",
+			opt:  func(svc *HTTPService) *HTTPService { return svc.ForceHTTP1(true) },
+		},
+		{
+			name: "insecure skip tls verify",
+			opt:  (*HTTPService).InsecureSkipTLSVerify,
+		},
+		{
+			name: "tls config",
+			opt: func(svc *HTTPService) *HTTPService {
+				return svc.TLSConfig(&tls.Config{MinVersion: tls.VersionTLS12})
+			},
+		},
+		{
+			name: "proxy",
+			opt:  func(svc *HTTPService) *HTTPService { return svc.Proxy(http.ProxyFromEnvironment) },
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			// The option applies to the client owned by the
+			// service, which is replaced to apply it.
+			owned := svc.HTTP.ownedClient
+			if tcase.opt(svc.HTTP).client == owned {
+				t.Error("expected the owned client to be rebuilt")
+			}
+
+			// A user-supplied client is left as it is.
+			custom := &http.Client{}
+			if tcase.opt(svc.HTTP.Client(custom)).client != custom {
+				t.Error("expected a user-supplied client to be kept")
+			}
+		})
+	}
+}
+
+func TestHTTPServiceTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	basicAuth, err := auth.NewBasicAuthRoundTrip("user", "pass")
+	if err != nil {
+		t.Fatalf("failed to create auth round tripper: %v", err)
+	}
+
+	for _, tcase := range []struct {
+		name string
+		opts []RequestOption
+	}{
+		{name: "unauthenticated"},
+		{name: "authenticated", opts: []RequestOption{WithAuth(basicAuth)}},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			svc.HTTP.
+				TLSConfig(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}).
+				Requests(newTestServerRequest(t, server.URL, tcase.opts...))
+
+			rsps, err := iterateAll(t, svc.HTTP)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(rsps) != 1 || rsps[0].StatusCode != http.StatusOK {
+				t.Fatalf("expected one OK response, got %v", rsps)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceInsecureSkipTLSVerify(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	basicAuth, err := auth.NewBasicAuthRoundTrip("user", "pass")
+	if err != nil {
+		t.Fatalf("failed to create auth round tripper: %v", err)
+	}
+
+	for _, tcase := range []struct {
+		name     string
+		client   Client
+		insecure bool
+		opts     []RequestOption
+		wantErr  bool
+	}{
+		{name: "verified", wantErr: true},
+		{name: "insecure", insecure: true},
+		{name: "insecure with auth", insecure: true, opts: []RequestOption{WithAuth(basicAuth)}},
+		{name: "insecure with own client", client: &http.Client{}, insecure: true, wantErr: true},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			if tcase.client != nil {
+				svc.HTTP.Client(tcase.client)
+			}
+
+			if tcase.insecure {
+				svc.HTTP.InsecureSkipTLSVerify()
+			}
+
+			svc.HTTP.Requests(newTestServerRequest(t, server.URL, tcase.opts...))
+
+			var certErr *tls.CertificateVerificationError
+
+			_, err = iterateAll(t, svc.HTTP)
+			if tcase.wantErr && !errors.As(err, &certErr) {
+				t.Fatalf("expected a certificate error, got %v", err)
+			}
+
+			if !tcase.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceForceHTTP1(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proto", r.Proto)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	basicAuth, err := auth.NewBasicAuthRoundTrip("user", "pass")
+	if err != nil {
+		t.Fatalf("failed to create auth round tripper: %v", err)
+	}
+
+	for _, tcase := range []struct {
+		name       string
+		forceHTTP1 bool
+		opts       []RequestOption
+		want       string
+	}{
+		{name: "negotiated", want: "HTTP/2.0"},
+		{name: "forced", forceHTTP1: true, want: "HTTP/1.1"},
+		{name: "negotiated with auth", opts: []RequestOption{WithAuth(basicAuth)}, want: "HTTP/2.0"},
+		{name: "forced with auth", forceHTTP1: true, opts: []RequestOption{WithAuth(basicAuth)}, want: "HTTP/1.1"},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			svc.HTTP.
+				TLSConfig(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}).
+				ForceHTTP1(tcase.forceHTTP1).
+				Requests(newTestServerRequest(t, server.URL, tcase.opts...))
+
+			rsps, err := iterateAll(t, svc.HTTP)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(rsps) != 1 {
+				t.Fatalf("expected one response, got %d", len(rsps))
+			}
+
+			if got := rsps[0].Header.Get("X-Proto"); got != tcase.want {
+				t.Errorf("expected the request to be made over %s, got %s", tcase.want, got)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceProxy(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	// The proxy answers the requests itself, recording that they were
+	// made through it.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proxied", "true")
+		w.Header().Set("X-Authorized", r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(proxy.Close)
+
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatalf("failed to parse proxy URL: %v", err)
+	}
+
+	basicAuth, err := auth.NewBasicAuthRoundTrip("user", "pass")
+	if err != nil {
+		t.Fatalf("failed to create auth round tripper: %v", err)
+	}
+
+	for _, tcase := range []struct {
+		name string
+		opts []RequestOption
+	}{
+		{name: "unauthenticated"},
+		{name: "authenticated", opts: []RequestOption{WithAuth(basicAuth)}},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			svc.HTTP.
+				Proxy(http.ProxyURL(proxyURL)).
+				Requests(newTestServerRequest(t, server.URL, tcase.opts...))
+
+			rsps, err := iterateAll(t, svc.HTTP)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(rsps) != 1 || rsps[0].Header.Get("X-Proxied") != "true" {
+				t.Fatal("expected the request to be made through the proxy")
+			}
+
+			authorized := rsps[0].Header.Get("X-Authorized") != ""
+			if authenticated := len(tcase.opts) > 0; authorized != authenticated {
+				t.Errorf("expected the request to be authenticated: %t, got %t", authenticated, authorized)
+			}
+		})
+	}
+}
+
+// benchmarkTransport will make concurrent requests to a local server using
+// the given transport, reporting the number of connections opened per
+// operation. If tlsServer is true, then the server supports both HTTP/1.1 and
+// HTTP/2 over TLS, and the transport must trust its certificate.
+func benchmarkTransport(b *testing.B, transport *http.Transport, server *httptest.Server, tlsServer bool) {
+	b.Helper()
+
+	var conns int64
+
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+
+	if tlsServer {
+		server.EnableHTTP2 = true
+		server.StartTLS()
+	} else {
+		server.Start()
+	}
+
+	defer server.Close()
+
+	client := &http.Client{Transport: transport}
+	defer transport.CloseIdleConnections()
+
+	// Run more goroutines than there are workers, mimicking the goroutine
+	// spawned for every job in the web worker pool.
+	const parallelism = 8
+
+	b.SetParallelism(parallelism)
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+
+			rsp, err := client.Do(req)
+			if err != nil {
+				b.Errorf("failed to make request: %v", err)
+
+				return
+			}
+
+			_, _ = io.Copy(io.Discard, rsp.Body)
+			rsp.Body.Close()
+		}
+	})
+
+	b.ReportMetric(float64(atomic.LoadInt64(&conns))/float64(b.N), "conns/op")
+}
+
+// newBenchmarkServer will create an unstarted server that responds with 200
+// (OK) to every request.
+func newBenchmarkServer() *httptest.Server {
+	return httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func BenchmarkTransport(b *testing.B) {
+	b.Run("default transport", func(b *testing.B) {
+		//nolint:forcetypeassert
+		benchmarkTransport(b, http.DefaultTransport.(*http.Transport).Clone(), newBenchmarkServer(), false)
+	})
+
+	b.Run("worker pool transport", func(b *testing.B) {
+		benchmarkTransport(b, newTransport(transportOptions{}), newBenchmarkServer(), false)
+	})
+}
+
+func BenchmarkTransportProtocol(b *testing.B) {
+	for _, bcase := range []struct {
+		name       string
+		forceHTTP1 bool
+	}{
+		{name: "http1", forceHTTP1: true},
+		{name: "http2"},
+	} {
+		bcase := bcase
+
+		b.Run(bcase.name, func(b *testing.B) {
+			server := newBenchmarkServer()
+
+			// The server's certificate is only created once it is
+			// started, so trust every certificate of the local
+			// server.
+			transport := newTransport(transportOptions{
+				tlsConfig:  &tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+				forceHTTP1: bcase.forceHTTP1,
+			})
+
+			benchmarkTransport(b, transport, server, true)
+		})
+	}
+}
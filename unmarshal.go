@@ -0,0 +1,69 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrUnmarshal is returned when a record of a response cannot be unmarshaled
+// into the type given to Unmarshal.
+var ErrUnmarshal = errors.New("failed to unmarshal record")
+
+// Unmarshal will unmarshal the JSON body of the iterator's current response
+// into values of type T using "encoding/json", for typed access to the data
+// without a list writer:
+//
+//	for svc.HTTP.Iterator.Next(ctx) {
+//		products, err := gidari.Unmarshal[Product](svc.HTTP.Iterator.Current)
+//		...
+//	}
+//
+// If the body is an array, then each of its elements is a record and is
+// unmarshaled into its own T, in order. Otherwise, the body is a single record.
+// An empty body has no records. If a record cannot be unmarshaled, e.g.
+// because a field has the wrong type, then an ErrUnmarshal error is returned
+// that identifies the record by its index in the array.
+func Unmarshal[T any](current *Current) ([]T, error) {
+	if current == nil {
+		return nil, nil
+	}
+
+	data := bytes.TrimSpace(current.Data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	if data[0] != '[' {
+		var val T
+		if err := json.Unmarshal(data, &val); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrUnmarshal, err)
+		}
+
+		return []T{val}, nil
+	}
+
+	var records []json.RawMessage
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnmarshal, err)
+	}
+
+	vals := make([]T, len(records))
+
+	for idx, record := range records {
+		if err := json.Unmarshal(record, &vals[idx]); err != nil {
+			return nil, fmt.Errorf("%w: record %d: %w", ErrUnmarshal, idx, err)
+		}
+	}
+
+	return vals, nil
+}
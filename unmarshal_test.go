@@ -0,0 +1,129 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testProduct struct {
+	ID    string  `json:"id"`
+	Price float64 `json:"price"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name      string
+		body      string
+		want      []testProduct
+		wantErr   error
+		wantInErr string
+	}{
+		{
+			name: "array",
+			body: `[{"id":"BTC-USD","price":1.5},{"id":"ETH-USD"}]`,
+			want: []testProduct{{ID: "BTC-USD", Price: 1.5}, {ID: "ETH-USD"}},
+		},
+		{
+			name: "object",
+			body: ` {"id":"BTC-USD","price":2}`,
+			want: []testProduct{{ID: "BTC-USD", Price: 2}},
+		},
+		{
+			name: "empty array",
+			body: `[]`,
+			want: []testProduct{},
+		},
+		{
+			name: "empty body",
+		},
+		{
+			name:      "type mismatch",
+			body:      `[{"id":"BTC-USD"},{"id":"ETH-USD","price":"high"}]`,
+			wantErr:   ErrUnmarshal,
+			wantInErr: "record 1",
+		},
+		{
+			name:    "invalid json",
+			body:    `[{"id":`,
+			wantErr: ErrUnmarshal,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Unmarshal[testProduct](&Current{Data: []byte(tcase.body)})
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+
+			if err != nil && !strings.Contains(err.Error(), tcase.wantInErr) {
+				t.Errorf("expected error to contain %q, got %v", tcase.wantInErr, err)
+			}
+
+			var typeErr *json.UnmarshalTypeError
+			if tcase.wantInErr != "" && !errors.As(err, &typeErr) {
+				t.Errorf("expected a type error, got %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tcase.want) {
+				t.Errorf("expected %v, got %v", tcase.want, got)
+			}
+		})
+	}
+}
+
+func TestUnmarshalIterator(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"id":%q,"price":1}]`, strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	t.Cleanup(server.Close)
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	svc.HTTP.Requests(newTestServerRequest(t, server.URL+"/a"), newTestServerRequest(t, server.URL+"/b"))
+	svc.HTTP.Ordered(true)
+
+	var got []testProduct
+
+	for svc.HTTP.Iterator.Next(context.Background()) {
+		products, err := Unmarshal[testProduct](svc.HTTP.Iterator.Current)
+		if err != nil {
+			t.Fatalf("failed to unmarshal: %v", err)
+		}
+
+		got = append(got, products...)
+	}
+
+	if err := svc.HTTP.Iterator.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []testProduct{{ID: "a", Price: 1}, {ID: "b", Price: 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// RecordValidator returns an error if a record is not valid, e.g. because it
+// does not match the schema that the API is expected to respond with. A record
+// that is not an object is given as a record with a single "value" field.
+type RecordValidator func(record map[string]interface{}) error
+
+// WithValidator will validate every record of the request as it is decoded,
+// before it is flattened, labeled, or written, to catch changes to an upstream
+// API early. A record that is not valid is not written to the request's
+// writers: it is written to the dead letter writer instead, if there is one,
+// and counted in the result's "InvalidRecords". Each invalid record is logged
+// at the warning level with the error of the validator. A validator is shared
+// by the responses of the request, so it must be safe for concurrent use.
+func WithValidator(validate RecordValidator, deadLetter ListWriter) RequestOption {
+	return func(req *Request) {
+		req.validate = validate
+		req.invalidWriter = deadLetter
+	}
+}
+
+// validateList will remove the records of the list that are not valid,
+// returning them in a list of their own.
+func validateList(ctx context.Context, job *listWriterJob, list *structpb.ListValue) *structpb.ListValue {
+	if job.validate == nil {
+		return nil
+	}
+
+	valid := list.Values[:0]
+	invalid := &structpb.ListValue{}
+
+	for _, value := range list.Values {
+		var record map[string]interface{}
+		if fields := value.GetStructValue(); fields != nil {
+			record = fields.AsMap()
+		} else {
+			record = map[string]interface{}{tableValueColumn: value.AsInterface()}
+		}
+
+		err := job.validate(record)
+		if err == nil {
+			valid = append(valid, value)
+
+			continue
+		}
+
+		invalid.Values = append(invalid.Values, value)
+
+		if job.logger != nil {
+			job.logger.LogAttrs(ctx, slog.LevelWarn, "invalid record",
+				slog.String("url", job.url),
+				slog.String("error", err.Error()))
+		}
+	}
+
+	list.Values = valid
+
+	return invalid
+}
+
+// writeInvalid will write the invalid records of a response to the dead letter
+// writer, if there is one.
+func writeInvalid(ctx context.Context, job *listWriterJob, invalid *structpb.ListValue) error {
+	if len(invalid.GetValues()) == 0 {
+		return nil
+	}
+
+	if job.stats != nil {
+		job.stats.invalidRecords.Add(int64(len(invalid.Values)))
+	}
+
+	if job.invalidWriter == nil || job.dryRun {
+		return nil
+	}
+
+	if err := job.invalidWriter.Write(ctx, invalid); err != nil {
+		return fmt.Errorf("failed to write invalid records to %T: %w", job.invalidWriter, err)
+	}
+
+	return nil
+}
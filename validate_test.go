@@ -0,0 +1,105 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPServiceValidator(t *testing.T) {
+	t.Parallel()
+
+	// The second record has changed upstream: its "id" is now a string,
+	// and its "name" is missing.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id":1,"name":"a"},{"id":"2"}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	errInvalid := errors.New("invalid record")
+
+	validate := func(record map[string]interface{}) error {
+		if _, ok := record["id"].(float64); !ok {
+			return fmt.Errorf("%w: id is not a number", errInvalid)
+		}
+
+		if _, ok := record["name"].(string); !ok {
+			return fmt.Errorf("%w: name is not a string", errInvalid)
+		}
+
+		return nil
+	}
+
+	for _, tcase := range []struct {
+		name           string
+		dryRun         bool
+		wantRecords    int64
+		wantDeadLetter int
+	}{
+		{
+			name:           "dead letter",
+			wantRecords:    1,
+			wantDeadLetter: 1,
+		},
+		{
+			name:        "dry run",
+			dryRun:      true,
+			wantRecords: 1,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			writer, deadLetter := &mockListWriter{}, &mockListWriter{}
+
+			svc.HTTP.DryRun(tcase.dryRun).Requests(newTestServerRequest(t, server.URL,
+				WithWriters(writer),
+				WithValidator(validate, deadLetter)))
+
+			if err := svc.HTTP.Store(context.Background()); err != nil {
+				t.Fatalf("failed to store: %v", err)
+			}
+
+			result := svc.HTTP.Result()
+			if result.Records != tcase.wantRecords || result.InvalidRecords != 1 {
+				t.Errorf("expected %d records and 1 invalid record, got %d and %d",
+					tcase.wantRecords, result.Records, result.InvalidRecords)
+			}
+
+			if deadLetter.count != tcase.wantDeadLetter {
+				t.Fatalf("expected %d dead letter lists, got %d", tcase.wantDeadLetter, deadLetter.count)
+			}
+
+			if tcase.dryRun {
+				return
+			}
+
+			if got := strings.ReplaceAll(string(writer.data[0]), " ", ""); got != `[{"id":1,"name":"a"}]` {
+				t.Errorf("expected the valid record to be written, got %s", got)
+			}
+
+			if got := strings.ReplaceAll(string(deadLetter.data[0]), " ", ""); got != `[{"id":"2"}]` {
+				t.Errorf("expected the invalid record in the dead letter, got %s", got)
+			}
+		})
+	}
+}
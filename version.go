@@ -10,3 +10,7 @@ package gidari
 
 // Version is the version of the Gidari library.
 const Version = "0.4.0-prerelease"
+
+// defaultUserAgent is the User-Agent header value used for requests that do not
+// set one.
+const defaultUserAgent = "gidari/" + Version